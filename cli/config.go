@@ -0,0 +1,160 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// ConfigFileFlag is the name of the flag used to specify a configuration file
+const ConfigFileFlag = "config"
+
+// RegisterConfigFileFlag registers the --config flag used by CobraBindConfigFile with pflags
+func RegisterConfigFileFlag(flags *pflag.FlagSet) {
+	flags.String(ConfigFileFlag, "", "Path to a YAML, TOML or JSON configuration file. Flags and environment variables take precedence over values in the file.")
+}
+
+// CobraBindConfigFile can be used at the root command level of a cobra CLI hierarchy to allow
+// all command-line variables to be set from the configuration file given by the --config flag.
+// The file format is determined by its extension and may be YAML, TOML or JSON. Flags must be
+// registered with RegisterConfigFileFlag.
+//
+// Nested keys are joined with dashes to form flag names, so each of the following YAML documents
+// sets the `pg-host` flag:
+//
+//	pg-host: localhost
+//
+//	pg:
+//	  host: localhost
+//
+// Underscores in keys are treated as dashes as well. List values are applied to the flag one
+// element at a time, which suits slice and array flags. Any key which does not correspond to a
+// registered flag results in an error so that typos are caught at startup.
+//
+// Values from the file are only applied to flags which have not already been set. When used after
+// CobraBindEnvironmentVariables, precedence is therefore flag > environment > file > default.
+func CobraBindConfigFile() func(cmd *cobra.Command, _ []string) error {
+	return func(cmd *cobra.Command, _ []string) error {
+		return ApplyConfigFile(cmd.Flags())
+	}
+}
+
+// ApplyConfigFile reads the configuration file given by the --config flag, if any, and applies
+// its values to the given flags. Values are only applied to flags which have not been set or
+// which were previously set from the configuration file, so this function may be called again at
+// runtime to reload the file without overriding command line arguments or environment variables.
+//
+// All keys are validated before any value is applied. However, if a value cannot be parsed by its
+// flag, the values preceding it will already have been applied. Keys which are removed from the
+// file retain their previous value.
+func ApplyConfigFile(flags *pflag.FlagSet) error {
+	path, err := flags.GetString(ConfigFileFlag)
+	if err != nil || path == "" {
+		return nil
+	}
+	values, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	unknown := make([]string, 0)
+	for name := range values {
+		if name == ConfigFileFlag || flags.Lookup(name) == nil {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown keys in configuration file %s: %s", path, strings.Join(unknown, ", "))
+	}
+	for name, value := range values {
+		flag := flags.Lookup(name)
+		if _, fromConfigFile := flag.Annotations[configFileAnnotation]; flag.Changed && !fromConfigFile {
+			continue
+		}
+		if err := setFlag(flags, flag, value); err != nil {
+			return fmt.Errorf("invalid value for `%s` in configuration file %s: %w", name, path, err)
+		}
+		if err := flags.SetAnnotation(name, configFileAnnotation, []string{path}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configFileAnnotation is the flag annotation used to mark flags set from the configuration file
+const configFileAnnotation = "cli_config_file"
+
+// setFlag replaces the value of the given flag. Each element of a list value is set in turn, and
+// the existing contents of slice and array flags are cleared beforehand so that reloading a list
+// does not append to it.
+func setFlag(flags *pflag.FlagSet, flag *pflag.Flag, value []string) error {
+	if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+		if err := sliceValue.Replace([]string{}); err != nil {
+			return err
+		}
+		flag.Changed = true
+	}
+	for _, v := range value {
+		if err := flags.Set(flag.Name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadConfigFile reads the configuration file at the given path and returns its values keyed by
+// flag name
+func loadConfigFile(path string) (map[string][]string, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read configuration file %s: %w", path, err)
+	}
+	values := make(map[string][]string)
+	for _, key := range v.AllKeys() {
+		name := strings.NewReplacer(".", "-", "_", "-").Replace(key)
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("key `%s` is specified more than once in configuration file %s", name, path)
+		}
+		switch value := v.Get(key).(type) {
+		case []interface{}:
+			values[name] = make([]string, 0, len(value))
+			for _, element := range value {
+				values[name] = append(values[name], formatValue(element))
+			}
+		case nil:
+			values[name] = []string{}
+		default:
+			values[name] = []string{formatValue(value)}
+		}
+	}
+	return values, nil
+}
+
+// formatValue formats a single configuration value such that it can be parsed by a flag. Floats
+// are never formatted with exponents, as JSON decodes all numbers as floats.
+func formatValue(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFlags contains the values of the flags registered by newTestCommand
+type testFlags struct {
+	pgHost       string
+	brokers      []string
+	issuers      []string
+	pgPort       uint16
+	timeout      time.Duration
+	pprofHandler bool
+}
+
+// newTestCommand returns a command with a representative set of flags
+func newTestCommand(values *testFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "test",
+		PersistentPreRunE: CobraBindConfigFile(),
+		RunE:              func(_ *cobra.Command, _ []string) error { return nil },
+	}
+	flags := cmd.Flags()
+	RegisterConfigFileFlag(flags)
+	flags.StringVar(&values.pgHost, "pg-host", "default", "")
+	flags.Uint16Var(&values.pgPort, "pg-port", 5432, "")
+	flags.DurationVar(&values.timeout, "shutdown-timeout", time.Second, "")
+	flags.BoolVar(&values.pprofHandler, "pprof-handler", false, "")
+	flags.StringArrayVar(&values.brokers, "kafka-broker-addr", []string{}, "")
+	flags.StringSliceVar(&values.issuers, "jose-valid-issuers", []string{}, "")
+	return cmd
+}
+
+func TestCobraBindConfigFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		contents    string
+		args        []string
+		expected    testFlags
+		expectedErr string
+	}{
+		{
+			name: "no configuration file leaves defaults untouched",
+			expected: testFlags{
+				pgHost: "default", pgPort: 5432, timeout: time.Second,
+				brokers: []string{}, issuers: []string{},
+			},
+		}, {
+			name: "nested yaml keys map onto flag names",
+			file: "config.yaml",
+			contents: `
+pg:
+  host: db.internal
+  port: 6432
+kafka:
+  broker_addr:
+    - kafka-1:9092
+    - kafka-2:9092
+jose-valid-issuers: [a, b]
+shutdown-timeout: 30s
+pprof-handler: true
+`,
+			expected: testFlags{
+				pgHost: "db.internal", pgPort: 6432, timeout: 30 * time.Second, pprofHandler: true,
+				brokers: []string{"kafka-1:9092", "kafka-2:9092"}, issuers: []string{"a", "b"},
+			},
+		}, {
+			name: "toml files are supported",
+			file: "config.toml",
+			contents: `
+[pg]
+host = "db.internal"
+port = 6432
+`,
+			expected: testFlags{
+				pgHost: "db.internal", pgPort: 6432, timeout: time.Second,
+				brokers: []string{}, issuers: []string{},
+			},
+		}, {
+			name:     "json files are supported",
+			file:     "config.json",
+			contents: `{"pg": {"host": "db.internal", "port": 6432}}`,
+			expected: testFlags{
+				pgHost: "db.internal", pgPort: 6432, timeout: time.Second,
+				brokers: []string{}, issuers: []string{},
+			},
+		}, {
+			name:     "command line flags take precedence over the file",
+			file:     "config.yaml",
+			contents: "pg-host: db.internal\npg-port: 6432\n",
+			args:     []string{"--pg-host", "localhost"},
+			expected: testFlags{
+				pgHost: "localhost", pgPort: 6432, timeout: time.Second,
+				brokers: []string{}, issuers: []string{},
+			},
+		}, {
+			name:        "unknown keys result in an error",
+			file:        "config.yaml",
+			contents:    "pg:\n  hots: db.internal\nverbose: true\n",
+			expectedErr: "unknown keys in configuration file",
+		}, {
+			name:        "invalid values result in an error",
+			file:        "config.yaml",
+			contents:    "pg-port: not-a-port\n",
+			expectedErr: "invalid value for `pg-port`",
+		}, {
+			name:        "a missing file results in an error",
+			args:        []string{"--config", "does-not-exist.yaml"},
+			expectedErr: "failed to read configuration file",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := test.args
+			if test.file != "" {
+				path := filepath.Join(t.TempDir(), test.file)
+				require.NoError(t, os.WriteFile(path, []byte(test.contents), 0600))
+				args = append(args, "--config", path)
+			}
+			values := testFlags{}
+			cmd := newTestCommand(&values)
+			cmd.SetArgs(args)
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			err := cmd.Execute()
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, values)
+		})
+	}
+}
+
+func TestCobraBindConfigFilePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("pg-host: from-file\npg-port: 6432\n"), 0600))
+	t.Setenv("CONFIGTEST_PG_HOST", "from-env")
+
+	values := testFlags{}
+	cmd := newTestCommand(&values)
+	bindEnvironmentVariables := CobraBindEnvironmentVariables("configtest")
+	bindConfigFile := cmd.PersistentPreRunE
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		bindEnvironmentVariables(cmd, args)
+		return bindConfigFile(cmd, args)
+	}
+	cmd.SetArgs([]string{"--config", path})
+	require.NoError(t, cmd.Execute())
+	// environment variables take precedence over the file, which takes precedence over defaults
+	assert.Equal(t, "from-env", values.pgHost)
+	assert.Equal(t, uint16(6432), values.pgPort)
+	assert.Equal(t, time.Second, values.timeout)
+}
+
+func TestApplyConfigFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("pg-host: from-file\npg-port: 6432\nkafka-broker-addr: [kafka-1:9092]\n"), 0600))
+	values := testFlags{}
+	cmd := newTestCommand(&values)
+	cmd.SetArgs([]string{"--config", path, "--pg-port", "7432"})
+	require.NoError(t, cmd.Execute())
+	assert.Equal(t, "from-file", values.pgHost)
+	assert.Equal(t, uint16(7432), values.pgPort)
+	assert.Equal(t, []string{"kafka-1:9092"}, values.brokers)
+
+	// values previously set from the file are replaced, while command line arguments are retained
+	require.NoError(t, os.WriteFile(path, []byte("pg-host: reloaded\npg-port: 6432\nkafka-broker-addr: [kafka-2:9092, kafka-3:9092]\n"), 0600))
+	require.NoError(t, ApplyConfigFile(cmd.Flags()))
+	assert.Equal(t, "reloaded", values.pgHost)
+	assert.Equal(t, uint16(7432), values.pgPort)
+	assert.Equal(t, []string{"kafka-2:9092", "kafka-3:9092"}, values.brokers)
+
+	// unknown keys are rejected before any value is applied
+	require.NoError(t, os.WriteFile(path, []byte("pg-host: ignored\npg-hots: typo\n"), 0600))
+	assert.Error(t, ApplyConfigFile(cmd.Flags()))
+	assert.Equal(t, "reloaded", values.pgHost)
+}
@@ -16,6 +16,7 @@ package cors
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"github.com/gorilla/mux"
 )
@@ -38,3 +39,37 @@ func (c Config) GetHTTPServerMiddleware() mux.MiddlewareFunc {
 		})
 	}
 }
+
+// Reloadable holds a cors Config which may be replaced at runtime without interrupting
+// in-flight requests
+type Reloadable struct {
+	config atomic.Pointer[Config]
+}
+
+// NewReloadable creates and returns a Reloadable holding the given Config
+func NewReloadable(c Config) *Reloadable {
+	r := &Reloadable{}
+	r.Reload(c)
+	return r
+}
+
+// Reload replaces the Config used by all future requests
+func (r *Reloadable) Reload(c Config) {
+	r.config.Store(&c)
+}
+
+// GetHTTPServerMiddleware returns middleware which behaves like Config.GetHTTPServerMiddleware
+// using the most recently loaded Config. Requests are passed through unmodified while
+// EnableMiddleware is false.
+func (r *Reloadable) GetHTTPServerMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			c := r.config.Load()
+			if !c.EnableMiddleware {
+				next.ServeHTTP(w, req)
+				return
+			}
+			c.GetHTTPServerMiddleware()(next).ServeHTTP(w, req)
+		})
+	}
+}
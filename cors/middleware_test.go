@@ -80,3 +80,42 @@ func TestGetHTTPServerMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestReloadable(t *testing.T) {
+	r := NewReloadable(Config{})
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := r.GetHTTPServerMiddleware()(testHandler)
+	tests := []struct {
+		name           string
+		config         Config
+		expectedOrigin string
+		expectedCode   int
+	}{
+		{
+			name:         "disabled middleware passes requests through",
+			config:       Config{AllowedOrigins: "*"},
+			expectedCode: http.StatusTeapot,
+		}, {
+			name:           "enabled middleware applies the reloaded config",
+			config:         Config{EnableMiddleware: true, AllowedOrigins: "https://example.com"},
+			expectedOrigin: "https://example.com",
+			expectedCode:   http.StatusTeapot,
+		}, {
+			name:           "reloaded config replaces the previous config",
+			config:         Config{EnableMiddleware: true, AllowedOrigins: "*"},
+			expectedOrigin: "*",
+			expectedCode:   http.StatusTeapot,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r.Reload(test.config)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, test.expectedCode, rec.Code)
+			assert.Equal(t, test.expectedOrigin, rec.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
@@ -0,0 +1,7 @@
+// Package errors provides typed application errors which carry a kind, a machine-readable code, a
+// message which is safe to return to clients, the internal cause and log fields. Errors are
+// rendered as RFC 7807 `application/problem+json` responses in HTTP handlers and as gRPC statuses
+// with error details by the gRPC server interceptors, which log them with Log. NewLogContext
+// attaches the fields of an error to the request logger returned by log.Get for the rest of the
+// request.
+package errors
@@ -0,0 +1,227 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// Kind classifies an Error and determines its HTTP status and gRPC code
+type Kind int
+
+const (
+	// Internal indicates an unexpected failure within the service. This is the zero Kind.
+	Internal Kind = iota
+	// InvalidArgument indicates that the request was malformed or failed validation
+	InvalidArgument
+	// NotFound indicates that the requested resource does not exist
+	NotFound
+	// AlreadyExists indicates that the resource conflicts with an existing resource
+	AlreadyExists
+	// FailedPrecondition indicates that the system is not in a state required for the operation
+	FailedPrecondition
+	// Unauthenticated indicates that the request does not have valid credentials
+	Unauthenticated
+	// PermissionDenied indicates that the caller is not permitted to perform the operation
+	PermissionDenied
+	// ResourceExhausted indicates that a quota or rate limit has been exceeded
+	ResourceExhausted
+	// Canceled indicates that the caller canceled the request
+	Canceled
+	// DeadlineExceeded indicates that the operation did not complete in time
+	DeadlineExceeded
+	// Unimplemented indicates that the operation is not supported
+	Unimplemented
+	// Unavailable indicates that the service or one of its dependencies is temporarily unavailable
+	Unavailable
+	// RequestTooLarge indicates that the request body exceeds the size the service will accept
+	RequestTooLarge
+	// UnsupportedMediaType indicates that the request body is in a format or encoding the service does not accept
+	UnsupportedMediaType
+)
+
+// statusClientClosedRequest is the non-standard HTTP status used when a client cancels a request
+const statusClientClosedRequest = 499
+
+// kindProperties contains the name, HTTP status and gRPC code of each Kind
+var kindProperties = map[Kind]struct {
+	name       string
+	httpStatus int
+	grpcCode   codes.Code
+}{
+	Internal:             {"internal", http.StatusInternalServerError, codes.Internal},
+	InvalidArgument:      {"invalid_argument", http.StatusBadRequest, codes.InvalidArgument},
+	NotFound:             {"not_found", http.StatusNotFound, codes.NotFound},
+	AlreadyExists:        {"already_exists", http.StatusConflict, codes.AlreadyExists},
+	FailedPrecondition:   {"failed_precondition", http.StatusBadRequest, codes.FailedPrecondition},
+	Unauthenticated:      {"unauthenticated", http.StatusUnauthorized, codes.Unauthenticated},
+	PermissionDenied:     {"permission_denied", http.StatusForbidden, codes.PermissionDenied},
+	ResourceExhausted:    {"resource_exhausted", http.StatusTooManyRequests, codes.ResourceExhausted},
+	Canceled:             {"canceled", statusClientClosedRequest, codes.Canceled},
+	DeadlineExceeded:     {"deadline_exceeded", http.StatusGatewayTimeout, codes.DeadlineExceeded},
+	Unimplemented:        {"unimplemented", http.StatusNotImplemented, codes.Unimplemented},
+	Unavailable:          {"unavailable", http.StatusServiceUnavailable, codes.Unavailable},
+	RequestTooLarge:      {"request_too_large", http.StatusRequestEntityTooLarge, codes.ResourceExhausted},
+	UnsupportedMediaType: {"unsupported_media_type", http.StatusUnsupportedMediaType, codes.InvalidArgument},
+}
+
+// String returns the snake case name of the Kind
+func (k Kind) String() string {
+	if properties, ok := kindProperties[k]; ok {
+		return properties.name
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// HTTPStatus returns the HTTP status code for the Kind. Unknown kinds are treated as Internal.
+func (k Kind) HTTPStatus() int {
+	if properties, ok := kindProperties[k]; ok {
+		return properties.httpStatus
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode returns the gRPC status code for the Kind. Unknown kinds are treated as Internal.
+func (k Kind) GRPCCode() codes.Code {
+	if properties, ok := kindProperties[k]; ok {
+		return properties.grpcCode
+	}
+	return codes.Internal
+}
+
+// ServerError returns true if the Kind indicates a failure of the service rather than of the
+// request, i.e. if it maps to a 5xx HTTP status. Only server errors are reported to Sentry.
+func (k Kind) ServerError() bool {
+	return k.HTTPStatus() >= http.StatusInternalServerError
+}
+
+// InvalidParam describes a single request parameter which failed validation
+type InvalidParam struct {
+	Name   string `json:"name"`   // The name of the parameter
+	Reason string `json:"reason"` // A human-readable reason the parameter is invalid
+}
+
+// Error is an application error. The Message and InvalidParams are returned to clients, while the
+// Cause and Fields are only ever logged.
+type Error struct {
+	Cause         error          // The internal cause of the error, if any. Never returned to clients.
+	Code          string         // A stable, machine-readable code for the error, e.g. `reservation_not_found`
+	Message       string         // A human-readable message which is safe to return to clients
+	Fields        []zap.Field    // Additional fields to log alongside the error
+	InvalidParams []InvalidParam // The request parameters which failed validation, if any
+	Kind          Kind           // The kind of the error, determining its HTTP status and gRPC code
+}
+
+// New creates an Error of the given kind with a code and public message
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Wrap creates an Error of the given kind with a code and public message caused by err
+func Wrap(err error, kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Cause: err}
+}
+
+// Error returns the public message of the error followed by its cause, if any
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+// Unwrap returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// WithFields returns a copy of the error with the given log fields added
+func (e *Error) WithFields(fields ...zap.Field) *Error {
+	clone := *e
+	clone.Fields = append(append(make([]zap.Field, 0, len(e.Fields)+len(fields)), e.Fields...), fields...)
+	return &clone
+}
+
+// From returns the first Error in the chain of err. Context cancellation and deadline errors are
+// converted to Canceled and DeadlineExceeded errors respectively, and any other error is wrapped
+// in an Internal error with a generic message so that internal details are not exposed to clients.
+// Nil is returned if err is nil.
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	switch {
+	case stderrors.As(err, &e):
+		return e
+	case stderrors.Is(err, context.Canceled):
+		return Wrap(err, Canceled, "canceled", "the request was canceled")
+	case stderrors.Is(err, context.DeadlineExceeded):
+		return Wrap(err, DeadlineExceeded, "deadline_exceeded", "the request did not complete in time")
+	default:
+		return Wrap(err, Internal, "internal", "an internal error occurred")
+	}
+}
+
+// Log logs the given error with its kind, code, cause and fields using the logger on the context.
+// Server errors are logged at error level, and are therefore reported to Sentry when the
+// sentry.Core is in use. Unauthenticated and PermissionDenied errors are logged at debug level so
+// that clients sending bad credentials cannot flood the logs, and all other errors are logged at
+// info level. The fields are only added to this entry, as the logger on ctx cannot be replaced
+// for the caller; use NewLogContext to attach them to the logger of subsequent log lines.
+func Log(ctx context.Context, err error) {
+	e := From(err)
+	if e == nil {
+		return
+	}
+	fields := make([]zap.Field, 0, len(e.Fields)+3)
+	if e.Cause != nil {
+		fields = append(fields, zap.Error(e.Cause))
+	}
+	fields = append(fields, e.logFields()...)
+	switch {
+	case e.Kind.ServerError():
+		log.Get(ctx).Error(e.Message, fields...)
+	case e.Kind == Unauthenticated || e.Kind == PermissionDenied:
+		log.Get(ctx).Debug(e.Message, fields...)
+	default:
+		log.Get(ctx).Info(e.Message, fields...)
+	}
+}
+
+// NewLogContext returns a copy of ctx whose logger, as returned by log.Get, carries the kind, code
+// and fields of the given error, so that they are included in every later log line of the request
+// which uses the returned context. The cause is not attached. If err is nil, ctx is returned.
+func NewLogContext(ctx context.Context, err error) context.Context {
+	e := From(err)
+	if e == nil {
+		return ctx
+	}
+	return log.NewContext(ctx, log.Get(ctx).With(e.logFields()...))
+}
+
+// logFields returns the kind, code and fields of the error as log fields
+func (e *Error) logFields() []zap.Field {
+	fields := make([]zap.Field, 0, len(e.Fields)+2)
+	fields = append(fields, zap.String("error_kind", e.Kind.String()), zap.String("error_code", e.Code))
+	return append(fields, e.Fields...)
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/spothero/tools/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/codes"
+)
+
+func TestKind(t *testing.T) {
+	tests := []struct {
+		name               string
+		kind               Kind
+		expectedName       string
+		expectedHTTPStatus int
+		expectedGRPCCode   codes.Code
+		expectedServer     bool
+	}{
+		{"internal errors are server errors", Internal, "internal", http.StatusInternalServerError, codes.Internal, true},
+		{"invalid arguments are client errors", InvalidArgument, "invalid_argument", http.StatusBadRequest, codes.InvalidArgument, false},
+		{"not found errors are client errors", NotFound, "not_found", http.StatusNotFound, codes.NotFound, false},
+		{"unauthenticated errors are client errors", Unauthenticated, "unauthenticated", http.StatusUnauthorized, codes.Unauthenticated, false},
+		{"permission denied errors are client errors", PermissionDenied, "permission_denied", http.StatusForbidden, codes.PermissionDenied, false},
+		{"canceled errors are client errors", Canceled, "canceled", 499, codes.Canceled, false},
+		{"unavailable errors are server errors", Unavailable, "unavailable", http.StatusServiceUnavailable, codes.Unavailable, true},
+		{"request too large errors are client errors", RequestTooLarge, "request_too_large", http.StatusRequestEntityTooLarge, codes.ResourceExhausted, false},
+		{"unsupported media type errors are client errors", UnsupportedMediaType, "unsupported_media_type", http.StatusUnsupportedMediaType, codes.InvalidArgument, false},
+		{"unknown kinds are treated as internal", Kind(100), "kind(100)", http.StatusInternalServerError, codes.Internal, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectedName, test.kind.String())
+			assert.Equal(t, test.expectedHTTPStatus, test.kind.HTTPStatus())
+			assert.Equal(t, test.expectedGRPCCode, test.kind.GRPCCode())
+			assert.Equal(t, test.expectedServer, test.kind.ServerError())
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	cause := fmt.Errorf("sql: no rows in result set")
+	err := Wrap(cause, NotFound, "reservation_not_found", "reservation not found")
+	assert.EqualError(t, err, "reservation not found: sql: no rows in result set")
+	assert.True(t, stderrors.Is(err, cause))
+	assert.EqualError(t, New(NotFound, "reservation_not_found", "reservation not found"), "reservation not found")
+
+	withFields := err.WithFields(zap.Int("reservation_id", 1))
+	assert.Len(t, withFields.Fields, 1)
+	assert.Empty(t, err.Fields)
+}
+
+func TestFrom(t *testing.T) {
+	appErr := New(NotFound, "reservation_not_found", "reservation not found")
+	tests := []struct {
+		err          error
+		name         string
+		expectedKind Kind
+		expectedCode string
+	}{
+		{
+			name:         "errors are found in the chain",
+			err:          fmt.Errorf("loading reservation: %w", appErr),
+			expectedKind: NotFound,
+			expectedCode: "reservation_not_found",
+		}, {
+			name:         "context cancellation is converted to a canceled error",
+			err:          fmt.Errorf("query failed: %w", context.Canceled),
+			expectedKind: Canceled,
+			expectedCode: "canceled",
+		}, {
+			name:         "context deadlines are converted to a deadline exceeded error",
+			err:          context.DeadlineExceeded,
+			expectedKind: DeadlineExceeded,
+			expectedCode: "deadline_exceeded",
+		}, {
+			name:         "other errors are converted to internal errors",
+			err:          fmt.Errorf("connection refused"),
+			expectedKind: Internal,
+			expectedCode: "internal",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := From(test.err)
+			assert.Equal(t, test.expectedKind, e.Kind)
+			assert.Equal(t, test.expectedCode, e.Code)
+			assert.NotContains(t, e.Message, "connection refused")
+		})
+	}
+	assert.Nil(t, From(nil))
+}
+
+func TestLog(t *testing.T) {
+	tests := []struct {
+		err           error
+		name          string
+		expectedLevel zapcore.Level
+	}{
+		{
+			name:          "client errors are logged at info level",
+			err:           New(InvalidArgument, "invalid_zip", "invalid zip code").WithFields(zap.String("zip", "abc")),
+			expectedLevel: zapcore.InfoLevel,
+		}, {
+			name:          "authentication errors are logged at debug level",
+			err:           New(Unauthenticated, "invalid_token", "invalid token").WithFields(zap.String("zip", "abc")),
+			expectedLevel: zapcore.DebugLevel,
+		}, {
+			name:          "authorization errors are logged at debug level",
+			err:           New(PermissionDenied, "insufficient_scope", "insufficient scope").WithFields(zap.String("zip", "abc")),
+			expectedLevel: zapcore.DebugLevel,
+		}, {
+			name:          "server errors are logged at error level",
+			err:           Wrap(fmt.Errorf("connection refused"), Unavailable, "db_unavailable", "try again later").WithFields(zap.String("zip", "abc")),
+			expectedLevel: zapcore.ErrorLevel,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			ctx := log.NewContext(context.Background(), zap.New(core))
+			Log(ctx, test.err)
+			entries := logs.All()
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, test.expectedLevel, entries[0].Level)
+				assert.Equal(t, "abc", entries[0].ContextMap()["zip"])
+				assert.Equal(t, From(test.err).Code, entries[0].ContextMap()["error_code"])
+			}
+		})
+	}
+}
+
+func TestNewLogContext(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	ctx := log.NewContext(context.Background(), zap.New(core))
+	err := Wrap(fmt.Errorf("connection refused"), Unavailable, "db_unavailable", "try again later").WithFields(zap.String("zip", "abc"))
+	errCtx := NewLogContext(ctx, err)
+	log.Get(errCtx).Info("retrying")
+	entries := logs.All()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, map[string]interface{}{
+			"error_kind": Unavailable.String(),
+			"error_code": "db_unavailable",
+			"zip":        "abc",
+		}, entries[0].ContextMap())
+	}
+	assert.Equal(t, ctx, NewLogContext(ctx, nil))
+}
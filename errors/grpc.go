@@ -0,0 +1,78 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// GRPCStatus returns the gRPC status for the error, with the code of its Kind and its public
+// message. The error code is attached as the reason of an `ErrorInfo` detail, and any invalid
+// parameters as the field violations of a `BadRequest` detail. GRPCStatus allows an Error to be
+// returned directly from gRPC handlers.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Kind.GRPCCode(), e.Message)
+	var details []protoadapt.MessageV1
+	if e.Code != "" {
+		details = append(details, &errdetails.ErrorInfo{Reason: e.Code})
+	}
+	if len(e.InvalidParams) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, param := range e.InvalidParams {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       param.Name,
+				Description: param.Reason,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	if len(details) == 0 {
+		return st
+	}
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// UnaryServerInterceptor logs any Error returned by the handler with Log and converts it to a
+// gRPC status. Other errors are returned unchanged.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	return resp, toStatusError(ctx, err)
+}
+
+// StreamServerInterceptor logs any Error returned by the handler with Log and converts it to a
+// gRPC status. Other errors are returned unchanged.
+func StreamServerInterceptor(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return toStatusError(stream.Context(), handler(srv, stream))
+}
+
+// toStatusError logs and converts the first Error in the chain of err to a gRPC status error
+func toStatusError(ctx context.Context, err error) error {
+	var e *Error
+	if !stderrors.As(err, &e) {
+		return err
+	}
+	Log(ctx, e)
+	return e.GRPCStatus().Err()
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mockServerStream is a grpc.ServerStream which only provides a context
+type mockServerStream struct {
+	grpc.ServerStream
+}
+
+func (mockServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestGRPCStatus(t *testing.T) {
+	st := Wrap(fmt.Errorf("sql: no rows in result set"), NotFound, "reservation_not_found", "reservation not found").GRPCStatus()
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "reservation not found", st.Message())
+	require.Len(t, st.Details(), 1)
+	assert.Equal(t, "reservation_not_found", st.Details()[0].(*errdetails.ErrorInfo).Reason)
+
+	assert.Empty(t, New(Internal, "", "an internal error occurred").GRPCStatus().Details())
+}
+
+func TestGRPCStatusInvalidParams(t *testing.T) {
+	err := New(InvalidArgument, "invalid_parameters", "one or more request parameters are invalid")
+	err.InvalidParams = []InvalidParam{{Name: "limit", Reason: "must be an integer"}}
+	st := err.GRPCStatus()
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 2)
+	assert.Equal(t, "invalid_parameters", st.Details()[0].(*errdetails.ErrorInfo).Reason)
+	violations := st.Details()[1].(*errdetails.BadRequest).FieldViolations
+	require.Len(t, violations, 1)
+	assert.Equal(t, "limit", violations[0].Field)
+	assert.Equal(t, "must be an integer", violations[0].Description)
+}
+
+func TestServerInterceptors(t *testing.T) {
+	tests := []struct {
+		err             error
+		name            string
+		expectedCode    codes.Code
+		expectedMessage string
+	}{
+		{
+			name:            "errors are converted to statuses",
+			err:             fmt.Errorf("loading reservation: %w", New(NotFound, "reservation_not_found", "reservation not found")),
+			expectedCode:    codes.NotFound,
+			expectedMessage: "reservation not found",
+		}, {
+			name:            "status errors are returned unchanged",
+			err:             status.Error(codes.Unauthenticated, "bearer token is invalid"),
+			expectedCode:    codes.Unauthenticated,
+			expectedMessage: "bearer token is invalid",
+		}, {
+			name:            "other errors are returned unchanged",
+			err:             fmt.Errorf("connection refused"),
+			expectedCode:    codes.Unknown,
+			expectedMessage: "connection refused",
+		}, {
+			name:         "successful calls are unaffected",
+			expectedCode: codes.OK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := UnaryServerInterceptor(
+				context.Background(),
+				"request",
+				&grpc.UnaryServerInfo{},
+				func(_ context.Context, _ interface{}) (interface{}, error) { return "response", test.err },
+			)
+			assert.Equal(t, "response", resp)
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			assert.Equal(t, test.expectedMessage, status.Convert(err).Message())
+
+			err = StreamServerInterceptor(
+				nil,
+				mockServerStream{},
+				&grpc.StreamServerInfo{},
+				func(_ interface{}, _ grpc.ServerStream) error { return test.err },
+			)
+			assert.Equal(t, test.expectedCode, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ProblemContentType is the content type of RFC 7807 problem details responses
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object. The application error code is included as the
+// `code` extension member, and any parameters which failed validation as the `invalid-params`
+// extension member.
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Code          string         `json:"code,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+	Status        int            `json:"status"`
+}
+
+// Problem returns the problem details for the error. The Detail is the public message of the
+// error and any invalid parameters are listed; the cause and fields are never included.
+func (e *Error) Problem() Problem {
+	status := e.Kind.HTTPStatus()
+	title := http.StatusText(status)
+	if status == statusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+	return Problem{
+		Type:          "about:blank",
+		Title:         title,
+		Status:        status,
+		Detail:        e.Message,
+		Code:          e.Code,
+		InvalidParams: e.InvalidParams,
+	}
+}
+
+// WriteHTTP logs the given error with Log and writes it to the response as an
+// `application/problem+json` document with the status of its Kind. Errors which are not an Error
+// are converted with From, so that only a generic message is returned for unexpected errors.
+func WriteHTTP(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+	if e == nil {
+		e = New(Internal, "internal", "an internal error occurred")
+	}
+	Log(r.Context(), e)
+	problem := e.Problem()
+	problem.Instance = r.URL.Path
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHTTP(t *testing.T) {
+	tests := []struct {
+		err      error
+		name     string
+		expected Problem
+	}{
+		{
+			name: "errors are written as problem details",
+			err:  Wrap(fmt.Errorf("sql: no rows in result set"), NotFound, "reservation_not_found", "reservation not found"),
+			expected: Problem{
+				Type:     "about:blank",
+				Title:    "Not Found",
+				Status:   http.StatusNotFound,
+				Detail:   "reservation not found",
+				Instance: "/reservations/1",
+				Code:     "reservation_not_found",
+			},
+		}, {
+			name: "invalid parameters are listed",
+			err: &Error{
+				Kind:          InvalidArgument,
+				Code:          "invalid_parameters",
+				Message:       "one or more request parameters are invalid",
+				InvalidParams: []InvalidParam{{Name: "limit", Reason: "must be an integer"}},
+			},
+			expected: Problem{
+				Type:          "about:blank",
+				Title:         "Bad Request",
+				Status:        http.StatusBadRequest,
+				Detail:        "one or more request parameters are invalid",
+				Instance:      "/reservations/1",
+				Code:          "invalid_parameters",
+				InvalidParams: []InvalidParam{{Name: "limit", Reason: "must be an integer"}},
+			},
+		}, {
+			name: "unexpected errors do not expose internal details",
+			err:  fmt.Errorf("dial tcp 10.0.0.1:5432: connection refused"),
+			expected: Problem{
+				Type:     "about:blank",
+				Title:    "Internal Server Error",
+				Status:   http.StatusInternalServerError,
+				Detail:   "an internal error occurred",
+				Instance: "/reservations/1",
+				Code:     "internal",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			WriteHTTP(recorder, httptest.NewRequest(http.MethodGet, "/reservations/1", nil), test.err)
+			assert.Equal(t, test.expected.Status, recorder.Code)
+			assert.Equal(t, ProblemContentType, recorder.Header().Get("Content-Type"))
+			var problem Problem
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&problem))
+			assert.Equal(t, test.expected, problem)
+		})
+	}
+}
@@ -26,6 +26,15 @@ func (c *Config) RegisterFlags(flags *pflag.FlagSet) {
 	flags.StringVar(&c.Name, "grpc-server-name", c.Name, "The name of the GRPC Server. This will be emitted in components such as logs and tracing.")
 	flags.StringVar(&c.Address, "grpc-address", c.Address, "GRPC Address for server")
 	flags.Uint16Var(&c.Port, "grpc-port", c.Port, "GRPC Port for server")
+	flags.BoolVar(&c.TLSEnabled, "grpc-tls-enabled", c.TLSEnabled, "Serve GRPC over TLS using the TLS certificate and key. Rotated certificates are reloaded without a restart.")
+	flags.StringVar(&c.TLSCrtPath, "grpc-tls-crt-path", c.TLSCrtPath, "Location of the GRPC Server TLS Certificate")
+	flags.StringVar(&c.TLSKeyPath, "grpc-tls-key-path", c.TLSKeyPath, "Location of the GRPC Server TLS Key")
+	flags.StringVar(&c.TLSClientCAPath, "grpc-tls-client-ca-path", c.TLSClientCAPath, "Location of the CA bundle used to verify GRPC client certificates. Unlike the certificate, it is not reloaded without a restart.")
+	flags.StringVar(&c.TLSClientAuth, "grpc-tls-client-auth", c.TLSClientAuth, "GRPC client certificate verification. One of `none`, `optional` or `require`. Defaults to none.")
+	flags.StringVar(&c.TLSMinVersion, "grpc-tls-min-version", c.TLSMinVersion, "Minimum TLS version accepted by the GRPC Server. One of 1.0, 1.1, 1.2 or 1.3. Defaults to 1.2.")
+	flags.StringSliceVar(&c.TLSCipherSuites, "grpc-tls-cipher-suites", c.TLSCipherSuites, "Comma-separated TLS 1.2 cipher suites accepted by the GRPC Server. Defaults to the Go defaults.")
+	flags.DurationVar(&c.ShutdownTimeout, "grpc-shutdown-timeout", c.ShutdownTimeout, "Maximum time to wait for in-flight GRPC requests on shutdown before forcibly stopping the server. 0 waits indefinitely.")
+	flags.DurationVar(&c.PreStopDelay, "grpc-pre-stop-delay", c.PreStopDelay, "Time to keep serving GRPC requests with a failing health check before closing listeners on shutdown")
 }
 
 // RegisterFlags registers gRPC client configuration flags with pflags. Callers must specify a
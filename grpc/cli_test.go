@@ -43,6 +43,42 @@ func TestRegisterFlags(t *testing.T) {
 	p, err := flags.GetUint16("grpc-port")
 	assert.NoError(t, err)
 	assert.Equal(t, c.Port, p)
+
+	st, err := flags.GetDuration("grpc-shutdown-timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, c.ShutdownTimeout, st)
+
+	psd, err := flags.GetDuration("grpc-pre-stop-delay")
+	assert.NoError(t, err)
+	assert.Equal(t, c.PreStopDelay, psd)
+
+	te, err := flags.GetBool("grpc-tls-enabled")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSEnabled, te)
+
+	tcp, err := flags.GetString("grpc-tls-crt-path")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSCrtPath, tcp)
+
+	tkp, err := flags.GetString("grpc-tls-key-path")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSKeyPath, tkp)
+
+	tccp, err := flags.GetString("grpc-tls-client-ca-path")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSClientCAPath, tccp)
+
+	tca, err := flags.GetString("grpc-tls-client-auth")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSClientAuth, tca)
+
+	tmv, err := flags.GetString("grpc-tls-min-version")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSMinVersion, tmv)
+
+	tcs, err := flags.GetStringSlice("grpc-tls-cipher-suites")
+	assert.NoError(t, err)
+	assert.Empty(t, tcs)
 }
 
 func TestClientRegisterFlags(t *testing.T) {
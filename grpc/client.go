@@ -26,6 +26,7 @@ import (
 	grpcprom "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/spothero/tools/jose"
 	"github.com/spothero/tools/log"
+	"github.com/spothero/tools/requestid"
 	"github.com/spothero/tools/tracing"
 	otelgrpc "go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
@@ -71,12 +72,14 @@ func defaultClientConfig(ctx context.Context) ClientConfig {
 		UnaryInterceptors: []grpc.UnaryClientInterceptor{
 			otelgrpc.UnaryClientInterceptor(), //nolint:staticcheck
 			tracing.UnaryClientInterceptor,
+			requestid.UnaryClientInterceptor,
 			grpczap.UnaryClientInterceptor(log.Get(ctx)),
 			grpcprom.UnaryClientInterceptor,
 		},
 		StreamInterceptors: []grpc.StreamClientInterceptor{
 			otelgrpc.StreamClientInterceptor(), //nolint:staticcheck
 			tracing.StreamClientInterceptor,
+			requestid.StreamClientInterceptor,
 			grpczap.StreamClientInterceptor(log.Get(ctx)),
 			grpcprom.StreamClientInterceptor,
 		},
@@ -19,13 +19,21 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spothero/tools/health"
 	"github.com/spothero/tools/log"
+	shTLS "github.com/spothero/tools/tls"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const maxMessageSizeBytes = 20000000 // This is 20mb
@@ -33,25 +41,40 @@ const maxMessageSizeBytes = 20000000 // This is 20mb
 // Config contains the configuration necessary for running a GRPC Server.
 type Config struct {
 	ServerRegistration func(*grpc.Server)             // Callback for registering GRPC API Servers
+	Health             *health.Registry               // If set, the standard GRPC health service is registered and fed by this registry
+	Listener           net.Listener                   // If set, connections are accepted on this listener instead of Address and Port
+	Registry           prometheus.Registerer          // The Prometheus Registry with which server metrics are registered. If nil, the global registry is used.
 	Name               string                         // Name of the GRPC Server
 	Address            string                         // Address on which the server will be accessible
 	TLSCrtPath         string                         // Location of TLS Certificate
 	TLSKeyPath         string                         // Location of TLS Key
+	TLSClientCAPath    string                         // Location of the CA bundle used to verify client certificates
+	TLSClientAuth      string                         // Client certificate verification mode, one of none, optional or require
+	TLSMinVersion      string                         // Minimum TLS version, one of 1.0, 1.1, 1.2 or 1.3
+	TLSCipherSuites    []string                       // Cipher suites enabled for TLS 1.2 and below
 	StreamInterceptors []grpc.StreamServerInterceptor // A list of global GRPC stream interceptor functions to be called. Order is honored left to right.
 	UnaryInterceptors  []grpc.UnaryServerInterceptor  // A list of global GRPC unary interceptor functions to be called. Order is honored left to right.
 	CancelSignals      []os.Signal                    // OS Signals to be used to cancel running servers. Defaults to SIGINT/`os.Interrupt`.
 	Port               uint16                         // Port on which the server will be accessible
 	TLSEnabled         bool                           // Whether or not traffic should be served via HTTPS
+	ShutdownTimeout    time.Duration                  // Maximum time to wait for in-flight RPCs on shutdown before forcibly stopping. 0 waits indefinitely.
+	PreStopDelay       time.Duration                  // Time to keep serving with a failing health check before closing listeners on shutdown
 }
 
 // Server contains the configured GRPC server and related components
 type Server struct {
-	server        *grpc.Server // The GRPC Server
-	listenAddress string       // The address the server should bind to
-	tlsCrtPath    string       // Location of TLS Certificate
-	tlsKeyPath    string       // Location of TLS Key
-	cancelSignals []os.Signal  // OS Signals to be used to cancel running servers. Defaults to SIGINT/`os.Interrupt`.
-	tlsEnabled    bool         // Whether or not traffic should be served via HTTPS
+	server           *grpc.Server             // The GRPC Server
+	health           *health.Registry         // The health registry to drain on shutdown, if any
+	listener         net.Listener             // The listener to serve on, if provided instead of listenAddress
+	shutdownDuration *prometheus.HistogramVec // Duration of each phase of shutdown
+	handlerRPCs      *handlerRPCs             // RPCs in progress which are served through ServeHTTP
+	serverTLS        *serverTLS               // TLS configuration used by the server credentials, if TLS is enabled
+	listenAddress    string                   // The address the server should bind to
+	tls              shTLS.Config             // TLS certificate and client verification configuration
+	cancelSignals    []os.Signal              // OS Signals to be used to cancel running servers. Defaults to SIGINT/`os.Interrupt`.
+	shutdownTimeout  time.Duration            // Maximum time to wait for in-flight RPCs on shutdown
+	preStopDelay     time.Duration            // Time to keep serving with a failing health check on shutdown
+	tlsEnabled       bool                     // Whether or not traffic should be served via HTTPS
 }
 
 // NewDefaultConfig returns a default GRPC server config object. The caller must still supply the
@@ -66,12 +89,16 @@ func NewDefaultConfig(name string, serverRegistration func(*grpc.Server)) Config
 		StreamInterceptors: []grpc.StreamServerInterceptor{},
 		UnaryInterceptors:  []grpc.UnaryServerInterceptor{},
 		CancelSignals:      []os.Signal{os.Interrupt},
+		ShutdownTimeout:    30 * time.Second,
 	}
 }
 
 // NewServer creates and returns a configured Server object given a GRPC configuration object.
+// If TLS is enabled, the server is created with TLS transport credentials, which negotiate HTTP/2
+// with ALPN and expose the certificates of clients to handlers through peer.FromContext. The
+// certificate and key are loaded when the server is run.
 func (c Config) NewServer() Server {
-	server := grpc.NewServer(
+	options := []grpc.ServerOption{
 		grpc.StreamInterceptor(
 			grpc_middleware.ChainStreamServer(
 				c.StreamInterceptors...,
@@ -84,50 +111,143 @@ func (c Config) NewServer() Server {
 		),
 		grpc.MaxRecvMsgSize(maxMessageSizeBytes),
 		grpc.MaxSendMsgSize(maxMessageSizeBytes),
-	)
+	}
+	var st *serverTLS
+	if c.TLSEnabled {
+		st = &serverTLS{}
+		options = append(options, grpc.Creds(credentials.NewTLS(&tls.Config{GetConfigForClient: st.getConfigForClient})))
+	}
+	server := grpc.NewServer(options...)
 	if c.ServerRegistration == nil {
 		panic("no server registration function provided")
 	}
 	c.ServerRegistration(server)
+	if c.Health != nil {
+		c.Health.RegisterGRPCHealthServer(server)
+	}
 	return Server{
-		server:        server,
-		listenAddress: fmt.Sprintf("%s:%d", c.Address, c.Port),
-		tlsEnabled:    c.TLSEnabled,
-		tlsCrtPath:    c.TLSCrtPath,
-		tlsKeyPath:    c.TLSKeyPath,
-		cancelSignals: c.CancelSignals,
+		server:           server,
+		health:           c.Health,
+		shutdownDuration: newShutdownDuration(c.Registry),
+		handlerRPCs:      &handlerRPCs{},
+		serverTLS:        st,
+		listener:         c.Listener,
+		listenAddress:    fmt.Sprintf("%s:%d", c.Address, c.Port),
+		tlsEnabled:       c.TLSEnabled,
+		cancelSignals:    c.CancelSignals,
+		shutdownTimeout:  c.ShutdownTimeout,
+		preStopDelay:     c.PreStopDelay,
+		tls: shTLS.Config{
+			CertPath:     c.TLSCrtPath,
+			KeyPath:      c.TLSKeyPath,
+			ClientCAPath: c.TLSClientCAPath,
+			ClientAuth:   c.TLSClientAuth,
+			MinVersion:   c.TLSMinVersion,
+			CipherSuites: c.TLSCipherSuites,
+		},
+	}
+}
+
+// newShutdownDuration creates the histogram used to time each phase of server shutdown and
+// registers it with the given Prometheus Registry, or the global Registry if none is given,
+// reusing the existing histogram if one has already been registered.
+func newShutdownDuration(registry prometheus.Registerer) *prometheus.HistogramVec {
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+	shutdownDuration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_server_shutdown_phase_duration_seconds",
+			Help:    "Amount of time spent in each phase of GRPC server shutdown",
+			Buckets: []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120},
+		},
+		[]string{"phase"},
+	)
+	return registerCollector(registry, shutdownDuration).(*prometheus.HistogramVec)
+}
+
+// registerCollector registers the given collector, returning the existing collector if an
+// identical one has already been registered
+func registerCollector(registry prometheus.Registerer, collector prometheus.Collector) prometheus.Collector {
+	if err := registry.Register(collector); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		// metric has been registered before so use existing metric
+		return are.ExistingCollector
 	}
+	return collector
+}
+
+// ServeHTTP implements http.Handler, allowing the GRPC server to be served by an HTTP/2 server
+// instead of its own listener, for example to serve gRPC and HTTP on a single port. Servers used
+// in this way should not also be started with Run or RunContext, and must instead be stopped with
+// Shutdown when the HTTP server shuts down. RPCs which arrive once Shutdown has been called are
+// rejected with a 503 status, which clients treat as UNAVAILABLE.
+func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.handlerRPCs.start() {
+		http.Error(w, "grpc server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.handlerRPCs.done()
+	s.server.ServeHTTP(w, r)
+}
+
+// Shutdown gracefully stops a server which is served through ServeHTTP, waiting up to the shutdown
+// timeout for in-flight RPCs to complete before forcibly stopping the server. The pre-stop delay is
+// not observed, since the HTTP server serving the RPCs is expected to have done so already.
+func (s Server) Shutdown(ctx context.Context) {
+	s.stop(ctx)
+}
+
+// GetServiceInfo returns the services and methods registered with the GRPC server, allowing them
+// to be listed in the route inventory of the HTTP server
+func (s Server) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return s.server.GetServiceInfo()
 }
 
 // Run starts the GRPC server. The function returns an error if the GRPC server cannot bind to its
 // listen address. This function is non-blocking and will return immediately. If no error is returned
 // the server is running. The returned channel will be closed after the server shuts down.
 func (s Server) Run() (chan bool, error) {
-	ctx := context.Background()
-	var listener net.Listener
-	var err error
+	return s.RunContext(context.Background())
+}
+
+// RunContext behaves like Run, but additionally stops the server when the given context is
+// cancelled. This allows the server to be shut down programmatically, for example when a
+// service component fails.
+//
+// If TLS is enabled, the certificate and key are reloaded whenever they change on disk until the
+// server shuts down. A provided Listener should accept plain connections, as the TLS handshake
+// is performed by the transport credentials of the server.
+func (s Server) RunContext(ctx context.Context) (chan bool, error) {
+	// Certificates are watched until the server has shut down
+	watchCtx, stopWatching := context.WithCancel(ctx)
 	if s.tlsEnabled {
-		cert, certErr := tls.LoadX509KeyPair(s.tlsCrtPath, s.tlsKeyPath)
-		if certErr != nil {
-			return nil, fmt.Errorf("failed to load tls x509 key pair: %w", certErr)
+		if s.serverTLS == nil {
+			stopWatching()
+			return nil, fmt.Errorf("grpc server tls is enabled but the server was not created with tls credentials")
 		}
-		listener, err = tls.Listen(
-			"tcp",
-			s.listenAddress,
-			&tls.Config{Certificates: []tls.Certificate{cert}},
-		)
+		tlsConfig, err := s.tls.NewTLSConfig(watchCtx)
 		if err != nil {
-			return nil, fmt.Errorf("error starting tls grpc server listener: %w", err)
+			stopWatching()
+			return nil, fmt.Errorf("failed to configure grpc server tls: %w", err)
 		}
-	} else {
+		s.serverTLS.store(tlsConfig)
+	}
+	listener := s.listener
+	if listener == nil {
+		var err error
 		listener, err = net.Listen("tcp", s.listenAddress)
 		if err != nil {
+			stopWatching()
 			return nil, fmt.Errorf("error starting grpc server listener: %w", err)
 		}
 	}
 	go func() {
-		log.Get(ctx).Info(fmt.Sprintf("grpc server started on %s", s.listenAddress))
-		err = s.server.Serve(listener)
+		log.Get(ctx).Info(fmt.Sprintf("grpc server started on %s", listener.Addr()))
+		err := s.server.Serve(listener)
 		if err != nil {
 			log.Get(ctx).Error("error encountered in grpc server", zap.Error(err))
 		} else {
@@ -135,15 +255,171 @@ func (s Server) Run() (chan bool, error) {
 		}
 	}()
 
-	// Capture cancellation signal and gracefully shutdown goroutines
+	// Capture cancellation signal or context cancellation and gracefully shutdown goroutines
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, s.cancelSignals...)
 	done := make(chan bool)
 	go func() {
-		<-signals
-		log.Get(ctx).Info("received interrupt, shutting down grpc server")
-		s.server.GracefulStop()
+		defer signal.Stop(signals)
+		select {
+		case <-signals:
+			log.Get(ctx).Info("received interrupt, shutting down grpc server")
+		case <-ctx.Done():
+			log.Get(ctx).Info("context cancelled, shutting down grpc server")
+		}
+		s.shutdown(context.WithoutCancel(ctx))
+		stopWatching()
 		close(done)
 	}()
 	return done, nil
 }
+
+// shutdown gracefully stops the server. The health registry is first marked as draining so that
+// health checks report NOT_SERVING, and the server continues to accept RPCs for the pre-stop
+// delay so that clients and load balancers can observe the change. Listeners are then closed and
+// in-flight RPCs are given up to the shutdown timeout to complete, after which the server is
+// forcibly stopped. A shutdown timeout of zero waits indefinitely.
+func (s Server) shutdown(ctx context.Context) {
+	if s.health != nil {
+		s.health.Drain()
+	}
+	if s.preStopDelay > 0 {
+		log.Get(ctx).Info("grpc server draining, waiting for pre-stop delay", zap.Duration("pre_stop_delay", s.preStopDelay))
+		start := time.Now()
+		time.Sleep(s.preStopDelay)
+		s.observeShutdownPhase(ctx, "pre_stop", start)
+	}
+	s.stop(ctx)
+}
+
+// stop gracefully stops the server, forcibly stopping it if in-flight RPCs do not complete within
+// the shutdown timeout. RPCs served through ServeHTTP which still have not returned after a
+// further shutdown timeout are abandoned.
+func (s Server) stop(ctx context.Context) {
+	start := time.Now()
+	stopped := make(chan struct{})
+	go func() {
+		// RPCs served through ServeHTTP must complete before the server is gracefully stopped, as
+		// the GRPC server cannot drain them itself
+		<-s.handlerRPCs.drain()
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	var deadline <-chan time.Time
+	if s.shutdownTimeout > 0 {
+		timer := time.NewTimer(s.shutdownTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	select {
+	case <-stopped:
+		s.observeShutdownPhase(ctx, "drain", start)
+		return
+	case <-deadline:
+		s.observeShutdownPhase(ctx, "drain", start)
+	}
+	log.Get(ctx).Error("grpc server did not drain before the shutdown timeout, forcing stop", zap.Duration("shutdown_timeout", s.shutdownTimeout))
+	start = time.Now()
+	// Stop cannot cancel RPCs served through ServeHTTP, and waits for them to return, so the
+	// forced stop is given up to another shutdown timeout before in-flight RPCs are abandoned
+	forceStopped := make(chan struct{})
+	go func() {
+		s.server.Stop()
+		close(forceStopped)
+	}()
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-forceStopped:
+	case <-timer.C:
+		log.Get(ctx).Error("grpc server did not stop before the shutdown timeout, abandoning in-flight rpcs", zap.Duration("shutdown_timeout", s.shutdownTimeout))
+	}
+	s.observeShutdownPhase(ctx, "force_stop", start)
+}
+
+// serverTLS holds the TLS configuration loaded when the server is run, which is used by the
+// transport credentials of the server for the handshake of each connection
+type serverTLS struct {
+	config atomic.Pointer[tls.Config]
+}
+
+// store sets the TLS configuration used for subsequent handshakes, advertising HTTP/2 with ALPN
+// as required by GRPC clients
+func (st *serverTLS) store(config *tls.Config) {
+	config = config.Clone()
+	config.NextProtos = []string{"h2"}
+	st.config.Store(config)
+}
+
+// getConfigForClient returns the TLS configuration for a handshake
+func (st *serverTLS) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	config := st.config.Load()
+	if config == nil {
+		return nil, fmt.Errorf("grpc server tls is not configured")
+	}
+	return config, nil
+}
+
+// handlerRPCs tracks the RPCs served through ServeHTTP so that they can be drained on shutdown
+type handlerRPCs struct {
+	idle     chan struct{}
+	mutex    sync.Mutex
+	active   int
+	draining bool
+}
+
+// start records the start of an RPC, returning false if the server is shutting down
+func (h *handlerRPCs) start() bool {
+	if h == nil {
+		return true
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.draining {
+		return false
+	}
+	h.active++
+	return true
+}
+
+// done records the completion of an RPC
+func (h *handlerRPCs) done() {
+	if h == nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.active--
+	if h.draining && h.active == 0 {
+		close(h.idle)
+	}
+}
+
+// drain stops new RPCs from starting and returns a channel which is closed once all in-flight
+// RPCs have completed
+func (h *handlerRPCs) drain() <-chan struct{} {
+	if h == nil {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.draining {
+		h.draining = true
+		h.idle = make(chan struct{})
+		if h.active == 0 {
+			close(h.idle)
+		}
+	}
+	return h.idle
+}
+
+// observeShutdownPhase logs and records the duration of a single phase of shutdown
+func (s Server) observeShutdownPhase(ctx context.Context, phase string, start time.Time) {
+	duration := time.Since(start)
+	log.Get(ctx).Info("grpc server shutdown phase complete", zap.String("phase", phase), zap.Duration("duration", duration))
+	if s.shutdownDuration != nil {
+		s.shutdownDuration.With(prometheus.Labels{"phase": phase}).Observe(duration.Seconds())
+	}
+}
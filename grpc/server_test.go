@@ -15,13 +15,31 @@
 package grpc
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net/http/httptest"
 	"os"
 	"syscall"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spothero/tools/health"
+	shTLS "github.com/spothero/tools/tls"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestNewDefaultConfig(t *testing.T) {
@@ -37,6 +55,7 @@ func TestNewDefaultConfig(t *testing.T) {
 		StreamInterceptors: []grpc.StreamServerInterceptor{},
 		UnaryInterceptors:  []grpc.UnaryServerInterceptor{},
 		CancelSignals:      []os.Signal{os.Interrupt},
+		ShutdownTimeout:    30 * time.Second,
 	}, config)
 }
 
@@ -54,6 +73,7 @@ func TestNewServer(t *testing.T) {
 		{
 			"the server object is properly configured when a registration function is provided",
 			Config{
+				Registry:           prometheus.NewRegistry(),
 				Name:               "test",
 				Address:            "127.0.0.1",
 				Port:               9111,
@@ -72,6 +92,8 @@ func TestNewServer(t *testing.T) {
 			} else {
 				server := test.config.NewServer()
 				assert.NotNil(t, server.server)
+				// the shutdown histogram is registered with the configured registry
+				assert.Same(t, server.shutdownDuration, newShutdownDuration(test.config.Registry))
 				assert.Equal(
 					t,
 					fmt.Sprintf("%s:%d", test.config.Address, test.config.Port),
@@ -82,6 +104,19 @@ func TestNewServer(t *testing.T) {
 	}
 }
 
+func TestNewServerHealth(t *testing.T) {
+	config := Config{
+		Name:               "test",
+		Address:            "127.0.0.1",
+		Port:               9111,
+		ServerRegistration: func(*grpc.Server) {},
+		Health:             health.NewRegistry(prometheus.NewRegistry()),
+	}
+	server := config.NewServer()
+	_, ok := server.GetServiceInfo()["grpc.health.v1.Health"]
+	assert.True(t, ok)
+}
+
 func TestRun(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -113,8 +148,8 @@ func TestRun(t *testing.T) {
 				listenAddress: "127.0.0.1:60123",
 				cancelSignals: []os.Signal{syscall.SIGUSR1},
 				tlsEnabled:    true,
-				tlsCrtPath:    "../testdata/does-not-exist-crt.pem",
-				tlsKeyPath:    "../testdata/fake-key.pem",
+				serverTLS:     &serverTLS{},
+				tls:           shTLS.Config{CertPath: "../testdata/does-not-exist-crt.pem", KeyPath: "../testdata/fake-key.pem"},
 			},
 			true,
 		},
@@ -125,8 +160,8 @@ func TestRun(t *testing.T) {
 				listenAddress: "127.0.0.1:-1",
 				cancelSignals: []os.Signal{syscall.SIGUSR1},
 				tlsEnabled:    true,
-				tlsCrtPath:    "testdata/fake-crt.pem",
-				tlsKeyPath:    "testdata/fake-key.pem",
+				serverTLS:     &serverTLS{},
+				tls:           shTLS.Config{CertPath: "testdata/fake-crt.pem", KeyPath: "testdata/fake-key.pem"},
 			},
 			true,
 		},
@@ -137,8 +172,8 @@ func TestRun(t *testing.T) {
 				listenAddress: "127.0.0.1:60123",
 				cancelSignals: []os.Signal{syscall.SIGUSR1},
 				tlsEnabled:    true,
-				tlsCrtPath:    "../testdata/fake-crt.pem",
-				tlsKeyPath:    "../testdata/fake-key.pem",
+				serverTLS:     &serverTLS{},
+				tls:           shTLS.Config{CertPath: "../testdata/fake-crt.pem", KeyPath: "../testdata/fake-key.pem"},
 			},
 			false,
 		},
@@ -156,3 +191,191 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRunTLS(t *testing.T) {
+	var authInfo credentials.AuthInfo
+	server := Config{
+		Address:            "127.0.0.1",
+		Port:               60127,
+		TLSEnabled:         true,
+		TLSCrtPath:         "../testdata/fake-crt.pem",
+		TLSKeyPath:         "../testdata/fake-key.pem",
+		ServerRegistration: func(*grpc.Server) {},
+		Health:             health.NewRegistry(prometheus.NewRegistry()),
+		Registry:           prometheus.NewRegistry(),
+		CancelSignals:      []os.Signal{syscall.SIGUSR1},
+		UnaryInterceptors: []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if p, ok := peer.FromContext(ctx); ok {
+					authInfo = p.AuthInfo
+				}
+				return handler(ctx, req)
+			},
+		},
+	}.NewServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := server.RunContext(ctx)
+	require.NoError(t, err)
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the test certificate is self-signed, so it is not verified
+	conn, err := grpc.Dial(
+		"127.0.0.1:60127",
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	require.IsType(t, credentials.TLSInfo{}, authInfo)
+	assert.Equal(t, "h2", authInfo.(credentials.TLSInfo).State.NegotiatedProtocol)
+}
+
+func TestRunContext(t *testing.T) {
+	server := Server{
+		server:        grpc.NewServer(),
+		listenAddress: "127.0.0.1:60124",
+		cancelSignals: []os.Signal{syscall.SIGUSR1},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := server.RunContext(ctx)
+	assert.NoError(t, err)
+	cancel()
+	<-done
+}
+
+func TestShutdown(t *testing.T) {
+	registry := health.NewRegistry(prometheus.NewRegistry())
+	grpcServer := grpc.NewServer()
+	registry.RegisterGRPCHealthServer(grpcServer)
+	shutdownDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test"}, []string{"phase"})
+	server := Server{
+		server:           grpcServer,
+		health:           registry,
+		shutdownDuration: shutdownDuration,
+		listenAddress:    "127.0.0.1:60125",
+		cancelSignals:    []os.Signal{syscall.SIGUSR1},
+		preStopDelay:     20 * time.Millisecond,
+		shutdownTimeout:  50 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := server.RunContext(ctx)
+	require.NoError(t, err)
+
+	// a health watch stream never completes on its own, so the server must be forcibly stopped
+	conn, err := grpc.Dial("127.0.0.1:60125", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	stream, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	cancel()
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+	<-done
+	_, err = stream.Recv()
+	assert.Error(t, err)
+	assert.Equal(t, 3, testutil.CollectAndCount(shutdownDuration))
+}
+
+// newWaitService returns a service with a unary RPC, /test.Wait/Wait, which closes started and
+// then blocks until release is closed, ignoring cancellation
+func newWaitService(started, release chan struct{}) grpc.ServiceDesc {
+	return grpc.ServiceDesc{
+		ServiceName: "test.Wait",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Wait",
+			Handler: func(_ interface{}, _ context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				if err := dec(&emptypb.Empty{}); err != nil {
+					return nil, err
+				}
+				close(started)
+				<-release
+				return &emptypb.Empty{}, nil
+			},
+		}},
+	}
+}
+
+func TestShutdownServeHTTP(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	waitService := newWaitService(started, release)
+	server := Config{
+		ServerRegistration: func(s *grpc.Server) { s.RegisterService(&waitService, struct{}{}) },
+		ShutdownTimeout:    time.Second,
+	}.NewServer()
+	httpServer := httptest.NewServer(h2c.NewHandler(server, &http2.Server{}))
+	defer httpServer.Close()
+	conn, err := grpc.Dial(httpServer.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	rpcErr := make(chan error, 1)
+	go func() {
+		rpcErr <- conn.Invoke(context.Background(), "/test.Wait/Wait", &emptypb.Empty{}, &emptypb.Empty{})
+	}()
+	<-started
+	stopped := make(chan struct{})
+	go func() {
+		server.Shutdown(context.Background())
+		close(stopped)
+	}()
+
+	// new RPCs are rejected while the in-flight RPC is drained
+	assert.Eventually(t, func() bool {
+		err := conn.Invoke(context.Background(), "/test.Wait/Wait", &emptypb.Empty{}, &emptypb.Empty{})
+		return status.Code(err) == codes.Unavailable
+	}, time.Second, 5*time.Millisecond)
+	select {
+	case <-stopped:
+		t.Fatal("the server stopped before the in-flight RPC completed")
+	default:
+	}
+	close(release)
+	assert.NoError(t, <-rpcErr)
+	<-stopped
+}
+
+func TestShutdownServeHTTPTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	waitService := newWaitService(started, release)
+	server := Config{
+		ServerRegistration: func(s *grpc.Server) { s.RegisterService(&waitService, struct{}{}) },
+		ShutdownTimeout:    50 * time.Millisecond,
+	}.NewServer()
+	httpServer := httptest.NewServer(h2c.NewHandler(server, &http2.Server{}))
+	defer httpServer.Close()
+	conn, err := grpc.Dial(httpServer.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	go func() {
+		_ = conn.Invoke(context.Background(), "/test.Wait/Wait", &emptypb.Empty{}, &emptypb.Empty{})
+	}()
+	<-started
+	// depending on the GRPC version, ServeHTTP may not return until the handler does, which is
+	// simulated by an RPC which never completes
+	require.True(t, server.handlerRPCs.start())
+	stopped := make(chan struct{})
+	go func() {
+		server.Shutdown(context.Background())
+		close(stopped)
+	}()
+
+	// the in-flight RPCs ignore cancellation, so they are abandoned after the forced stop times out
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the server did not stop after the shutdown timeout")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// SQLChecker returns a Checker which pings the given database, such as one returned by
+// sql.PostgresConfig.Connect or sql.MySQLConfig.Connect.
+func SQLChecker(db *sqlx.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if err := db.PingContext(ctx); err != nil {
+			return fmt.Errorf("failed to ping database: %w", err)
+		}
+		return nil
+	})
+}
+
+// KafkaChecker returns a Checker which fails if the given Kafka client has been closed or if
+// the Kafka cluster controller cannot be reached.
+func KafkaChecker(client sarama.Client) Checker {
+	return CheckerFunc(func(_ context.Context) error {
+		if client.Closed() {
+			return fmt.Errorf("kafka client is closed")
+		}
+		if _, err := client.Controller(); err != nil {
+			return fmt.Errorf("failed to reach kafka controller: %w", err)
+		}
+		return nil
+	})
+}
+
+// GRPCClientConnChecker returns a Checker which fails if the given gRPC client connection is
+// shut down or in a transient failure state. Idle connections are asked to reconnect and are
+// considered healthy.
+func GRPCClientConnChecker(conn *grpc.ClientConn) Checker {
+	return CheckerFunc(func(_ context.Context) error {
+		switch state := conn.GetState(); state {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("grpc connection to `%s` is in state %s", conn.Target(), state)
+		case connectivity.Idle:
+			conn.Connect()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/IBM/sarama"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestSQLChecker(t *testing.T) {
+	tests := []struct {
+		pingErr   error
+		name      string
+		expectErr bool
+	}{
+		{
+			name: "a successful ping passes",
+		}, {
+			name:      "a failed ping fails",
+			pingErr:   fmt.Errorf("connection refused"),
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			require.NoError(t, err)
+			defer db.Close()
+			mock.ExpectPing().WillReturnError(test.pingErr)
+			err = SQLChecker(sqlx.NewDb(db, "sqlmock")).Check(context.Background())
+			if test.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// mockKafkaClient overrides the subset of sarama.Client used by the KafkaChecker
+type mockKafkaClient struct {
+	sarama.Client
+	controllerErr error
+	closed        bool
+}
+
+func (m mockKafkaClient) Closed() bool {
+	return m.closed
+}
+
+func (m mockKafkaClient) Controller() (*sarama.Broker, error) {
+	return &sarama.Broker{}, m.controllerErr
+}
+
+func TestKafkaChecker(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    mockKafkaClient
+		expectErr bool
+	}{
+		{
+			name: "an open client with a reachable controller passes",
+		}, {
+			name:      "a closed client fails",
+			client:    mockKafkaClient{closed: true},
+			expectErr: true,
+		}, {
+			name:      "an unreachable controller fails",
+			client:    mockKafkaClient{controllerErr: fmt.Errorf("no controller")},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := KafkaChecker(test.client).Check(context.Background())
+			if test.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGRPCClientConnChecker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	checker := GRPCClientConnChecker(conn)
+	assert.NoError(t, checker.Check(context.Background()))
+	require.NoError(t, conn.Close())
+	assert.Error(t, checker.Check(context.Background()))
+}
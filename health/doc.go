@@ -0,0 +1,3 @@
+// Package health provides a registry of liveness and readiness checks for a service. Check results
+// are exposed over HTTP, through the standard gRPC health service, and as Prometheus gauges.
+package health
@@ -0,0 +1,86 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+)
+
+// checkResponse is the JSON representation of a single check Result
+type checkResponse struct {
+	LastChecked time.Time `json:"last_checked"`
+	Kind        string    `json:"kind"`
+	Status      Status    `json:"status"`
+	Latency     string    `json:"latency"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// reportResponse is the JSON representation of a Report
+type reportResponse struct {
+	Checks   map[string]checkResponse `json:"checks"`
+	Status   Status                   `json:"status"`
+	Draining bool                     `json:"draining,omitempty"`
+}
+
+// RegisterHandlers registers the `/health/live` and `/health/ready` endpoints with the given
+// router. Each endpoint evaluates the relevant checks and returns a JSON body describing the
+// status, latency and last error of each check. The response code is 200 if all checks pass
+// and 503 otherwise. Once the Registry is draining, `/health/ready` always returns 503.
+func (r *Registry) RegisterHandlers(router *mux.Router) {
+	router.HandleFunc("/health/live", r.LiveHandler)
+	router.HandleFunc("/health/ready", r.ReadyHandler)
+}
+
+// LiveHandler is an HTTP handler which evaluates all liveness checks
+func (r *Registry) LiveHandler(w http.ResponseWriter, req *http.Request) {
+	r.writeReport(w, req, Liveness)
+}
+
+// ReadyHandler is an HTTP handler which evaluates all readiness and liveness checks
+func (r *Registry) ReadyHandler(w http.ResponseWriter, req *http.Request) {
+	r.writeReport(w, req, Readiness)
+}
+
+// writeReport evaluates the checks of the given kind and writes the report as JSON
+func (r *Registry) writeReport(w http.ResponseWriter, req *http.Request, kind Kind) {
+	report := r.Check(req.Context(), kind)
+	body := reportResponse{
+		Status:   report.Status,
+		Draining: report.Draining,
+		Checks:   make(map[string]checkResponse, len(report.Checks)),
+	}
+	for name, result := range report.Checks {
+		body.Checks[name] = checkResponse{
+			Kind:        result.Kind.String(),
+			Status:      result.Status,
+			Latency:     result.Latency.String(),
+			LastError:   result.LastError,
+			LastChecked: result.LastChecked,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusPass {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Get(req.Context()).Error("failed to write health report", zap.Error(err))
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterHandlers(t *testing.T) {
+	r := NewRegistry(prometheus.NewRegistry())
+	r.Register("process", Liveness, CheckerFunc(passing))
+	r.Register("db", Readiness, CheckerFunc(failing))
+	router := mux.NewRouter()
+	r.RegisterHandlers(router)
+
+	tests := []struct {
+		expectedChecks map[string]Status
+		name           string
+		path           string
+		expectedStatus Status
+		expectedCode   int
+	}{
+		{
+			name:           "liveness only reports liveness checks",
+			path:           "/health/live",
+			expectedCode:   http.StatusOK,
+			expectedStatus: StatusPass,
+			expectedChecks: map[string]Status{"process": StatusPass},
+		}, {
+			name:           "readiness reports all checks and fails when any check fails",
+			path:           "/health/ready",
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: StatusFail,
+			expectedChecks: map[string]Status{"process": StatusPass, "db": StatusFail},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", test.path, nil)
+			require.NoError(t, err)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, test.expectedCode, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var body reportResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+			assert.Equal(t, test.expectedStatus, body.Status)
+			assert.Len(t, body.Checks, len(test.expectedChecks))
+			for name, status := range test.expectedChecks {
+				assert.Equal(t, status, body.Checks[name].Status)
+				assert.NotEmpty(t, body.Checks[name].Latency)
+				if status == StatusFail {
+					assert.Equal(t, "dependency unavailable", body.Checks[name].LastError)
+				}
+			}
+		})
+	}
+}
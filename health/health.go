@@ -0,0 +1,317 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// defaultTimeout is the amount of time a single check may take before it is considered failed
+const defaultTimeout = 5 * time.Second
+
+// Checker is implemented by any dependency whose health determines whether the service is live
+// or ready to receive traffic.
+type Checker interface {
+	// Check returns an error if the dependency is unhealthy
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts an ordinary function to the Checker interface
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Kind determines which probes a check participates in
+type Kind int
+
+const (
+	// Readiness checks determine whether the service should receive traffic. A failing readiness
+	// check removes the service from load balancing but does not restart it.
+	Readiness Kind = iota
+	// Liveness checks determine whether the service is functioning at all. A failing liveness
+	// check typically results in the service being restarted. Liveness checks are also evaluated
+	// as part of readiness.
+	Liveness
+)
+
+// String returns the lowercase name of the Kind
+func (k Kind) String() string {
+	switch k {
+	case Liveness:
+		return "liveness"
+	case Readiness:
+		return "readiness"
+	default:
+		return "unknown"
+	}
+}
+
+// Status describes the outcome of a check
+type Status string
+
+const (
+	// StatusPass indicates that a check succeeded
+	StatusPass Status = "pass"
+	// StatusFail indicates that a check failed
+	StatusFail Status = "fail"
+)
+
+// Result contains the outcome of the most recent evaluation of a single check
+type Result struct {
+	LastChecked time.Time     // Time at which the check was last evaluated
+	LastError   string        // The error returned by the most recent evaluation, if any
+	Status      Status        // Status of the most recent evaluation
+	Kind        Kind          // Kind of the check
+	Latency     time.Duration // Amount of time the most recent evaluation took
+}
+
+// Report contains the aggregate outcome of evaluating a set of checks
+type Report struct {
+	Checks   map[string]Result // Results keyed by check name
+	Status   Status            // StatusPass only if every evaluated check passed and the service is not draining
+	Draining bool              // Whether the service is draining in preparation for shutdown
+}
+
+// registration pairs a Checker with its Kind
+type registration struct {
+	checker Checker
+	kind    Kind
+}
+
+// Registry holds the set of checks for a service along with the result of their most recent
+// evaluation. All methods on Registry are safe for concurrent use.
+type Registry struct {
+	checks     map[string]registration
+	results    map[string]Result
+	grpcHealth *grpchealth.Server
+	status     *prometheus.GaugeVec
+	mutex      *sync.RWMutex
+	draining   bool
+	Timeout    time.Duration // Amount of time a single check may take before it is failed. Defaults to 5 seconds.
+}
+
+// NewRegistry creates and returns an empty Registry. The user may optionally specify an existing
+// Prometheus Registry. If no Registry is provided, the global Prometheus Registry is used. If the
+// check status gauge has already been registered, the existing gauge is reused.
+func NewRegistry(registry prometheus.Registerer) *Registry {
+	// If the user has not provided a Prometheus Registry, use the global Registry
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+	status := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "health_check_status",
+			Help: "Outcome of the most recent evaluation of a health check. 1 if passing, 0 if failing.",
+		},
+		[]string{"check", "kind"},
+	)
+	if err := registry.Register(status); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		// metric has been registered before so use existing metric
+		status = are.ExistingCollector.(*prometheus.GaugeVec)
+	}
+	return &Registry{
+		checks:     make(map[string]registration),
+		results:    make(map[string]Result),
+		grpcHealth: grpchealth.NewServer(),
+		status:     status,
+		mutex:      &sync.RWMutex{},
+		Timeout:    defaultTimeout,
+	}
+}
+
+// Register adds a named check to the Registry. Names must be unique; registering the same name
+// twice results in a panic.
+func (r *Registry) Register(name string, kind Kind, checker Checker) {
+	if checker == nil {
+		panic(fmt.Sprintf("no checker provided for health check `%s`", name))
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.checks[name]; ok {
+		panic(fmt.Sprintf("health check `%s` is already registered", name))
+	}
+	r.checks[name] = registration{checker: checker, kind: kind}
+}
+
+// Check evaluates every registered check of the given Kind concurrently and returns a Report of
+// the outcome. Evaluating Readiness also evaluates all Liveness checks, and always fails once the
+// Registry is draining. The results are recorded on the Registry and exported as Prometheus
+// gauges. When Readiness is evaluated, the serving status of the gRPC health service is updated as
+// well.
+func (r *Registry) Check(ctx context.Context, kind Kind) Report {
+	r.mutex.RLock()
+	toCheck := make(map[string]registration, len(r.checks))
+	for name, reg := range r.checks {
+		if kind == Readiness || reg.kind == kind {
+			toCheck[name] = reg
+		}
+	}
+	timeout := r.Timeout
+	draining := r.draining
+	r.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	var resultsMutex sync.Mutex
+	report := Report{Status: StatusPass, Checks: make(map[string]Result, len(toCheck))}
+	if kind == Readiness && draining {
+		report.Status = StatusFail
+		report.Draining = true
+	}
+	for name, reg := range toCheck {
+		wg.Add(1)
+		go func(name string, reg registration) {
+			defer wg.Done()
+			result := evaluate(ctx, reg, timeout)
+			if result.Status == StatusFail {
+				log.Get(ctx).Warn(
+					"health check failed",
+					zap.String("check", name),
+					zap.String("kind", reg.kind.String()),
+					zap.String("error", result.LastError),
+				)
+			}
+			resultsMutex.Lock()
+			defer resultsMutex.Unlock()
+			report.Checks[name] = result
+			if result.Status == StatusFail {
+				report.Status = StatusFail
+			}
+		}(name, reg)
+	}
+	wg.Wait()
+
+	r.mutex.Lock()
+	for name, result := range report.Checks {
+		r.results[name] = result
+		value := 0.0
+		if result.Status == StatusPass {
+			value = 1.0
+		}
+		r.status.With(prometheus.Labels{"check": name, "kind": result.Kind.String()}).Set(value)
+	}
+	r.mutex.Unlock()
+
+	if kind == Readiness {
+		servingStatus := healthpb.HealthCheckResponse_SERVING
+		if report.Status != StatusPass {
+			servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		r.grpcHealth.SetServingStatus("", servingStatus)
+	}
+	return report
+}
+
+// evaluate runs a single check, failing it if it does not complete within the timeout
+func evaluate(ctx context.Context, reg registration, timeout time.Duration) Result {
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	startTime := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- reg.checker.Check(checkCtx)
+	}()
+	var err error
+	select {
+	case err = <-errs:
+	case <-checkCtx.Done():
+		err = fmt.Errorf("health check did not complete: %w", checkCtx.Err())
+	}
+	result := Result{
+		Kind:        reg.kind,
+		Status:      StatusPass,
+		Latency:     time.Since(startTime),
+		LastChecked: startTime,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.LastError = err.Error()
+	}
+	return result
+}
+
+// Results returns the outcome of the most recent evaluation of every check that has been
+// evaluated at least once, keyed by check name.
+func (r *Registry) Results() map[string]Result {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	results := make(map[string]Result, len(r.results))
+	for name, result := range r.results {
+		results[name] = result
+	}
+	return results
+}
+
+// Watch creates a goroutine which evaluates all readiness checks at the specified frequency so
+// that the gRPC health service and Prometheus gauges stay current between probes. Calling the
+// cancel function associated with the provided context stops the evaluation.
+func (r *Registry) Watch(ctx context.Context, frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	go func() {
+		r.Check(ctx, Readiness)
+		for {
+			select {
+			case <-ticker.C:
+				r.Check(ctx, Readiness)
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Drain marks the service as draining in preparation for shutdown. From this point on, readiness
+// always fails and the gRPC health service permanently reports NOT_SERVING so that load balancers
+// stop routing new traffic to the service before its listeners are closed. Liveness is unaffected.
+// Drain is idempotent.
+func (r *Registry) Drain() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.draining {
+		return
+	}
+	r.draining = true
+	r.grpcHealth.Shutdown()
+}
+
+// Draining returns true once Drain has been called
+func (r *Registry) Draining() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.draining
+}
+
+// RegisterGRPCHealthServer registers the standard gRPC health service with the given gRPC server.
+// The overall ("") service reports SERVING when all readiness checks pass.
+func (r *Registry) RegisterGRPCHealthServer(server *grpc.Server) {
+	healthpb.RegisterHealthServer(server, r.grpcHealth)
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func passing(_ context.Context) error { return nil }
+
+func failing(_ context.Context) error { return fmt.Errorf("dependency unavailable") }
+
+func TestNewRegistry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	r := NewRegistry(registry)
+	assert.NotNil(t, r.status)
+	assert.Equal(t, defaultTimeout, r.Timeout)
+	// creating a second registry with the same prometheus registry reuses the gauge
+	assert.NotPanics(t, func() { assert.Equal(t, r.status, NewRegistry(registry).status) })
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry(prometheus.NewRegistry())
+	r.Register("db", Readiness, CheckerFunc(passing))
+	assert.Panics(t, func() { r.Register("db", Liveness, CheckerFunc(passing)) })
+	assert.Panics(t, func() { r.Register("nil", Liveness, nil) })
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		checks         map[string]Checker
+		kinds          map[string]Kind
+		expectedChecks []string
+		name           string
+		kind           Kind
+		expectedStatus Status
+		expectedGRPC   healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{
+			name:           "no registered checks pass",
+			kind:           Readiness,
+			expectedStatus: StatusPass,
+			expectedChecks: []string{},
+			expectedGRPC:   healthpb.HealthCheckResponse_SERVING,
+		}, {
+			name:           "readiness evaluates both readiness and liveness checks",
+			kind:           Readiness,
+			checks:         map[string]Checker{"db": CheckerFunc(passing), "process": CheckerFunc(passing)},
+			kinds:          map[string]Kind{"db": Readiness, "process": Liveness},
+			expectedStatus: StatusPass,
+			expectedChecks: []string{"db", "process"},
+			expectedGRPC:   healthpb.HealthCheckResponse_SERVING,
+		}, {
+			name:           "liveness only evaluates liveness checks",
+			kind:           Liveness,
+			checks:         map[string]Checker{"db": CheckerFunc(failing), "process": CheckerFunc(passing)},
+			kinds:          map[string]Kind{"db": Readiness, "process": Liveness},
+			expectedStatus: StatusPass,
+			expectedChecks: []string{"process"},
+			// liveness evaluations do not change the initial serving status
+			expectedGRPC: healthpb.HealthCheckResponse_SERVING,
+		}, {
+			name:           "a single failing check fails the report",
+			kind:           Readiness,
+			checks:         map[string]Checker{"db": CheckerFunc(failing), "kafka": CheckerFunc(passing)},
+			kinds:          map[string]Kind{"db": Readiness, "kafka": Readiness},
+			expectedStatus: StatusFail,
+			expectedChecks: []string{"db", "kafka"},
+			expectedGRPC:   healthpb.HealthCheckResponse_NOT_SERVING,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewRegistry(prometheus.NewRegistry())
+			for name, checker := range test.checks {
+				r.Register(name, test.kinds[name], checker)
+			}
+			report := r.Check(context.Background(), test.kind)
+			assert.Equal(t, test.expectedStatus, report.Status)
+			assert.Len(t, report.Checks, len(test.expectedChecks))
+			for _, name := range test.expectedChecks {
+				result, ok := report.Checks[name]
+				require.True(t, ok)
+				assert.Equal(t, test.kinds[name], result.Kind)
+				assert.False(t, result.LastChecked.IsZero())
+
+				gauge, err := r.status.GetMetricWith(prometheus.Labels{"check": name, "kind": result.Kind.String()})
+				require.NoError(t, err)
+				pb := &dto.Metric{}
+				require.NoError(t, gauge.Write(pb))
+				if result.Status == StatusPass {
+					assert.Equal(t, 1.0, pb.Gauge.GetValue())
+					assert.Empty(t, result.LastError)
+				} else {
+					assert.Equal(t, 0.0, pb.Gauge.GetValue())
+					assert.NotEmpty(t, result.LastError)
+				}
+			}
+			assert.Len(t, r.Results(), len(test.expectedChecks))
+
+			resp, err := r.grpcHealth.Check(context.Background(), &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedGRPC, resp.Status)
+		})
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	r := NewRegistry(prometheus.NewRegistry())
+	r.Timeout = 10 * time.Millisecond
+	r.Register("slow", Readiness, CheckerFunc(func(_ context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+	report := r.Check(context.Background(), Readiness)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Contains(t, report.Checks["slow"].LastError, "did not complete")
+}
+
+func TestWatch(t *testing.T) {
+	r := NewRegistry(prometheus.NewRegistry())
+	r.Register("db", Readiness, CheckerFunc(failing))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Watch(ctx, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		resp, err := r.grpcHealth.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		return err == nil && resp.Status == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, StatusFail, r.Results()["db"].Status)
+}
+
+func TestKindString(t *testing.T) {
+	assert.Equal(t, "readiness", Readiness.String())
+	assert.Equal(t, "liveness", Liveness.String())
+	assert.Equal(t, "unknown", Kind(42).String())
+}
+
+func TestDrain(t *testing.T) {
+	r := NewRegistry(prometheus.NewRegistry())
+	r.Register("process", Liveness, CheckerFunc(passing))
+	assert.Equal(t, StatusPass, r.Check(context.Background(), Readiness).Status)
+	assert.False(t, r.Draining())
+
+	r.Drain()
+	r.Drain()
+	assert.True(t, r.Draining())
+	report := r.Check(context.Background(), Readiness)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.True(t, report.Draining)
+	assert.Equal(t, StatusPass, report.Checks["process"].Status)
+
+	// liveness is unaffected by draining
+	report = r.Check(context.Background(), Liveness)
+	assert.Equal(t, StatusPass, report.Status)
+	assert.False(t, report.Draining)
+
+	resp, err := r.grpcHealth.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
@@ -0,0 +1,211 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spothero/tools/http/writer"
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// AccessLogFormatJSON emits the access log as structured log entries through the context logger
+	AccessLogFormatJSON = "json"
+	// AccessLogFormatCombined emits the access log as lines in the Apache combined log format
+	AccessLogFormatCombined = "combined"
+)
+
+// combinedTimeFormat is the timestamp format of the Apache combined log format
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogConfig defines the configuration of the HTTP access log
+type AccessLogConfig struct {
+	Writer          io.Writer // Destination of combined format lines. Defaults to stdout.
+	Format          string    // One of "json" or "combined". Defaults to "json".
+	SuccessSampling int       // Log one in every N successful requests. 0 or 1 logs every request.
+	Enabled         bool      // If true, the access log middleware is installed by the service
+}
+
+// accessLogCtxKey is the type used to place access log fields within context.Context
+type accessLogCtxKey int
+
+// accessLogFieldsKey is the context key of the fields attached to the access log line
+const accessLogFieldsKey accessLogCtxKey = iota
+
+// accessLogFields holds the fields attached to the access log line of a request
+type accessLogFields struct {
+	fields []zap.Field
+	mutex  sync.Mutex
+}
+
+// AddAccessLogFields attaches the given fields to the access log line of the request with the
+// given context. Fields are only emitted in the JSON format. This function is a no-op if the
+// request is not being access logged.
+func AddAccessLogFields(ctx context.Context, fields ...zap.Field) {
+	if alf, ok := ctx.Value(accessLogFieldsKey).(*accessLogFields); ok {
+		alf.mutex.Lock()
+		defer alf.mutex.Unlock()
+		alf.fields = append(alf.fields, fields...)
+	}
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	bytesRead int64
+}
+
+// Read reads from the request body while counting the bytes read
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	atomic.AddInt64(&cr.bytesRead, int64(n))
+	return n, err
+}
+
+// NewMiddleware returns middleware which emits one canonical access log line for every HTTP
+// request after it completes. In the JSON format, the line is logged at Info level through the
+// context logger with the method, route path template, URL, status code, duration, bytes read
+// from the request body, bytes written in the response and authenticated client name, as well as
+// any fields attached by handlers with AddAccessLogFields. In the combined format, the line is
+// written to the Writer in the Apache combined log format, with the authenticated client name as
+// the user.
+//
+// If SuccessSampling is greater than one, only one in every SuccessSampling requests with a
+// status below 400 is logged, while requests with error statuses are always logged. Requests whose
+// handler panics are logged with a 500 status before the panic continues to propagate.
+//
+// Note that this middleware should be attached after the tracing, requestid and jose middleware,
+// so that the correlation ID, request ID and client name are known, and before
+// log.HTTPServerMiddleware, so that the request is logged with the fields of the context logger
+// alone. An unknown Format results in a panic.
+func (c AccessLogConfig) NewMiddleware() mux.MiddlewareFunc {
+	switch c.Format {
+	case "":
+		c.Format = AccessLogFormatJSON
+	case AccessLogFormatJSON, AccessLogFormatCombined:
+	default:
+		panic(fmt.Sprintf("unknown access log format %q", c.Format))
+	}
+	if c.Writer == nil {
+		c.Writer = os.Stdout
+	}
+	var writerMutex sync.Mutex
+	var successes uint64
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			startTime := time.Now()
+			statusRecorder, ok := writer.Recorder(w)
+			if !ok {
+				w, statusRecorder = writer.Wrap(w)
+			}
+			var body *countingReader
+			if r.Body != nil && r.Body != http.NoBody {
+				body = &countingReader{ReadCloser: r.Body}
+				r.Body = body
+			}
+			alf := &accessLogFields{}
+			// The line is logged even if the handler panics, in which case a 500 is recorded and
+			// the panic continues to propagate
+			panicked := true
+			defer func() {
+				statusCode := statusRecorder.StatusCode
+				if panicked {
+					statusCode = http.StatusInternalServerError
+				}
+				if statusCode < http.StatusBadRequest && c.SuccessSampling > 1 &&
+					atomic.AddUint64(&successes, 1)%uint64(c.SuccessSampling) != 1 {
+					return
+				}
+				var bytesRead int64
+				if body != nil {
+					bytesRead = atomic.LoadInt64(&body.bytesRead)
+				}
+				if c.Format == AccessLogFormatCombined {
+					line := combinedLine(r, statusCode, statusRecorder.BytesWritten, startTime)
+					writerMutex.Lock()
+					defer writerMutex.Unlock()
+					_, _ = io.WriteString(c.Writer, line)
+					return
+				}
+				alf.mutex.Lock()
+				defer alf.mutex.Unlock()
+				fields := append([]zap.Field{
+					zap.String("http.method", r.Method),
+					zap.String("http.path", writer.FetchRoutePathTemplate(r)),
+					zap.String("http.url", r.URL.String()),
+					zap.Int("http.status_code", statusCode),
+					zap.Duration("http.duration", time.Since(startTime)),
+					zap.Int64("http.request_bytes", bytesRead),
+					zap.Int64("http.response_bytes", statusRecorder.BytesWritten),
+					zap.String("authenticated_client", retrieveAuthenticatedClient(r)),
+				}, alf.fields...)
+				log.Get(r.Context()).Named("access").Info("http request completed", fields...)
+			}()
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessLogFieldsKey, alf)))
+			panicked = false
+		})
+	}
+}
+
+// combinedLine formats the request in the Apache combined log format
+func combinedLine(r *http.Request, statusCode int, bytesWritten int64, startTime time.Time) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	user := retrieveAuthenticatedClient(r)
+	if user == UNAUTHENTICATED {
+		user = "-"
+	}
+	responseBytes := "-"
+	if bytesWritten > 0 {
+		responseBytes = strconv.FormatInt(bytesWritten, 10)
+	}
+	return fmt.Sprintf(
+		"%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		combinedValue(host),
+		combinedValue(user),
+		startTime.Format(combinedTimeFormat),
+		r.Method,
+		combinedValue(r.URL.RequestURI()),
+		r.Proto,
+		statusCode,
+		responseBytes,
+		combinedValue(r.Referer()),
+		combinedValue(r.UserAgent()),
+	)
+}
+
+// combinedValue escapes quotes, backslashes and control characters in a combined log format
+// value and replaces empty values with a dash
+func combinedValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	quoted := strconv.Quote(value)
+	return quoted[1 : len(quoted)-1]
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/spothero/tools/http/writer"
+	"github.com/spothero/tools/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newAccessLogRouter returns a router serving /items/{id} behind the given access log config.
+// The handler reads the request body, attaches a field to the access log and responds with the
+// status code given in the `status` query parameter, or panics if it is `panic`.
+func newAccessLogRouter(c AccessLogConfig) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(writer.StatusRecorderMiddleware)
+	router.Use(c.NewMiddleware())
+	router.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		AddAccessLogFields(r.Context(), zap.String("item_id", mux.Vars(r)["id"]))
+		switch r.URL.Query().Get("status") {
+		case "500":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "panic":
+			panic("handler failed")
+		}
+		_, _ = w.Write([]byte("hello"))
+	})
+	return router
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	router := newAccessLogRouter(AccessLogConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/items/123?status=500", strings.NewReader("body"))
+	req = req.WithContext(log.NewContext(req.Context(), zap.New(core)))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	assert.Equal(t, "access", entry.LoggerName)
+	assert.Equal(t, zapcore.InfoLevel, entry.Level)
+	fields := entry.ContextMap()
+	assert.Equal(t, http.MethodPost, fields["http.method"])
+	assert.Equal(t, "/items/{id}", fields["http.path"])
+	assert.Equal(t, "/items/123?status=500", fields["http.url"])
+	assert.Equal(t, int64(http.StatusInternalServerError), fields["http.status_code"])
+	assert.Equal(t, int64(4), fields["http.request_bytes"])
+	assert.Equal(t, int64(5), fields["http.response_bytes"])
+	assert.Equal(t, UNAUTHENTICATED, fields["authenticated_client"])
+	assert.Equal(t, "123", fields["item_id"])
+	assert.Contains(t, fields, "http.duration")
+}
+
+func TestAccessLogPanic(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	router := newAccessLogRouter(AccessLogConfig{SuccessSampling: 100})
+	req := httptest.NewRequest(http.MethodGet, "/items/123?status=panic", nil)
+	req = req.WithContext(log.NewContext(req.Context(), zap.New(core)))
+	assert.PanicsWithValue(t, "handler failed", func() {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	// requests whose handler panics are always logged as server errors
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, int64(http.StatusInternalServerError), fields["http.status_code"])
+	assert.Equal(t, "123", fields["item_id"])
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	router := newAccessLogRouter(AccessLogConfig{SuccessSampling: 3})
+	ctx := log.NewContext(context.Background(), zap.New(core))
+	for i := 0; i < 6; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil).WithContext(ctx))
+	}
+	assert.Equal(t, 2, logs.Len())
+	for i := 0; i < 2; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1?status=500", nil).WithContext(ctx))
+	}
+	assert.Equal(t, 4, logs.Len())
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	router := newAccessLogRouter(AccessLogConfig{Format: AccessLogFormatCombined, Writer: &buf})
+	req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", `agent "quoted"`)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Regexp(
+		t,
+		`^10\.0\.0\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /items/1 HTTP/1\.1" 200 5 "-" "agent \\"quoted\\""\n$`,
+		buf.String(),
+	)
+}
+
+func TestAccessLogUnknownFormat(t *testing.T) {
+	assert.Panics(t, func() {
+		AccessLogConfig{Format: "xml"}.NewMiddleware()
+	})
+}
+
+func TestAddAccessLogFieldsWithoutAccessLog(t *testing.T) {
+	assert.NotPanics(t, func() {
+		AddAccessLogFields(context.Background(), zap.String("key", "value"))
+	})
+}
@@ -0,0 +1,353 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	shErrors "github.com/spothero/tools/errors"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	durationType    = reflect.TypeOf(time.Duration(0))
+	coordinatesType = reflect.TypeOf(Coordinates{})
+)
+
+// BindQuery decodes the query parameters and path variables of the request into the struct
+// pointed to by dst. Fields are bound from the query parameter named by their `query` tag or the
+// path variable named by their `path` tag, and may additionally be tagged with:
+//
+//   - `required:"true"` to reject requests which omit the parameter
+//   - `default:"..."` to provide a value when the parameter is omitted
+//   - `min:"..."` and `max:"..."` to bound numbers and durations by value, and strings and slices
+//     by length
+//   - `layout:"..."` to parse times with the given layouts, separated by `|`, tried in order.
+//     Times are parsed as RFC 3339 by default.
+//
+// Strings, bools, ints, uints, floats, time.Time, time.Duration, slices of these and pointers to
+// all of the above are supported. Slices are bound from repeated and comma-separated values.
+// Coordinates fields are bound from a pair of query parameters named by their tag, for example
+// `query:"latitude,longitude"`. Pointer fields are left nil when the parameter is omitted. Empty
+// parameters are treated as omitted. Fields of embedded structs without tags are bound as if they
+// were fields of dst.
+//
+// Every invalid parameter is reported in a single InvalidArgument error which lists each parameter
+// as an InvalidParam, so that it is rendered as a 400 problem by errors.WriteHTTP. BindQuery
+// panics if dst is not a pointer to a struct or if a tagged field or its tags are not supported.
+func BindQuery(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("BindQuery requires a pointer to a struct, got %T", dst))
+	}
+	b := binder{query: r.URL.Query(), vars: mux.Vars(r)}
+	b.bindStruct(v.Elem())
+	if len(b.invalid) == 0 {
+		return nil
+	}
+	causes := make([]error, 0, len(b.invalid))
+	for _, param := range b.invalid {
+		causes = append(causes, fmt.Errorf("%s %s", param.Name, param.Reason))
+	}
+	return &shErrors.Error{
+		Kind:          shErrors.InvalidArgument,
+		Code:          "invalid_parameters",
+		Message:       "one or more request parameters are invalid",
+		Cause:         errors.Join(causes...),
+		InvalidParams: b.invalid,
+	}
+}
+
+// binder accumulates the invalid parameters encountered while binding a request
+type binder struct {
+	query   url.Values
+	vars    map[string]string
+	invalid []shErrors.InvalidParam
+}
+
+// reject records the given parameter as invalid
+func (b *binder) reject(name, reason string, args ...interface{}) {
+	b.invalid = append(b.invalid, shErrors.InvalidParam{Name: name, Reason: fmt.Sprintf(reason, args...)})
+}
+
+// bindStruct binds each tagged field of the given struct value
+func (b *binder) bindStruct(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		query, isQuery := field.Tag.Lookup("query")
+		path, isPath := field.Tag.Lookup("path")
+		switch {
+		case !field.IsExported() && !field.Anonymous:
+			continue
+		case isQuery && isPath:
+			panic(fmt.Sprintf("field %s may not have both query and path tags", field.Name))
+		case isQuery && indirect(field.Type) == coordinatesType:
+			b.bindCoordinates(v.Field(i), field, query)
+		case isQuery:
+			b.bindField(v.Field(i), field, query, b.query[query])
+		case isPath:
+			var values []string
+			if value, ok := b.vars[path]; ok {
+				values = []string{value}
+			}
+			b.bindField(v.Field(i), field, path, values)
+		case field.Anonymous && field.Type.Kind() == reflect.Struct:
+			b.bindStruct(v.Field(i))
+		}
+	}
+}
+
+// bindField parses the given values of the named parameter into the field, applying the
+// required, default, min and max constraints of the field
+func (b *binder) bindField(v reflect.Value, field reflect.StructField, name string, values []string) {
+	values = nonEmpty(values)
+	isDefault := false
+	if len(values) == 0 {
+		def, hasDefault := field.Tag.Lookup("default")
+		switch {
+		case hasDefault:
+			values, isDefault = []string{def}, true
+		case field.Tag.Get("required") == "true":
+			b.reject(name, "is required")
+			return
+		default:
+			return
+		}
+	}
+	target := reflect.New(indirect(field.Type)).Elem()
+	reason := parseValues(target, field, values)
+	if reason == "" {
+		reason = checkBounds(target, field)
+	}
+	if reason != "" {
+		if isDefault {
+			panic(fmt.Sprintf("default value of field %s %s", field.Name, reason))
+		}
+		b.reject(name, reason)
+		return
+	}
+	setValue(v, target)
+}
+
+// bindCoordinates binds the pair of latitude and longitude query parameters named by the tag into
+// the field, validating that both are present and within range
+func (b *binder) bindCoordinates(v reflect.Value, field reflect.StructField, tag string) {
+	latName, lonName, ok := strings.Cut(tag, ",")
+	if !ok {
+		panic(fmt.Sprintf("query tag of field %s must name latitude and longitude parameters", field.Name))
+	}
+	latStr, lonStr := b.query.Get(latName), b.query.Get(lonName)
+	switch {
+	case latStr == "" && lonStr == "":
+		if field.Tag.Get("required") == "true" {
+			b.reject(latName, "is required")
+			b.reject(lonName, "is required")
+		}
+		return
+	case latStr == "":
+		b.reject(latName, "must be provided with %s", lonName)
+		return
+	case lonStr == "":
+		b.reject(lonName, "must be provided with %s", latName)
+		return
+	}
+	lat, latErr := strconv.ParseFloat(latStr, 64)
+	lon, lonErr := strconv.ParseFloat(lonStr, 64)
+	valid := true
+	switch {
+	case latErr != nil:
+		b.reject(latName, "must be a number")
+		valid = false
+	case lat < -90 || lat > 90:
+		b.reject(latName, "must be in [-90, 90]")
+		valid = false
+	}
+	switch {
+	case lonErr != nil:
+		b.reject(lonName, "must be a number")
+		valid = false
+	case lon < -180 || lon > 180:
+		b.reject(lonName, "must be in [-180, 180]")
+		valid = false
+	}
+	if valid {
+		setValue(v, reflect.ValueOf(Coordinates{Latitude: lat, Longitude: lon}))
+	}
+}
+
+// parseValues parses the values into target, returning the reason the values are invalid, if any
+func parseValues(target reflect.Value, field reflect.StructField, values []string) string {
+	if target.Kind() != reflect.Slice {
+		return parseValue(target, field, values[0])
+	}
+	var elems []string
+	for _, value := range values {
+		elems = append(elems, nonEmpty(strings.Split(value, ","))...)
+	}
+	slice := reflect.MakeSlice(target.Type(), len(elems), len(elems))
+	for i, elem := range elems {
+		if reason := parseValue(slice.Index(i), field, elem); reason != "" {
+			return reason
+		}
+	}
+	target.Set(slice)
+	return ""
+}
+
+// parseValue parses a single value into target, returning the reason the value is invalid, if any
+func parseValue(target reflect.Value, field reflect.StructField, value string) string {
+	switch target.Type() {
+	case timeType:
+		layouts := []string{time.RFC3339}
+		if layout, ok := field.Tag.Lookup("layout"); ok {
+			layouts = strings.Split(layout, "|")
+		}
+		for _, layout := range layouts {
+			if parsed, err := time.Parse(layout, value); err == nil {
+				target.Set(reflect.ValueOf(parsed))
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be a time in the format %s", strings.Join(layouts, " or "))
+	case durationType:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return "must be a duration"
+		}
+		target.SetInt(int64(parsed))
+		return ""
+	}
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return "must be a boolean"
+		}
+		target.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, target.Type().Bits())
+		if err != nil {
+			return "must be an integer"
+		}
+		target.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, target.Type().Bits())
+		if err != nil {
+			return "must be a non-negative integer"
+		}
+		target.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, target.Type().Bits())
+		if err != nil {
+			return "must be a number"
+		}
+		target.SetFloat(parsed)
+	default:
+		panic(fmt.Sprintf("field %s has unsupported type %s", field.Name, field.Type))
+	}
+	return ""
+}
+
+// checkBounds validates the parsed value against the min and max tags of the field, returning the
+// reason the value is out of bounds, if any
+func checkBounds(v reflect.Value, field reflect.StructField) string {
+	for _, bound := range []string{"min", "max"} {
+		limit, ok := field.Tag.Lookup(bound)
+		if !ok {
+			continue
+		}
+		order, unit, err := compare(v, limit)
+		if err != nil {
+			panic(fmt.Sprintf("%s tag of field %s is invalid: %v", bound, field.Name, err))
+		}
+		switch {
+		case bound == "min" && order < 0:
+			return strings.TrimSpace(fmt.Sprintf("must be at least %s %s", limit, unit))
+		case bound == "max" && order > 0:
+			return strings.TrimSpace(fmt.Sprintf("must be at most %s %s", limit, unit))
+		}
+	}
+	return ""
+}
+
+// compare returns -1, 0 or 1 if the value is less than, equal to or greater than the limit.
+// Strings and slices are compared by length, in which case the unit of the length is returned.
+func compare(v reflect.Value, limit string) (int, string, error) {
+	if v.Type() == durationType {
+		parsed, err := time.ParseDuration(limit)
+		return cmp.Compare(time.Duration(v.Int()), parsed), "", err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		parsed, err := strconv.Atoi(limit)
+		return cmp.Compare(len(v.String()), parsed), "characters", err
+	case reflect.Slice:
+		parsed, err := strconv.Atoi(limit)
+		return cmp.Compare(v.Len(), parsed), "values", err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(limit, 10, 64)
+		return cmp.Compare(v.Int(), parsed), "", err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(limit, 10, 64)
+		return cmp.Compare(v.Uint(), parsed), "", err
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(limit, 64)
+		return cmp.Compare(v.Float(), parsed), "", err
+	default:
+		return 0, "", fmt.Errorf("bounds are not supported for %s", v.Type())
+	}
+}
+
+// setValue assigns the parsed value to the field, allocating it if the field is a pointer
+func setValue(field, value reflect.Value) {
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(value.Type())
+		ptr.Elem().Set(value)
+		field.Set(ptr)
+		return
+	}
+	field.Set(value)
+}
+
+// indirect returns the element type of pointer types and the type itself otherwise
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+// nonEmpty returns the non-empty values
+func nonEmpty(values []string) []string {
+	filtered := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" {
+			filtered = append(filtered, value)
+		}
+	}
+	return filtered
+}
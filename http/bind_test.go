@@ -0,0 +1,187 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	shErrors "github.com/spothero/tools/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pageParams struct {
+	Limit int `query:"limit" default:"20" min:"1" max:"100"`
+}
+
+type searchParams struct {
+	Since      time.Time    `query:"since" layout:"2006-01-02|2006-01-02T15:04:05Z07:00"`
+	Location   *Coordinates `query:"lat,lon"`
+	Radius     *float64     `query:"radius" min:"0.5" max:"50"`
+	Name       string       `query:"name" min:"3"`
+	FacilityID string       `path:"facility_id" required:"true"`
+	Amenities  []string     `query:"amenity" max:"3"`
+	IDs        []int64      `query:"ids"`
+	ignored    string       `query:"ignored"` //nolint:unused
+	pageParams
+	Window      time.Duration `query:"window" default:"1h" max:"24h"`
+	Spots       uint16        `query:"spots"`
+	Covered     bool          `query:"covered"`
+	Unspecified int
+}
+
+func TestBindQuery(t *testing.T) {
+	radius := 2.5
+	tests := []struct {
+		vars          map[string]string
+		name          string
+		query         string
+		expectedError []shErrors.InvalidParam
+		expected      searchParams
+	}{
+		{
+			name:  "all supported fields are bound",
+			query: "since=2024-03-01&lat=41.88&lon=-87.63&radius=2.5&name=garage&amenity=ev&amenity=valet,covered&ids=1,2&limit=5&window=30m&spots=3&covered=true&ignored=x",
+			vars:  map[string]string{"facility_id": "42"},
+			expected: searchParams{
+				Since:      time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+				Location:   &Coordinates{Latitude: 41.88, Longitude: -87.63},
+				Radius:     &radius,
+				Name:       "garage",
+				FacilityID: "42",
+				Amenities:  []string{"ev", "valet", "covered"},
+				IDs:        []int64{1, 2},
+				pageParams: pageParams{Limit: 5},
+				Window:     30 * time.Minute,
+				Spots:      3,
+				Covered:    true,
+			},
+		},
+		{
+			name:  "omitted parameters are left unset or defaulted",
+			query: "name=&radius=",
+			vars:  map[string]string{"facility_id": "42"},
+			expected: searchParams{
+				FacilityID: "42",
+				pageParams: pageParams{Limit: 20},
+				Window:     time.Hour,
+			},
+		},
+		{
+			name:  "times are parsed with each layout in order",
+			query: "since=2024-03-01T12:30:00Z",
+			vars:  map[string]string{"facility_id": "42"},
+			expected: searchParams{
+				Since:      time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+				FacilityID: "42",
+				pageParams: pageParams{Limit: 20},
+				Window:     time.Hour,
+			},
+		},
+		{
+			name:  "every invalid parameter is reported",
+			query: "since=yesterday&lat=91&lon=abc&radius=0.1&name=ab&amenity=a,b,c,d&ids=1,x&limit=0&window=48h&spots=-1&covered=maybe",
+			expectedError: []shErrors.InvalidParam{
+				{Name: "since", Reason: "must be a time in the format 2006-01-02 or 2006-01-02T15:04:05Z07:00"},
+				{Name: "lat", Reason: "must be in [-90, 90]"},
+				{Name: "lon", Reason: "must be a number"},
+				{Name: "radius", Reason: "must be at least 0.5"},
+				{Name: "name", Reason: "must be at least 3 characters"},
+				{Name: "facility_id", Reason: "is required"},
+				{Name: "amenity", Reason: "must be at most 3 values"},
+				{Name: "ids", Reason: "must be an integer"},
+				{Name: "limit", Reason: "must be at least 1"},
+				{Name: "window", Reason: "must be at most 24h"},
+				{Name: "spots", Reason: "must be a non-negative integer"},
+				{Name: "covered", Reason: "must be a boolean"},
+			},
+		},
+		{
+			name:  "coordinates must be provided together",
+			query: "lat=41.88",
+			vars:  map[string]string{"facility_id": "42"},
+			expectedError: []shErrors.InvalidParam{
+				{Name: "lon", Reason: "must be provided with lat"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/search?"+test.query, nil), test.vars)
+			var params searchParams
+			err := BindQuery(r, &params)
+			if test.expectedError == nil {
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, params)
+				return
+			}
+			var bindErr *shErrors.Error
+			require.ErrorAs(t, err, &bindErr)
+			assert.Equal(t, shErrors.InvalidArgument, bindErr.Kind)
+			assert.Equal(t, "invalid_parameters", bindErr.Code)
+			assert.Equal(t, test.expectedError, bindErr.InvalidParams)
+		})
+	}
+}
+
+func TestBindQueryProblem(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/search?limit=abc", nil)
+	var params pageParams
+	err := BindQuery(r, &params)
+	require.Error(t, err)
+
+	recorder := httptest.NewRecorder()
+	shErrors.WriteHTTP(recorder, r, err)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	var problem shErrors.Problem
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&problem))
+	assert.Equal(t, []shErrors.InvalidParam{{Name: "limit", Reason: "must be an integer"}}, problem.InvalidParams)
+}
+
+func TestBindQueryPanics(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/search", nil)
+	tests := []struct {
+		dst  interface{}
+		name string
+	}{
+		{name: "non-pointer destinations panic", dst: pageParams{}},
+		{name: "pointers to non-structs panic", dst: new(int)},
+		{name: "unsupported field types panic", dst: &struct {
+			Values map[string]string `query:"values" default:"a"`
+		}{}},
+		{name: "invalid defaults panic", dst: &struct {
+			Limit int `query:"limit" default:"many"`
+		}{}},
+		{name: "invalid bounds panic", dst: &struct {
+			Limit int `query:"limit" default:"1" min:"one"`
+		}{}},
+		{name: "coordinates without a longitude parameter panic", dst: &struct {
+			Location Coordinates `query:"lat"`
+		}{}},
+		{name: "fields with query and path tags panic", dst: &struct {
+			ID string `query:"id" path:"id"`
+		}{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Panics(t, func() { _ = BindQuery(r, test.dst) })
+		})
+	}
+}
@@ -19,14 +19,78 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cep21/circuit/v3"
+	"github.com/cep21/circuit/v3/closers/hystrix"
 )
 
+// CircuitBreakerConfig defines the circuit breaker applied to each host called through a
+// CircuitBreakerRoundTripper created with NewRoundTripper. Zero values are replaced with the
+// defaults given for each field.
+type CircuitBreakerConfig struct {
+	Timeout                  time.Duration // Maximum duration of each request. Defaults to 30 seconds.
+	SleepWindow              time.Duration // Duration for which requests are rejected once the circuit opens. Defaults to 5 seconds.
+	ErrorThresholdPercentage int64         // Percentage of failed requests which opens the circuit. Defaults to 50.
+	RequestVolumeThreshold   int64         // Minimum number of requests to a host before the circuit may open. Defaults to 20.
+}
+
+// withDefaults returns the CircuitBreakerConfig with zero values replaced by their defaults
+func (c CircuitBreakerConfig) withDefaults() CircuitBreakerConfig {
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Second
+	}
+	if c.SleepWindow <= 0 {
+		c.SleepWindow = 5 * time.Second
+	}
+	if c.ErrorThresholdPercentage <= 0 {
+		c.ErrorThresholdPercentage = 50
+	}
+	if c.RequestVolumeThreshold <= 0 {
+		c.RequestVolumeThreshold = 20
+	}
+	return c
+}
+
+// circuitConfig returns the configuration of a new circuit. No ceiling is placed on the number of
+// concurrent requests.
+func (c CircuitBreakerConfig) circuitConfig() circuit.Config {
+	c = c.withDefaults()
+	return circuit.Config{
+		Execution: circuit.ExecutionConfig{
+			Timeout:               c.Timeout,
+			MaxConcurrentRequests: -1,
+		},
+		General: circuit.GeneralConfig{
+			ClosedToOpenFactory: hystrix.OpenerFactory(hystrix.ConfigureOpener{
+				ErrorThresholdPercentage: c.ErrorThresholdPercentage,
+				RequestVolumeThreshold:   c.RequestVolumeThreshold,
+			}),
+			OpenToClosedFactory: hystrix.CloserFactory(hystrix.ConfigureCloser{
+				SleepWindow: c.SleepWindow,
+			}),
+		},
+	}
+}
+
+// NewRoundTripper creates a CircuitBreakerRoundTripper which applies the CircuitBreakerConfig to
+// the circuit of each host it calls. The configuration may be changed at runtime with
+// SetDefaultConfiguration.
+func (c CircuitBreakerConfig) NewRoundTripper(roundTripper http.RoundTripper) *CircuitBreakerRoundTripper {
+	cbrt := NewDefaultCircuitBreakerRoundTripper(roundTripper, nil)
+	cbrt.SetDefaultConfiguration(c)
+	return cbrt
+}
+
 // CircuitBreakerRoundTripper wraps a RoundTrapper with circuit-breaker logic
 type CircuitBreakerRoundTripper struct {
 	RoundTripper http.RoundTripper
-	manager      circuit.Manager
+	defaults     atomic.Pointer[CircuitBreakerConfig]
+	// hosts whose circuits are configured with SetHostConfiguration rather than the defaults
+	configuredHosts sync.Map
+	manager         circuit.Manager
 }
 
 // NewDefaultCircuitBreakerRoundTripper constructs and returns the default
@@ -62,7 +126,9 @@ func NewDefaultCircuitBreakerRoundTripper(
 		RoundTripper: roundTripper,
 		manager:      circuit.Manager{},
 	}
+	cbrt.manager.DefaultCircuitProperties = []circuit.CommandPropertiesConstructor{cbrt.defaultCircuitConfig}
 	for circuitName, circuitConfig := range hostConfiguration {
+		cbrt.configuredHosts.Store(circuitName, true)
 		_ = cbrt.manager.MustCreateCircuit(circuitName, circuitConfig)
 	}
 	return cbrt
@@ -105,3 +171,57 @@ func (cbrt *CircuitBreakerRoundTripper) RoundTrip(req *http.Request) (*http.Resp
 	}
 	return resp, err
 }
+
+// SetHostConfiguration updates the circuit configuration for the given hosts at runtime without
+// interrupting in-flight requests. Circuits which do not yet exist are created. The key in the map
+// **must be the host name of the server you intend to call (eg req.URL.Host)**.
+func (cbrt *CircuitBreakerRoundTripper) SetHostConfiguration(hostConfiguration map[string]circuit.Config) {
+	for circuitName, circuitConfig := range hostConfiguration {
+		cbrt.configuredHosts.Store(circuitName, true)
+		if existing := cbrt.manager.GetCircuit(circuitName); existing != nil {
+			existing.SetConfigThreadSafe(circuitConfig)
+			continue
+		}
+		if _, err := cbrt.manager.CreateCircuit(circuitName, circuitConfig); err != nil {
+			// The circuit was created concurrently, so update it instead
+			cbrt.manager.GetCircuit(circuitName).SetConfigThreadSafe(circuitConfig)
+		}
+	}
+}
+
+// SetDefaultConfiguration updates the circuit configuration of all hosts which are not configured
+// with SetHostConfiguration at runtime without interrupting in-flight requests. The thresholds of
+// existing circuits are updated in place, so their recorded requests are kept.
+func (cbrt *CircuitBreakerRoundTripper) SetDefaultConfiguration(config CircuitBreakerConfig) {
+	config = config.withDefaults()
+	cbrt.defaults.Store(&config)
+	for _, existing := range cbrt.manager.AllCircuits() {
+		if _, ok := cbrt.configuredHosts.Load(existing.Name()); ok {
+			continue
+		}
+		circuitConfig := existing.Config()
+		circuitConfig.Execution.Timeout = config.Timeout
+		existing.SetConfigThreadSafe(circuitConfig)
+		if opener, ok := existing.ClosedToOpen.(*hystrix.Opener); ok {
+			openerConfig := opener.Config()
+			openerConfig.ErrorThresholdPercentage = config.ErrorThresholdPercentage
+			openerConfig.RequestVolumeThreshold = config.RequestVolumeThreshold
+			opener.SetConfigThreadSafe(openerConfig)
+		}
+		if closer, ok := existing.OpenToClose.(*hystrix.Closer); ok {
+			closerConfig := closer.Config()
+			closerConfig.SleepWindow = config.SleepWindow
+			closer.SetConfigThreadSafe(closerConfig)
+		}
+	}
+}
+
+// defaultCircuitConfig returns the configuration of new circuits which are not configured with
+// SetHostConfiguration. If SetDefaultConfiguration has not been called, the defaults of the
+// circuit package are used.
+func (cbrt *CircuitBreakerRoundTripper) defaultCircuitConfig(string) circuit.Config {
+	if config := cbrt.defaults.Load(); config != nil {
+		return config.circuitConfig()
+	}
+	return circuit.Config{}
+}
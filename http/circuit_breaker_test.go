@@ -18,8 +18,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/cep21/circuit/v3"
+	"github.com/cep21/circuit/v3/closers/hystrix"
 	"github.com/spothero/tools/http/mock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -129,3 +131,47 @@ func TestCircuitBreakerRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestSetHostConfiguration(t *testing.T) {
+	cbrt := NewDefaultCircuitBreakerRoundTripper(
+		&mock.RoundTripper{ResponseStatusCodes: []int{http.StatusOK}},
+		map[string]circuit.Config{"existing": {Execution: circuit.ExecutionConfig{Timeout: time.Second}}},
+	)
+	cbrt.SetHostConfiguration(map[string]circuit.Config{
+		"existing": {Execution: circuit.ExecutionConfig{Timeout: 2 * time.Second}},
+		"new":      {Execution: circuit.ExecutionConfig{Timeout: 3 * time.Second}},
+	})
+	require.NotNil(t, cbrt.manager.GetCircuit("existing"))
+	assert.Equal(t, 2*time.Second, cbrt.manager.GetCircuit("existing").Config().Execution.Timeout)
+	require.NotNil(t, cbrt.manager.GetCircuit("new"))
+	assert.Equal(t, 3*time.Second, cbrt.manager.GetCircuit("new").Config().Execution.Timeout)
+}
+
+func TestSetDefaultConfiguration(t *testing.T) {
+	cbrt := CircuitBreakerConfig{Timeout: time.Second}.NewRoundTripper(&mock.RoundTripper{ResponseStatusCodes: []int{http.StatusOK}})
+	cbrt.SetHostConfiguration(map[string]circuit.Config{
+		"configured": {Execution: circuit.ExecutionConfig{Timeout: 3 * time.Second}},
+	})
+	_, err := cbrt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://example.com/path", nil))
+	require.NoError(t, err)
+	existing := cbrt.manager.GetCircuit("example.com")
+	require.NotNil(t, existing)
+	assert.Equal(t, time.Second, existing.Config().Execution.Timeout)
+	assert.Equal(t, int64(50), existing.ClosedToOpen.(*hystrix.Opener).Config().ErrorThresholdPercentage)
+
+	cbrt.SetDefaultConfiguration(CircuitBreakerConfig{
+		Timeout:                  2 * time.Second,
+		SleepWindow:              time.Minute,
+		ErrorThresholdPercentage: 10,
+		RequestVolumeThreshold:   5,
+	})
+	// existing circuits are updated in place
+	assert.Equal(t, 2*time.Second, existing.Config().Execution.Timeout)
+	assert.Equal(t, int64(10), existing.ClosedToOpen.(*hystrix.Opener).Config().ErrorThresholdPercentage)
+	assert.Equal(t, int64(5), existing.ClosedToOpen.(*hystrix.Opener).Config().RequestVolumeThreshold)
+	assert.Equal(t, time.Minute, existing.OpenToClose.(*hystrix.Closer).Config().SleepWindow)
+	// new circuits use the new defaults
+	assert.Equal(t, 2*time.Second, cbrt.manager.MustCreateCircuit("new.example.com").Config().Execution.Timeout)
+	// circuits configured for their host are not changed
+	assert.Equal(t, 3*time.Second, cbrt.manager.GetCircuit("configured").Config().Execution.Timeout)
+}
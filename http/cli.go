@@ -21,9 +21,60 @@ func (c *Config) RegisterFlags(flags *pflag.FlagSet) {
 	flags.StringVar(&c.Name, "server-name", c.Name, "The HTTP Server Name. This will be emitted in components such as logs and tracing.")
 	flags.StringVarP(&c.Address, "address", "a", c.Address, "Address for server")
 	flags.Uint16VarP(&c.Port, "port", "p", c.Port, "Port for server")
+	flags.StringVar(&c.AdminAddress, "admin-address", c.AdminAddress, "Address for the internal admin server")
+	flags.Uint16Var(&c.AdminPort, "admin-port", c.AdminPort, "Port for the internal admin server serving health, metrics, pprof and log level endpoints. If 0, these endpoints are served on the public port.")
 	flags.IntVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "HTTP Server Read Timeout")
 	flags.IntVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "HTTP Server Write Timeout")
+	flags.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", c.ReadHeaderTimeout, "HTTP Server Read Header Timeout. If 0, the read timeout is used.")
+	flags.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "HTTP Server Idle Timeout for keep-alive connections. If 0, the read timeout is used.")
+	flags.DurationVar(&c.HandlerTimeout, "handler-timeout", c.HandlerTimeout, "Maximum time for HTTP handlers to respond before the request is cancelled with a 503. Routes may override this in code. 0 disables the timeout.")
+	flags.Int64Var(&c.MaxRequestBodyBytes, "max-request-body-bytes", c.MaxRequestBodyBytes, "Maximum size of HTTP request bodies in bytes. 0 disables the limit.")
+	flags.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "Maximum time to wait for in-flight HTTP requests on shutdown before forcibly closing connections. 0 waits indefinitely.")
+	flags.DurationVar(&c.PreStopDelay, "pre-stop-delay", c.PreStopDelay, "Time to keep serving HTTP requests with a failing readiness check before closing listeners on shutdown")
+	flags.BoolVar(&c.TLSEnabled, "tls-enabled", c.TLSEnabled, "Serve HTTPS using the TLS certificate and key. Rotated certificates are reloaded without a restart.")
+	flags.StringVar(&c.TLSCrtPath, "tls-crt-path", c.TLSCrtPath, "Location of the HTTP Server TLS Certificate")
+	flags.StringVar(&c.TLSKeyPath, "tls-key-path", c.TLSKeyPath, "Location of the HTTP Server TLS Key")
+	flags.StringVar(&c.TLSClientCAPath, "tls-client-ca-path", c.TLSClientCAPath, "Location of the CA bundle used to verify HTTP client certificates. Unlike the certificate, it is not reloaded without a restart.")
+	flags.StringVar(&c.TLSClientAuth, "tls-client-auth", c.TLSClientAuth, "HTTP client certificate verification. One of `none`, `optional` or `require`. Defaults to none.")
+	flags.StringVar(&c.TLSMinVersion, "tls-min-version", c.TLSMinVersion, "Minimum TLS version accepted by the HTTP Server. One of 1.0, 1.1, 1.2 or 1.3. Defaults to 1.2.")
+	flags.StringSliceVar(&c.TLSCipherSuites, "tls-cipher-suites", c.TLSCipherSuites, "Comma-separated TLS 1.2 cipher suites accepted by the HTTP Server. Defaults to the Go defaults.")
+	flags.BoolVar(&c.Compression.Enabled, "compression-enabled", c.Compression.Enabled, "Compress HTTP responses with the best encoding accepted by the client")
+	flags.StringSliceVar(&c.Compression.Algorithms, "compression-algorithms", c.Compression.Algorithms, "Comma-separated HTTP response encodings in order of preference. Any of `zstd`, `gzip` or `deflate`. Defaults to all three.")
+	flags.IntVar(&c.Compression.MinSize, "compression-min-size", c.Compression.MinSize, "Minimum size of HTTP response bodies in bytes to compress. Defaults to 1024.")
+	flags.StringSliceVar(&c.Compression.ContentTypes, "compression-content-types", c.Compression.ContentTypes, "Comma-separated media types of HTTP responses to compress, such as `application/json,text/*`. Defaults to all types which are not excluded.")
+	flags.StringSliceVar(&c.Compression.ExcludedContentTypes, "compression-excluded-content-types", c.Compression.ExcludedContentTypes, "Comma-separated media types of HTTP responses which are never compressed. Defaults to streaming and already compressed types.")
+	flags.BoolVar(&c.Compression.DecompressRequests, "decompress-requests", c.Compression.DecompressRequests, "Decompress HTTP request bodies with a Content-Encoding of gzip, zstd or deflate")
 	flags.BoolVar(&c.HealthHandler, "health-handler", c.HealthHandler, "Enable /health endpoint")
 	flags.BoolVar(&c.MetricsHandler, "metrics-handler", c.MetricsHandler, "Enable /metrics endpoints")
 	flags.BoolVar(&c.PprofHandler, "pprof-handler", c.PprofHandler, "Enable /pprof/debug/* endpoints")
+	flags.BoolVar(&c.RoutesHandler, "routes-handler", c.RoutesHandler, "Enable /debug/routes endpoint listing HTTP routes and gRPC services")
+}
+
+// RegisterAdminFlags registers the flags of a server which only serves the admin endpoints, such
+// as that of a worker, with pflags. See NewAdminServer.
+func (c *Config) RegisterAdminFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.AdminAddress, "admin-address", c.AdminAddress, "Address for the internal admin server")
+	flags.Uint16Var(&c.AdminPort, "admin-port", c.AdminPort, "Port for the internal admin server serving health, metrics, pprof and log level endpoints")
+	flags.BoolVar(&c.HealthHandler, "health-handler", c.HealthHandler, "Enable /health endpoint")
+	flags.BoolVar(&c.MetricsHandler, "metrics-handler", c.MetricsHandler, "Enable /metrics endpoints")
+	flags.BoolVar(&c.PprofHandler, "pprof-handler", c.PprofHandler, "Enable /pprof/debug/* endpoints")
+}
+
+// RegisterFlags registers access log flags with pflags
+func (c *AccessLogConfig) RegisterFlags(flags *pflag.FlagSet) {
+	if c.Format == "" {
+		c.Format = AccessLogFormatJSON
+	}
+	flags.BoolVar(&c.Enabled, "access-log", c.Enabled, "Enable the HTTP access log, emitting one line for every request")
+	flags.StringVar(&c.Format, "access-log-format", c.Format, "HTTP access log format. One of `json` or `combined`")
+	flags.IntVar(&c.SuccessSampling, "access-log-success-sampling", c.SuccessSampling, "Log one in every N successful HTTP requests in the access log. 0 or 1 logs every request. Requests with error statuses are always logged.")
+}
+
+// RegisterFlags registers HTTP client circuit breaker flags with pflags
+func (c *CircuitBreakerConfig) RegisterFlags(flags *pflag.FlagSet) {
+	*c = c.withDefaults()
+	flags.DurationVar(&c.Timeout, "http-client-circuit-timeout", c.Timeout, "Maximum duration of each HTTP client request")
+	flags.DurationVar(&c.SleepWindow, "http-client-circuit-sleep-window", c.SleepWindow, "Duration for which HTTP client requests to a host are rejected once its circuit breaker opens")
+	flags.Int64Var(&c.ErrorThresholdPercentage, "http-client-circuit-error-threshold", c.ErrorThresholdPercentage, "Percentage of failed HTTP client requests to a host which opens its circuit breaker")
+	flags.Int64Var(&c.RequestVolumeThreshold, "http-client-circuit-request-volume-threshold", c.RequestVolumeThreshold, "Minimum number of HTTP client requests to a host before its circuit breaker may open")
 }
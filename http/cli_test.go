@@ -16,6 +16,7 @@ package http
 
 import (
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
@@ -40,6 +41,14 @@ func TestRegisterFlags(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, c.Port, p)
 
+	aa, err := flags.GetString("admin-address")
+	assert.NoError(t, err)
+	assert.Equal(t, c.AdminAddress, aa)
+
+	ap, err := flags.GetUint16("admin-port")
+	assert.NoError(t, err)
+	assert.Equal(t, c.AdminPort, ap)
+
 	rt, err := flags.GetInt("read-timeout")
 	assert.NoError(t, err)
 	assert.Equal(t, c.ReadTimeout, rt)
@@ -48,6 +57,82 @@ func TestRegisterFlags(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, c.WriteTimeout, wt)
 
+	rht, err := flags.GetDuration("read-header-timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, c.ReadHeaderTimeout, rht)
+
+	it, err := flags.GetDuration("idle-timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, c.IdleTimeout, it)
+
+	ht, err := flags.GetDuration("handler-timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, c.HandlerTimeout, ht)
+
+	mrbb, err := flags.GetInt64("max-request-body-bytes")
+	assert.NoError(t, err)
+	assert.Equal(t, c.MaxRequestBodyBytes, mrbb)
+
+	st, err := flags.GetDuration("shutdown-timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, c.ShutdownTimeout, st)
+
+	psd, err := flags.GetDuration("pre-stop-delay")
+	assert.NoError(t, err)
+	assert.Equal(t, c.PreStopDelay, psd)
+
+	te, err := flags.GetBool("tls-enabled")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSEnabled, te)
+
+	tcp, err := flags.GetString("tls-crt-path")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSCrtPath, tcp)
+
+	tkp, err := flags.GetString("tls-key-path")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSKeyPath, tkp)
+
+	tccp, err := flags.GetString("tls-client-ca-path")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSClientCAPath, tccp)
+
+	tca, err := flags.GetString("tls-client-auth")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSClientAuth, tca)
+
+	tmv, err := flags.GetString("tls-min-version")
+	assert.NoError(t, err)
+	assert.Equal(t, c.TLSMinVersion, tmv)
+
+	tcs, err := flags.GetStringSlice("tls-cipher-suites")
+	assert.NoError(t, err)
+	assert.Empty(t, tcs)
+
+	ce, err := flags.GetBool("compression-enabled")
+	assert.NoError(t, err)
+	assert.True(t, ce)
+
+	ca, err := flags.GetStringSlice("compression-algorithms")
+	assert.NoError(t, err)
+	assert.Empty(t, ca)
+
+	cms, err := flags.GetInt("compression-min-size")
+	assert.NoError(t, err)
+	assert.Equal(t, c.Compression.MinSize, cms)
+
+	cct, err := flags.GetStringSlice("compression-content-types")
+	assert.NoError(t, err)
+	assert.Empty(t, cct)
+
+	cect, err := flags.GetStringSlice("compression-excluded-content-types")
+	assert.NoError(t, err)
+	assert.Empty(t, cect)
+
+	dr, err := flags.GetBool("decompress-requests")
+	assert.NoError(t, err)
+	assert.False(t, dr)
+
 	hh, err := flags.GetBool("health-handler")
 	assert.NoError(t, err)
 	assert.Equal(t, c.HealthHandler, hh)
@@ -59,4 +144,49 @@ func TestRegisterFlags(t *testing.T) {
 	ph, err := flags.GetBool("pprof-handler")
 	assert.NoError(t, err)
 	assert.Equal(t, c.PprofHandler, ph)
+
+	rh, err := flags.GetBool("routes-handler")
+	assert.NoError(t, err)
+	assert.Equal(t, c.RoutesHandler, rh)
+}
+
+func TestRegisterAdminFlags(t *testing.T) {
+	flags := pflag.NewFlagSet("pflags", pflag.PanicOnError)
+	c := NewDefaultConfig("test")
+	c.RegisterAdminFlags(flags)
+	err := flags.Parse([]string{"--admin-address", "0.0.0.0", "--admin-port", "9090", "--pprof-handler"})
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0", c.AdminAddress)
+	assert.Equal(t, uint16(9090), c.AdminPort)
+	assert.True(t, c.HealthHandler)
+	assert.True(t, c.MetricsHandler)
+	assert.True(t, c.PprofHandler)
+	for _, name := range []string{"port", "address", "tls-enabled", "compression-enabled", "handler-timeout", "routes-handler"} {
+		assert.Nil(t, flags.Lookup(name), name)
+	}
+}
+
+func TestAccessLogConfigRegisterFlags(t *testing.T) {
+	flags := pflag.NewFlagSet("pflags", pflag.PanicOnError)
+	c := AccessLogConfig{}
+	c.RegisterFlags(flags)
+	err := flags.Parse([]string{"--access-log", "--access-log-format", "combined", "--access-log-success-sampling", "10"})
+	assert.NoError(t, err)
+	assert.Equal(t, AccessLogConfig{Enabled: true, Format: AccessLogFormatCombined, SuccessSampling: 10}, c)
+}
+
+func TestCircuitBreakerConfigRegisterFlags(t *testing.T) {
+	flags := pflag.NewFlagSet("pflags", pflag.PanicOnError)
+	c := CircuitBreakerConfig{}
+	c.RegisterFlags(flags)
+	// defaults are used for flags which are not set
+	assert.Equal(t, 30*time.Second, c.Timeout)
+	err := flags.Parse([]string{"--http-client-circuit-timeout", "10s", "--http-client-circuit-error-threshold", "25"})
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitBreakerConfig{
+		Timeout:                  10 * time.Second,
+		SleepWindow:              5 * time.Second,
+		ErrorThresholdPercentage: 25,
+		RequestVolumeThreshold:   20,
+	}, c)
 }
@@ -19,28 +19,47 @@ import (
 
 	"github.com/spothero/tools/jose"
 	"github.com/spothero/tools/log"
+	"github.com/spothero/tools/requestid"
 	"github.com/spothero/tools/tracing"
 )
 
 // NewDefaultClient constructs the default HTTP Client with a series of HTTP RoundTrippers that
 // provide additional features, such as exponential backoff, metrics, tracing, authentication
-// passthrough, and logging. Providing the base HTTP RoundTripper is optional.
+// and request ID passthrough, and logging. Providing the base HTTP RoundTripper is optional.
 // If `nil` is received, the net/http DefaultClient will be used.
 //
-// By default, the client provides exponential backoff on [500-504] errors. The default
+// By default, the client provides exponential backoff on 429 and [500-504] errors. The default
 // configuration for exponential backoff is to start with an interval of 100 milliseconds, a
 // multiplier of two, a randomization factor of up to 0.5 milliseconds (for jitter), a max
 // interval of 10 seconds, and finally, the retry will attempt 5 times before failing if the
-// error is retriable.
+// error is retriable. Only idempotent requests are retried, and retries are limited by a
+// per-host retry budget. See RetryRoundTripper.
 func NewDefaultClient(metrics Metrics, roundTripper http.RoundTripper) http.Client {
 	if roundTripper == nil {
 		roundTripper = http.DefaultTransport
 	}
-	circuitBreakerRoundTripper := NewDefaultCircuitBreakerRoundTripper(roundTripper, nil)
+	return newClient(metrics, NewDefaultCircuitBreakerRoundTripper(roundTripper, nil))
+}
+
+// NewClient constructs an HTTP Client like NewDefaultClient, except that the circuit breakers
+// of each host are configured by the CircuitBreakerConfig. The CircuitBreakerRoundTripper of the
+// client is returned so that its configuration may be updated at runtime.
+func (c CircuitBreakerConfig) NewClient(metrics Metrics, roundTripper http.RoundTripper) (http.Client, *CircuitBreakerRoundTripper) {
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	circuitBreakerRoundTripper := c.NewRoundTripper(roundTripper)
+	return newClient(metrics, circuitBreakerRoundTripper), circuitBreakerRoundTripper
+}
+
+// newClient constructs an HTTP Client which sends requests through the given
+// CircuitBreakerRoundTripper
+func newClient(metrics Metrics, circuitBreakerRoundTripper *CircuitBreakerRoundTripper) http.Client {
 	retryRoundTripper := NewDefaultRetryRoundTripper(circuitBreakerRoundTripper)
 	tracingRoundTripper := tracing.RoundTripper{RoundTripper: retryRoundTripper}
 	loggingRoundTripper := log.RoundTripper{RoundTripper: tracingRoundTripper}
 	metricsRoundTripper := MetricsRoundTripper{RoundTripper: loggingRoundTripper, Metrics: metrics}
 	joseRoundTripper := jose.RoundTripper{RoundTripper: metricsRoundTripper}
-	return http.Client{Transport: joseRoundTripper}
+	requestIDRoundTripper := requestid.RoundTripper{RoundTripper: joseRoundTripper}
+	return http.Client{Transport: requestIDRoundTripper}
 }
@@ -21,6 +21,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spothero/tools/jose"
 	"github.com/spothero/tools/log"
+	"github.com/spothero/tools/requestid"
 	"github.com/spothero/tools/tracing"
 	"github.com/stretchr/testify/assert"
 )
@@ -29,7 +30,10 @@ func TestNewDefaultClient(t *testing.T) {
 	metrics := NewMetrics(prometheus.NewRegistry(), true)
 	client := NewDefaultClient(metrics, nil)
 	assert.NotNil(t, client)
-	jrt, ok := client.Transport.(jose.RoundTripper)
+	rirt, ok := client.Transport.(requestid.RoundTripper)
+	assert.True(t, ok)
+
+	jrt, ok := rirt.RoundTripper.(jose.RoundTripper)
 	assert.True(t, ok)
 
 	mrt, ok := jrt.RoundTripper.(MetricsRoundTripper)
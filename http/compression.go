@@ -0,0 +1,449 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
+	shErrors "github.com/spothero/tools/errors"
+)
+
+const (
+	// EncodingZstd compresses responses with Zstandard
+	EncodingZstd = "zstd"
+	// EncodingGzip compresses responses with gzip
+	EncodingGzip = "gzip"
+	// EncodingDeflate compresses responses with zlib-wrapped deflate
+	EncodingDeflate = "deflate"
+)
+
+// CompressionConfig defines the compression of HTTP responses and decompression of HTTP requests.
+// Brotli is not supported.
+type CompressionConfig struct {
+	Algorithms           []string // Response encodings in order of preference. Any of "zstd", "gzip" or "deflate". Defaults to all three.
+	ContentTypes         []string // Media types which are compressed, such as "application/json" or "text/*". If empty, all types which are not excluded are compressed.
+	ExcludedContentTypes []string // Media types which are never compressed. Defaults to streaming and already compressed types.
+	MinSize              int      // Minimum size of response bodies in bytes to compress. Defaults to 1024.
+	Enabled              bool     // If true, responses are compressed
+	DecompressRequests   bool     // If true, request bodies with a Content-Encoding of gzip, zstd or deflate are decompressed
+}
+
+// defaultExcludedContentTypes are media types which are streamed or already compressed
+var defaultExcludedContentTypes = []string{
+	"text/event-stream",
+	"application/grpc",
+	"application/zip",
+	"application/gzip",
+	"application/zstd",
+	"application/x-gzip",
+	"image/*",
+	"audio/*",
+	"video/*",
+	"font/woff",
+	"font/woff2",
+}
+
+// encoder is implemented by the compressing writers of each supported encoding
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoderPools holds reusable encoders for each supported encoding
+var encoderPools = map[string]*sync.Pool{
+	EncodingZstd: {New: func() interface{} {
+		// Encoders are used by a single request at a time, so concurrent compression is unnecessary
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(1<<20))
+		return enc
+	}},
+	EncodingGzip: {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	EncodingDeflate: {New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}},
+}
+
+// NewMiddleware returns middleware which compresses responses and decompresses requests according
+// to the CompressionConfig. The response encoding is negotiated from the Accept-Encoding header of
+// the request, honoring quality values and preferring algorithms in the configured order.
+//
+// Responses are buffered until MinSize bytes have been written, so that small bodies are sent
+// uncompressed. Responses which are flushed before reaching MinSize, such as Server-Sent Events,
+// responses which already have a Content-Encoding, such as those of the Prometheus handler, and
+// responses to hijacked connections are never compressed. Compressed responses are flushed
+// through the encoder when the handler flushes. The ResponseWriter passed to the handler
+// implements http.Flusher and http.Hijacker only if the underlying ResponseWriter does.
+//
+// Middleware attached after this middleware, such as the metrics and access log middleware,
+// observe the uncompressed response, so recorded response sizes are those of the uncompressed
+// body.
+//
+// When DecompressRequests is set, request bodies are decompressed before reaching the handler and
+// the Content-Encoding and Content-Length headers are removed. Requests with any other
+// Content-Encoding are rejected with a 415 problem response. Note that this middleware should be
+// attached before MaxRequestBodyMiddleware so that the limit applies to the decompressed body.
+func (c CompressionConfig) NewMiddleware() mux.MiddlewareFunc {
+	algorithms := c.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{EncodingZstd, EncodingGzip, EncodingDeflate}
+	}
+	for _, algorithm := range algorithms {
+		if _, ok := encoderPools[algorithm]; !ok {
+			panic(fmt.Sprintf("unsupported compression algorithm %q", algorithm))
+		}
+	}
+	excluded := c.ExcludedContentTypes
+	if excluded == nil {
+		excluded = defaultExcludedContentTypes
+	}
+	minSize := c.MinSize
+	if minSize <= 0 {
+		minSize = 1024
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.DecompressRequests {
+				if err := decompressRequest(r); err != nil {
+					w.Header().Set("Accept-Encoding", "gzip, zstd, deflate")
+					shErrors.WriteHTTP(w, r, err)
+					return
+				}
+			}
+			if !c.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), algorithms)
+			if encoding == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				contentTypes:   c.ContentTypes,
+				excluded:       excluded,
+				minSize:        minSize,
+			}
+			defer cw.close()
+			next.ServeHTTP(cw.wrap(), r)
+		})
+	}
+}
+
+// negotiateEncoding returns the supported algorithm with the highest quality value in the given
+// Accept-Encoding header, preferring algorithms earlier in the list when quality values are
+// equal. If the client accepts none of the algorithms, an empty string is returned.
+func negotiateEncoding(acceptEncoding string, algorithms []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(entry, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(name) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = q
+			}
+		}
+		qualities[coding] = quality
+	}
+	best, bestQuality := "", 0.0
+	for _, algorithm := range algorithms {
+		quality, ok := qualities[algorithm]
+		if !ok {
+			quality = qualities["*"]
+		}
+		if quality > bestQuality {
+			best, bestQuality = algorithm, quality
+		}
+	}
+	return best
+}
+
+// matchContentType returns true if the media type of the given Content-Type matches any of the
+// given media types. Media types ending in "/*" match any subtype.
+func matchContentType(contentType string, mediaTypes []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	for _, candidate := range mediaTypes {
+		candidate = strings.ToLower(candidate)
+		if prefix, ok := strings.CutSuffix(candidate, "*"); ok && strings.HasSuffix(prefix, "/") {
+			if strings.HasPrefix(mediaType, prefix) {
+				return true
+			}
+		} else if mediaType == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter is an http.ResponseWriter which buffers the start of the response to decide
+// whether it should be compressed, and then writes it through an encoder if so
+type compressWriter struct {
+	http.ResponseWriter
+	encoder      encoder
+	encoding     string
+	buffer       []byte
+	contentTypes []string
+	excluded     []string
+	minSize      int
+	statusCode   int
+	started      bool
+}
+
+// WriteHeader records the status code of the response. Informational responses are sent
+// immediately.
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.started || cw.statusCode != 0 {
+		return
+	}
+	if code < http.StatusOK && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.statusCode = code
+}
+
+// Write buffers the body until the minimum size is reached, and then writes it through the
+// encoder if the response is to be compressed
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.started {
+		if cw.encoder != nil {
+			return cw.encoder.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buffer = append(cw.buffer, b...)
+	if len(cw.buffer) >= cw.minSize {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// wrap returns the compressWriter as an http.ResponseWriter which implements http.Flusher and
+// http.Hijacker only if the underlying ResponseWriter implements them, as with writer.Wrap
+func (cw *compressWriter) wrap() http.ResponseWriter {
+	_, isFlusher := cw.ResponseWriter.(http.Flusher)
+	_, isHijacker := cw.ResponseWriter.(http.Hijacker)
+	switch {
+	case isFlusher && isHijacker:
+		return &struct {
+			*compressWriter
+			http.Flusher
+			http.Hijacker
+		}{cw, compressFlusher{cw}, compressHijacker{cw}}
+	case isFlusher:
+		return &struct {
+			*compressWriter
+			http.Flusher
+		}{cw, compressFlusher{cw}}
+	case isHijacker:
+		return &struct {
+			*compressWriter
+			http.Hijacker
+		}{cw, compressHijacker{cw}}
+	default:
+		return cw
+	}
+}
+
+// compressFlusher flushes a compressWriter whose underlying ResponseWriter is an http.Flusher
+type compressFlusher struct {
+	cw *compressWriter
+}
+
+// Flush sends any buffered data to the client. Responses which are flushed before the minimum
+// size is reached are assumed to be streams and are not compressed.
+func (cf compressFlusher) Flush() {
+	cw := cf.cw
+	if !cw.started {
+		if err := cw.start(false); err != nil {
+			return
+		}
+	}
+	if cw.encoder != nil {
+		if err := cw.encoder.Flush(); err != nil {
+			return
+		}
+	}
+	cw.ResponseWriter.(http.Flusher).Flush()
+}
+
+// compressHijacker hijacks the connection of a compressWriter whose underlying ResponseWriter is
+// an http.Hijacker
+type compressHijacker struct {
+	cw *compressWriter
+}
+
+// Hijack allows the handler to take over the connection, in which case the response is not
+// compressed
+func (ch compressHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	ch.cw.started = true
+	return ch.cw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// Unwrap returns the underlying http ResponseWriter. This allows http.ResponseController to
+// access the features of the underlying ResponseWriter.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// start writes the response headers and any buffered body, compressing the response if
+// compression is permitted and the response is eligible
+func (cw *compressWriter) start(compress bool) error {
+	cw.started = true
+	if cw.statusCode == 0 {
+		cw.statusCode = http.StatusOK
+	}
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buffer) > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buffer))
+	}
+	if compress && cw.compressible() {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		cw.encoder = encoderPools[cw.encoding].Get().(encoder)
+		cw.encoder.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+	buffer := cw.buffer
+	cw.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buffer)
+	} else {
+		_, err = cw.ResponseWriter.Write(buffer)
+	}
+	return err
+}
+
+// compressible returns true if the status and headers of the response permit compression
+func (cw *compressWriter) compressible() bool {
+	switch {
+	case cw.statusCode < http.StatusOK,
+		cw.statusCode == http.StatusNoContent,
+		cw.statusCode == http.StatusPartialContent,
+		cw.statusCode == http.StatusNotModified:
+		return false
+	}
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if matchContentType(contentType, cw.excluded) {
+		return false
+	}
+	return len(cw.contentTypes) == 0 || matchContentType(contentType, cw.contentTypes)
+}
+
+// close completes the response, sending any buffered body uncompressed and returning the encoder
+// to its pool
+func (cw *compressWriter) close() {
+	if !cw.started {
+		if cw.statusCode == 0 && len(cw.buffer) == 0 {
+			return
+		}
+		_ = cw.start(false)
+	}
+	if cw.encoder != nil {
+		_ = cw.encoder.Close()
+		cw.encoder.Reset(nil)
+		encoderPools[cw.encoding].Put(cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+// decompressRequest replaces the body of a request having a supported Content-Encoding with a
+// decompressing reader. An UnsupportedMediaType error is returned for other encodings.
+func decompressRequest(r *http.Request) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	var reader io.ReadCloser
+	switch encoding {
+	case EncodingGzip, "x-gzip":
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return shErrors.Wrap(err, shErrors.InvalidArgument, "invalid_request_encoding", "the request body is not valid gzip")
+		}
+		reader = gzipReader
+	case EncodingDeflate:
+		zlibReader, err := zlib.NewReader(r.Body)
+		if err != nil {
+			return shErrors.Wrap(err, shErrors.InvalidArgument, "invalid_request_encoding", "the request body is not valid deflate")
+		}
+		reader = zlibReader
+	case EncodingZstd:
+		zstdReader, err := zstd.NewReader(r.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return shErrors.Wrap(err, shErrors.InvalidArgument, "invalid_request_encoding", "the request body is not valid zstd")
+		}
+		reader = zstdReader.IOReadCloser()
+	default:
+		return shErrors.New(shErrors.UnsupportedMediaType, "unsupported_content_encoding", fmt.Sprintf("content encoding %q is not supported", encoding))
+	}
+	r.Body = decompressedBody{ReadCloser: reader, body: r.Body}
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return nil
+}
+
+// decompressedBody closes both the decompressing reader and the original request body
+type decompressedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+// Close closes the decompressing reader and the original request body
+func (db decompressedBody) Close() error {
+	err := db.ReadCloser.Close()
+	if bodyErr := db.body.Close(); err == nil {
+		err = bodyErr
+	}
+	return err
+}
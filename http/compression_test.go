@@ -0,0 +1,395 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spothero/tools/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	algorithms := []string{EncodingZstd, EncodingGzip, EncodingDeflate}
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		expected       string
+	}{
+		{"no header results in no encoding", "", ""},
+		{"the preferred algorithm is chosen when all are equal", "gzip, deflate, zstd", EncodingZstd},
+		{"only accepted algorithms are chosen", "gzip, deflate", EncodingGzip},
+		{"quality values are honored", "zstd;q=0.5, gzip;q=0.8", EncodingGzip},
+		{"algorithms with a quality of zero are refused", "zstd;q=0, gzip;q=0", ""},
+		{"wildcards accept all algorithms", "*", EncodingZstd},
+		{"wildcards do not override explicit refusals", "zstd;q=0, *;q=0.5", EncodingGzip},
+		{"encodings are case insensitive", "GZIP", EncodingGzip},
+		{"unsupported encodings are ignored", "br, identity", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, negotiateEncoding(test.acceptEncoding, algorithms))
+		})
+	}
+}
+
+func TestMatchContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		mediaTypes  []string
+		expected    bool
+	}{
+		{"exact media types match", "application/json", []string{"application/json"}, true},
+		{"parameters are ignored", "text/html; charset=utf-8", []string{"text/html"}, true},
+		{"wildcards match any subtype", "image/png", []string{"image/*"}, true},
+		{"wildcards do not match other types", "text/plain", []string{"image/*"}, false},
+		{"matching is case insensitive", "Application/JSON", []string{"application/json"}, true},
+		{"different media types do not match", "application/xml", []string{"application/json"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, matchContentType(test.contentType, test.mediaTypes))
+		})
+	}
+}
+
+// decompress decodes a response body with the given Content-Encoding
+func decompress(t *testing.T, encoding string, body []byte) string {
+	var reader io.Reader
+	var err error
+	switch encoding {
+	case EncodingGzip:
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case EncodingDeflate:
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	case EncodingZstd:
+		reader, err = zstd.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(decoded)
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	largeBody := strings.Repeat(`{"spot":"wrigley"}`, 100)
+	tests := []struct {
+		handler          http.HandlerFunc
+		name             string
+		acceptEncoding   string
+		expectedEncoding string
+		expectedBody     string
+		config           CompressionConfig
+		expectedStatus   int
+	}{
+		{
+			name:             "large responses are compressed with the negotiated encoding",
+			config:           CompressionConfig{Enabled: true},
+			acceptEncoding:   "gzip, zstd",
+			expectedEncoding: EncodingZstd,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     largeBody,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(largeBody))
+			},
+		}, {
+			name:             "gzip is used when preferred",
+			config:           CompressionConfig{Enabled: true, Algorithms: []string{EncodingGzip, EncodingZstd}},
+			acceptEncoding:   "gzip, zstd",
+			expectedEncoding: EncodingGzip,
+			expectedStatus:   http.StatusCreated,
+			expectedBody:     largeBody,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Length", "1800")
+				w.WriteHeader(http.StatusCreated)
+				for i := 0; i < 100; i++ {
+					_, _ = w.Write([]byte(`{"spot":"wrigley"}`))
+				}
+			},
+		}, {
+			name:             "deflate is supported",
+			config:           CompressionConfig{Enabled: true},
+			acceptEncoding:   "deflate",
+			expectedEncoding: EncodingDeflate,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     largeBody,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(largeBody))
+			},
+		}, {
+			name:           "small responses are not compressed",
+			config:         CompressionConfig{Enabled: true},
+			acceptEncoding: "gzip",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"spot":"wrigley"}`,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(`{"spot":"wrigley"}`))
+			},
+		}, {
+			name:           "responses are not compressed for clients which do not accept compression",
+			config:         CompressionConfig{Enabled: true},
+			expectedStatus: http.StatusOK,
+			expectedBody:   largeBody,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(largeBody))
+			},
+		}, {
+			name:           "excluded content types are not compressed",
+			config:         CompressionConfig{Enabled: true},
+			acceptEncoding: "gzip",
+			expectedStatus: http.StatusOK,
+			expectedBody:   largeBody,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte(largeBody))
+			},
+		}, {
+			name:           "content types outside the allow list are not compressed",
+			config:         CompressionConfig{Enabled: true, ContentTypes: []string{"text/*"}},
+			acceptEncoding: "gzip",
+			expectedStatus: http.StatusOK,
+			expectedBody:   largeBody,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(largeBody))
+			},
+		}, {
+			name:             "content types within the allow list are compressed",
+			config:           CompressionConfig{Enabled: true, ContentTypes: []string{"text/*"}},
+			acceptEncoding:   "gzip",
+			expectedEncoding: EncodingGzip,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     strings.Repeat("wrigley field ", 100),
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(strings.Repeat("wrigley field ", 100)))
+			},
+		}, {
+			name:             "already encoded responses are not compressed again",
+			config:           CompressionConfig{Enabled: true},
+			acceptEncoding:   "gzip",
+			expectedEncoding: "custom",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     largeBody,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Encoding", "custom")
+				_, _ = w.Write([]byte(largeBody))
+			},
+		}, {
+			name:           "flushed responses are streamed uncompressed",
+			config:         CompressionConfig{Enabled: true},
+			acceptEncoding: "gzip",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "data: 1\n\n" + largeBody,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("data: 1\n\n"))
+				w.(http.Flusher).Flush()
+				_, _ = w.Write([]byte(largeBody))
+			},
+		}, {
+			name:           "responses without a body are passed through",
+			config:         CompressionConfig{Enabled: true},
+			acceptEncoding: "gzip",
+			expectedStatus: http.StatusNoContent,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		}, {
+			name:           "responses are not compressed when compression is disabled",
+			config:         CompressionConfig{DecompressRequests: true},
+			acceptEncoding: "gzip",
+			expectedStatus: http.StatusOK,
+			expectedBody:   largeBody,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(largeBody))
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := test.config.NewMiddleware()(test.handler)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, test.expectedStatus, w.Code)
+			assert.Equal(t, test.expectedEncoding, w.Header().Get("Content-Encoding"))
+			if test.expectedEncoding != "" && test.expectedEncoding != "custom" {
+				assert.Empty(t, w.Header().Get("Content-Length"))
+			}
+			if test.config.Enabled {
+				assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			}
+			assert.Equal(t, test.expectedBody, decompress(t, w.Header().Get("Content-Encoding"), w.Body.Bytes()))
+		})
+	}
+}
+
+func TestCompressionMiddlewareFlush(t *testing.T) {
+	largeBody := strings.Repeat("wrigley field ", 100)
+	handler := CompressionConfig{Enabled: true}.NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(largeBody))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(largeBody))
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.True(t, w.Flushed)
+	assert.Equal(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, largeBody+largeBody, decompress(t, EncodingGzip, w.Body.Bytes()))
+}
+
+// hijackRecorder is a ResponseRecorder which implements http.Hijacker
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+// Hijack is not supported by the recorder
+func (hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("hijack not supported")
+}
+
+func TestCompressionMiddlewareInterfaces(t *testing.T) {
+	tests := []struct {
+		writer           http.ResponseWriter
+		name             string
+		expectedFlusher  bool
+		expectedHijacker bool
+	}{
+		{
+			name:            "flushers remain flushers",
+			writer:          httptest.NewRecorder(),
+			expectedFlusher: true,
+		}, {
+			name:             "hijackers remain hijackers",
+			writer:           hijackRecorder{httptest.NewRecorder()},
+			expectedFlusher:  true,
+			expectedHijacker: true,
+		}, {
+			name:   "other writers do not gain optional interfaces",
+			writer: struct{ http.ResponseWriter }{httptest.NewRecorder()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var isFlusher, isHijacker bool
+			handler := CompressionConfig{Enabled: true}.NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, isFlusher = w.(http.Flusher)
+				_, isHijacker = w.(http.Hijacker)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			handler.ServeHTTP(test.writer, r)
+			assert.Equal(t, test.expectedFlusher, isFlusher)
+			assert.Equal(t, test.expectedHijacker, isHijacker)
+		})
+	}
+}
+
+func TestCompressionMiddlewareInvalidAlgorithm(t *testing.T) {
+	assert.Panics(t, func() {
+		CompressionConfig{Enabled: true, Algorithms: []string{"br"}}.NewMiddleware()
+	})
+}
+
+func TestDecompressionMiddleware(t *testing.T) {
+	payload := `{"spot":"wrigley"}`
+	var gzipBody, zlibBody bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipBody)
+	_, _ = gzipWriter.Write([]byte(payload))
+	require.NoError(t, gzipWriter.Close())
+	zlibWriter := zlib.NewWriter(&zlibBody)
+	_, _ = zlibWriter.Write([]byte(payload))
+	require.NoError(t, zlibWriter.Close())
+	zstdEncoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	zstdBody := zstdEncoder.EncodeAll([]byte(payload), nil)
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		expectedStatus  int
+		expectedBody    string
+	}{
+		{"gzip request bodies are decompressed", "gzip", gzipBody.Bytes(), http.StatusOK, payload},
+		{"zstd request bodies are decompressed", "zstd", zstdBody, http.StatusOK, payload},
+		{"deflate request bodies are decompressed", "deflate", zlibBody.Bytes(), http.StatusOK, payload},
+		{"uncompressed request bodies are passed through", "", []byte(payload), http.StatusOK, payload},
+		{"invalid gzip request bodies are rejected", "gzip", []byte(payload), http.StatusBadRequest, ""},
+		{"unsupported encodings are rejected", "br", []byte(payload), http.StatusUnsupportedMediaType, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var receivedBody string
+			handler := CompressionConfig{DecompressRequests: true}.NewMiddleware()(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				assert.Empty(t, r.Header.Get("Content-Encoding"))
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				receivedBody = string(body)
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(test.body))
+			if test.contentEncoding != "" {
+				r.Header.Set("Content-Encoding", test.contentEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, test.expectedStatus, w.Code)
+			assert.Equal(t, test.expectedBody, receivedBody)
+			if test.expectedStatus == http.StatusUnsupportedMediaType {
+				assert.Equal(t, errors.ProblemContentType, w.Header().Get("Content-Type"))
+				assert.NotEmpty(t, w.Header().Get("Accept-Encoding"))
+			}
+		})
+	}
+}
+
+func TestDecompressionMiddlewareRequestLimit(t *testing.T) {
+	var body bytes.Buffer
+	gzipWriter := gzip.NewWriter(&body)
+	_, _ = gzipWriter.Write(bytes.Repeat([]byte("a"), 10000))
+	require.NoError(t, gzipWriter.Close())
+	var readErr error
+	handler := CompressionConfig{DecompressRequests: true}.NewMiddleware()(
+		MaxRequestBodyMiddleware(1000)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			_, readErr = io.ReadAll(r.Body)
+		})),
+	)
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body.Bytes()))
+	r.Header.Set("Content-Encoding", "gzip")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	var maxBytesErr *http.MaxBytesError
+	assert.ErrorAs(t, readErr, &maxBytesErr)
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	shErrors "github.com/spothero/tools/errors"
+	"github.com/spothero/tools/http/writer"
+)
+
+// MaxRequestBodyMiddleware returns middleware which limits request bodies to the given number of
+// bytes. Requests which declare a larger Content-Length are rejected with a 413 problem response
+// before reaching the handler. Otherwise, the body is wrapped with http.MaxBytesReader so that
+// reads beyond the limit fail with an *http.MaxBytesError. A limit of zero or less disables the
+// middleware.
+func MaxRequestBodyMiddleware(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				shErrors.WriteHTTP(w, r, shErrors.New(shErrors.RequestTooLarge, "request_too_large", "the request body is too large"))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TimeoutMiddleware returns middleware which bounds the time each handler may take to respond.
+// The timeout for a request is looked up in routeTimeouts by its route path template, falling
+// back to defaultTimeout. A timeout of zero disables the middleware for the route, so that, for
+// example, streaming endpoints may be excluded from a default timeout.
+//
+// When a handler exceeds its timeout, the request context is cancelled, a 503 problem response
+// is returned to the client, the overrun is counted in the `http_handler_timeouts_total` metric
+// and any further writes by the handler fail with http.ErrHandlerTimeout. Because the response
+// must be withheld until the handler completes, responses on routes with a timeout are buffered,
+// and the ResponseWriter passed to the handler implements neither http.Flusher nor
+// http.Hijacker. Streaming and WebSocket routes must therefore be given a timeout of zero. If the
+// handler panics, the panic is propagated with the stack of the handler. Note that this
+// middleware should be attached last so that the route is known and other middleware observe the
+// final response.
+func (m Metrics) TimeoutMiddleware(defaultTimeout time.Duration, routeTimeouts map[string]time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := writer.FetchRoutePathTemplate(r)
+			timeout := defaultTimeout
+			if routeTimeout, ok := routeTimeouts[path]; ok {
+				timeout = routeTimeout
+			}
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+			tw := &timeoutWriter{header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						// The handler runs on its own goroutine, so its stack is captured here to be
+						// included when the panic is propagated to the serving goroutine
+						if p != http.ErrAbortHandler {
+							p = handlerPanic{value: p, stack: debug.Stack()}
+						}
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.mutex.Lock()
+				defer tw.mutex.Unlock()
+				// The buffered headers replace the response headers so that headers removed by the
+				// handler are not sent
+				header := w.Header()
+				for key := range header {
+					if _, ok := tw.header[key]; !ok {
+						delete(header, key)
+					}
+				}
+				for key, values := range tw.header {
+					header[key] = values
+				}
+				if tw.statusCode == 0 {
+					tw.statusCode = http.StatusOK
+				}
+				w.WriteHeader(tw.statusCode)
+				_, _ = w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mutex.Lock()
+				defer tw.mutex.Unlock()
+				tw.timedOut = true
+				// If the client went away there is nobody to respond to
+				if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return
+				}
+				if m.handlerTimeouts != nil {
+					m.handlerTimeouts.With(prometheus.Labels{"path": path, "method": r.Method}).Inc()
+				}
+				shErrors.WriteHTTP(w, r, shErrors.New(shErrors.Unavailable, "handler_timeout", "the request did not complete in time"))
+			}
+		})
+	}
+}
+
+// handlerPanic is the value with which TimeoutMiddleware propagates a panic in a handler, which
+// includes the stack of the handler goroutine
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// Error returns the panic value followed by the stack of the handler
+func (hp handlerPanic) Error() string {
+	return fmt.Sprintf("%v\n\n%s", hp.value, hp.stack)
+}
+
+// Unwrap returns the panic value if it is an error
+func (hp handlerPanic) Unwrap() error {
+	err, _ := hp.value.(error)
+	return err
+}
+
+// timeoutWriter buffers the response of a handler run by TimeoutMiddleware until it completes
+type timeoutWriter struct {
+	header     http.Header
+	body       bytes.Buffer
+	mutex      sync.Mutex
+	statusCode int
+	timedOut   bool
+}
+
+// Header returns the buffered response headers
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// Write buffers the response body, failing with http.ErrHandlerTimeout once the handler has
+// timed out
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.statusCode == 0 {
+		tw.statusCode = http.StatusOK
+	}
+	return tw.body.Write(b)
+}
+
+// WriteHeader records the response status code
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.timedOut || tw.statusCode != 0 {
+		return
+	}
+	tw.statusCode = statusCode
+}
@@ -0,0 +1,201 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	shErrors "github.com/spothero/tools/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxRequestBodyMiddleware(t *testing.T) {
+	tests := []struct {
+		name               string
+		body               string
+		limit              int64
+		unknownLength      bool
+		expectedStatusCode int
+		expectReadError    bool
+	}{
+		{
+			name:               "bodies within the limit are read",
+			body:               "hello",
+			limit:              5,
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name:               "a limit of zero disables the middleware",
+			body:               "hello",
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name:               "bodies declared over the limit are rejected",
+			body:               "hello",
+			limit:              4,
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+		}, {
+			name:               "reading bodies of unknown length over the limit fails",
+			body:               "hello",
+			limit:              4,
+			unknownLength:      true,
+			expectedStatusCode: http.StatusOK,
+			expectReadError:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var readErr error
+			handler := MaxRequestBodyMiddleware(test.limit)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				_, readErr = io.ReadAll(r.Body)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			if test.unknownLength {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			if test.expectedStatusCode == http.StatusRequestEntityTooLarge {
+				assert.Equal(t, shErrors.ProblemContentType, rec.Header().Get("Content-Type"))
+			}
+			if test.expectReadError {
+				var maxBytesErr *http.MaxBytesError
+				assert.True(t, errors.As(readErr, &maxBytesErr))
+			} else {
+				assert.NoError(t, readErr)
+			}
+		})
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	tests := []struct {
+		name               string
+		path               string
+		routeTimeouts      map[string]time.Duration
+		expectedStatusCode int
+		expectTimeout      bool
+	}{
+		{
+			name:               "handlers which complete in time respond normally",
+			path:               "/fast",
+			expectedStatusCode: http.StatusCreated,
+		}, {
+			name:               "handlers which exceed the default timeout are cancelled",
+			path:               "/slow",
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectTimeout:      true,
+		}, {
+			name:               "route timeouts override the default timeout",
+			path:               "/slow",
+			routeTimeouts:      map[string]time.Duration{"/slow": time.Second},
+			expectedStatusCode: http.StatusCreated,
+		}, {
+			name:               "a route timeout of zero disables the timeout",
+			path:               "/slow",
+			routeTimeouts:      map[string]time.Duration{"/slow": 0},
+			expectedStatusCode: http.StatusCreated,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := NewMetrics(prometheus.NewRegistry(), true)
+			writeErrs := make(chan error, 1)
+			router := mux.NewRouter()
+			router.Use(metrics.TimeoutMiddleware(20*time.Millisecond, test.routeTimeouts))
+			respond := func(w http.ResponseWriter) {
+				w.Header().Set("X-Test", "test")
+				w.WriteHeader(http.StatusCreated)
+				_, err := w.Write([]byte("done"))
+				writeErrs <- err
+			}
+			router.HandleFunc("/fast", func(w http.ResponseWriter, _ *http.Request) {
+				respond(w)
+			})
+			router.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+				// ignore cancellation so that the write is always attempted after any timeout
+				time.Sleep(50 * time.Millisecond)
+				respond(w)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			assert.Equal(t, test.expectedStatusCode, rec.Code)
+			timeouts := testutil.ToFloat64(metrics.handlerTimeouts.With(prometheus.Labels{"path": test.path, "method": http.MethodGet}))
+			if test.expectTimeout {
+				assert.Equal(t, shErrors.ProblemContentType, rec.Header().Get("Content-Type"))
+				assert.Equal(t, float64(1), timeouts)
+				// the abandoned handler may no longer write to the response
+				select {
+				case err := <-writeErrs:
+					assert.ErrorIs(t, err, http.ErrHandlerTimeout)
+				case <-time.After(time.Second):
+					require.Fail(t, "handler did not complete")
+				}
+			} else {
+				assert.Equal(t, "test", rec.Header().Get("X-Test"))
+				assert.Equal(t, "done", rec.Body.String())
+				assert.Equal(t, float64(0), timeouts)
+			}
+		})
+	}
+}
+
+func TestTimeoutMiddlewareHeaders(t *testing.T) {
+	handler := Metrics{}.TimeoutMiddleware(time.Second, nil)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Del("X-Outer")
+		w.Header().Set("X-Test", "test")
+	}))
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Outer", "outer")
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "test", rec.Header().Get("X-Test"))
+	assert.NotContains(t, rec.Header(), "X-Outer")
+}
+
+func TestTimeoutMiddlewarePanic(t *testing.T) {
+	handler := Metrics{}.TimeoutMiddleware(time.Second, nil)(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("test")
+	}))
+	defer func() {
+		p := recover()
+		require.IsType(t, handlerPanic{}, p)
+		// the panic includes the stack of the handler rather than only that of the middleware
+		assert.Contains(t, p.(handlerPanic).Error(), "TestTimeoutMiddlewarePanic")
+		assert.Equal(t, "test", p.(handlerPanic).value)
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Fatal("the panic was not propagated")
+}
+
+func TestTimeoutMiddlewareAbortHandler(t *testing.T) {
+	handler := Metrics{}.TimeoutMiddleware(time.Second, nil)(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -15,14 +15,17 @@
 package http
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/cep21/circuit/v3"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spothero/tools/http/writer"
 	"github.com/spothero/tools/jose"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // UNAUTHENTICATED is the string used when the client is unknown
@@ -38,6 +41,56 @@ type Metrics struct {
 	clientDuration      *prometheus.HistogramVec
 	clientContentLength *prometheus.HistogramVec
 	circuitBreakerOpen  *prometheus.CounterVec
+	handlerTimeouts     *prometheus.CounterVec
+	inFlight            *prometheus.GaugeVec
+	responseSize        *prometheus.HistogramVec
+}
+
+// metricsOptions contains the optional configuration of a Metrics bundle
+type metricsOptions struct {
+	durationBuckets             []float64
+	nativeHistogramBucketFactor float64
+}
+
+// MetricsOption is a function that adds optional configuration to a Metrics bundle
+type MetricsOption func(*metricsOptions)
+
+// WithDurationBuckets sets the buckets of the server and client request duration histograms.
+// Defaults to powers of two from 1ms to 32768ms.
+func WithDurationBuckets(buckets []float64) MetricsOption {
+	return func(options *metricsOptions) {
+		options.durationBuckets = buckets
+	}
+}
+
+// WithNativeHistograms additionally records all histograms as Prometheus native histograms with
+// the given bucket factor, e.g. 1.1 for buckets growing by at most 10%. The classic buckets are
+// still exposed for scrapers which do not support native histograms.
+func WithNativeHistograms(bucketFactor float64) MetricsOption {
+	return func(options *metricsOptions) {
+		options.nativeHistogramBucketFactor = bucketFactor
+	}
+}
+
+// histogramOpts returns histogram options with the native histogram configuration applied
+func (o metricsOptions) histogramOpts(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	if o.nativeHistogramBucketFactor > 1 {
+		opts.NativeHistogramBucketFactor = o.nativeHistogramBucketFactor
+		opts.NativeHistogramMaxBucketNumber = 160
+		opts.NativeHistogramMinResetDuration = time.Hour
+	}
+	return opts
+}
+
+// observeWithExemplar records the value on the observer. If the given context carries a sampled
+// trace, the trace ID is attached to the observation as an exemplar.
+func observeWithExemplar(ctx context.Context, observer prometheus.Observer, value float64) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && spanContext.IsSampled() {
+		exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{"trace_id": spanContext.TraceID().String()})
+		return
+	}
+	observer.Observe(value)
 }
 
 // registerCollector will register the passed collector
@@ -61,14 +114,24 @@ func registerCollector(registry prometheus.Registerer, collector prometheus.Coll
 // specify an existing Prometheus Registry. If no Registry is provided, the global Prometheus
 // Registry is used.
 //
+// Duration buckets and native histograms may be configured with MetricsOptions. Duration
+// observations carry the trace ID of sampled OpenTelemetry traces as exemplars.
+//
 // Finally, if mustRegister is true and a registration error is encountered,
 // the application will panic.
 //
 // If mustRegister is false and registration failed due to the collector already being registered
 // then the existing collector will be returned.  But if registration failed for any other reason then
 // the application will panic.
-func NewMetrics(registry prometheus.Registerer, mustRegister bool) Metrics {
+func NewMetrics(registry prometheus.Registerer, mustRegister bool, opts ...MetricsOption) Metrics {
 	labels := []string{"path", "authenticated_client", "method"}
+	options := metricsOptions{
+		// Power of 2 time - 1ms, 2ms, 4ms ... 32768ms, +Inf ms
+		durationBuckets: prometheus.ExponentialBuckets(0.001, 2.0, 16),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
 
 	// If the user has not provided a Prometheus Registry, use the global Registry
 	if registry == nil {
@@ -88,23 +151,21 @@ func NewMetrics(registry prometheus.Registerer, mustRegister bool) Metrics {
 	labels = append(labels, "status_code")
 
 	histogram := prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "http_request_duration_seconds",
-			Help: "Total duration histogram for the HTTP request",
-			// Power of 2 time - 1ms, 2ms, 4ms ... 32768ms, +Inf ms
-			Buckets: prometheus.ExponentialBuckets(0.001, 2.0, 16),
-		},
+		options.histogramOpts(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Total duration histogram for the HTTP request",
+			Buckets: options.durationBuckets,
+		}),
 		labels,
 	)
 	histogram = registerCollector(registry, histogram, mustRegister).(*prometheus.HistogramVec)
 
 	clientHistogram := prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "http_client_request_duration_seconds",
-			Help: "Total duration histogram for the HTTP client requests",
-			// Power of 2 time - 1ms, 2ms, 4ms ... 32768ms, +Inf ms
-			Buckets: prometheus.ExponentialBuckets(0.001, 2.0, 16),
-		},
+		options.histogramOpts(prometheus.HistogramOpts{
+			Name:    "http_client_request_duration_seconds",
+			Help:    "Total duration histogram for the HTTP client requests",
+			Buckets: options.durationBuckets,
+		}),
 		labels,
 	)
 	clientHistogram = registerCollector(registry, clientHistogram, mustRegister).(*prometheus.HistogramVec)
@@ -128,23 +189,23 @@ func NewMetrics(registry prometheus.Registerer, mustRegister bool) Metrics {
 	clientCounter = registerCollector(registry, clientCounter, mustRegister).(*prometheus.CounterVec)
 
 	contentLength := prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
+		options.histogramOpts(prometheus.HistogramOpts{
 			Name: "http_content_length_bytes",
 			Help: "HTTP Request content length histogram, buckets range from 1B to 16MB",
 			// Power of 2 bytes, starts at 1 byte and works up to 16MB
 			Buckets: prometheus.ExponentialBuckets(1, 2.0, 24),
-		},
+		}),
 		labels,
 	)
 	contentLength = registerCollector(registry, contentLength, mustRegister).(*prometheus.HistogramVec)
 
 	clientContentLength := prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
+		options.histogramOpts(prometheus.HistogramOpts{
 			Name: "http_client_content_length_bytes",
 			Help: "HTTP Client Request content length histogram, buckets range from 1B to 16MB",
 			// Power of 2 bytes, starts at 1 byte and works up to 16MB
 			Buckets: prometheus.ExponentialBuckets(1, 2.0, 24),
-		},
+		}),
 		labels,
 	)
 	clientContentLength = registerCollector(registry, clientContentLength, mustRegister).(*prometheus.HistogramVec)
@@ -158,6 +219,35 @@ func NewMetrics(registry prometheus.Registerer, mustRegister bool) Metrics {
 	)
 	circuitBreakerOpen = registerCollector(registry, circuitBreakerOpen, mustRegister).(*prometheus.CounterVec)
 
+	handlerTimeouts := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_handler_timeouts_total",
+			Help: "Total number of HTTP requests whose handler exceeded its timeout",
+		},
+		[]string{"path", "method"},
+	)
+	handlerTimeouts = registerCollector(registry, handlerTimeouts, mustRegister).(*prometheus.CounterVec)
+
+	inFlight := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests currently being handled",
+		},
+		[]string{"path", "method"},
+	)
+	inFlight = registerCollector(registry, inFlight, mustRegister).(*prometheus.GaugeVec)
+
+	responseSize := prometheus.NewHistogramVec(
+		options.histogramOpts(prometheus.HistogramOpts{
+			Name: "http_response_size_bytes",
+			Help: "HTTP Response size histogram, buckets range from 1B to 16MB",
+			// Power of 2 bytes, starts at 1 byte and works up to 16MB
+			Buckets: prometheus.ExponentialBuckets(1, 2.0, 24),
+		}),
+		labels,
+	)
+	responseSize = registerCollector(registry, responseSize, mustRegister).(*prometheus.HistogramVec)
+
 	return Metrics{
 		requestCounter:      requestCounter,
 		responseCounter:     responseCounter,
@@ -167,12 +257,17 @@ func NewMetrics(registry prometheus.Registerer, mustRegister bool) Metrics {
 		contentLength:       contentLength,
 		clientContentLength: clientContentLength,
 		circuitBreakerOpen:  circuitBreakerOpen,
+		handlerTimeouts:     handlerTimeouts,
+		inFlight:            inFlight,
+		responseSize:        responseSize,
 	}
 }
 
-// Middleware provides standard HTTP middleware for recording prometheus metrics on every request.
+// Middleware provides standard HTTP middleware for recording prometheus metrics on every request,
+// including the number of requests in flight, the request duration and the response size.
 // Note that this middleware must be attached after writer.StatusRecorderMiddleware
-// for HTTP response code tagging to function.
+// for HTTP response code tagging and response size measurement to function, and after
+// tracing.HTTPServerMiddleware for duration exemplars to be recorded.
 func (m Metrics) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		labels := prometheus.Labels{
@@ -181,9 +276,13 @@ func (m Metrics) Middleware(next http.Handler) http.Handler {
 			"method":               r.Method,
 		}
 		m.requestCounter.With(labels).Inc()
+		inFlight := m.inFlight.With(prometheus.Labels{"path": labels["path"], "method": r.Method})
+		inFlight.Inc()
+		defer inFlight.Dec()
 
 		timer := prometheus.NewTimer(prometheus.ObserverFunc(func(durationSec float64) {
-			if statusRecorder, ok := w.(*writer.StatusRecorder); ok {
+			statusRecorder, recorded := writer.Recorder(w)
+			if recorded {
 				labels["status_code"] = strconv.Itoa(statusRecorder.StatusCode)
 			}
 			m.responseCounter.With(labels).Inc()
@@ -192,7 +291,10 @@ func (m Metrics) Middleware(next http.Handler) http.Handler {
 					m.contentLength.With(labels).Observe(float64(contentLength))
 				}
 			}
-			m.duration.With(labels).Observe(durationSec)
+			if recorded {
+				m.responseSize.With(labels).Observe(float64(statusRecorder.BytesWritten))
+			}
+			observeWithExemplar(r.Context(), m.duration.With(labels), durationSec)
 		}))
 		defer timer.ObserveDuration()
 		next.ServeHTTP(w, r)
@@ -230,7 +332,7 @@ func (metricsRT MetricsRoundTripper) RoundTrip(r *http.Request) (*http.Response,
 					metricsRT.Metrics.clientContentLength.With(labels).Observe(float64(contentLength))
 				}
 			}
-			metricsRT.Metrics.clientDuration.With(labels).Observe(durationSec)
+			observeWithExemplar(r.Context(), metricsRT.Metrics.clientDuration.With(labels), durationSec)
 		}
 		var circuitError circuit.Error
 		if err != nil && errors.As(err, &circuitError) && circuitError.CircuitOpen() {
@@ -23,12 +23,14 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/spothero/tools/http/mock"
 	"github.com/spothero/tools/http/writer"
 	"github.com/spothero/tools/jose"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type mockRegistry struct {
@@ -169,6 +171,9 @@ func TestMiddleware(t *testing.T) {
 	prometheus.Unregister(metrics.responseCounter)
 	prometheus.Unregister(metrics.clientCounter)
 	prometheus.Unregister(metrics.circuitBreakerOpen)
+	prometheus.Unregister(metrics.handlerTimeouts)
+	prometheus.Unregister(metrics.inFlight)
+	prometheus.Unregister(metrics.responseSize)
 }
 
 func TestMetricsRoundTrip(t *testing.T) {
@@ -289,6 +294,9 @@ func TestMetricsRoundTrip(t *testing.T) {
 			prometheus.Unregister(metricsRT.Metrics.responseCounter)
 			prometheus.Unregister(metricsRT.Metrics.clientCounter)
 			prometheus.Unregister(metricsRT.Metrics.circuitBreakerOpen)
+			prometheus.Unregister(metricsRT.Metrics.handlerTimeouts)
+			prometheus.Unregister(metricsRT.Metrics.inFlight)
+			prometheus.Unregister(metricsRT.Metrics.responseSize)
 		})
 	}
 }
@@ -332,3 +340,85 @@ func TestRetrieveAuthenticatedClient(t *testing.T) {
 		})
 	}
 }
+
+func TestMiddlewareResponseMetrics(t *testing.T) {
+	tests := []struct {
+		name             string
+		opts             []MetricsOption
+		sampled          bool
+		expectExemplar   bool
+		expectNative     bool
+		expectedMaxBound float64
+	}{
+		{
+			name:             "default buckets are used without exemplars for unsampled requests",
+			expectedMaxBound: 32.768,
+		}, {
+			name:             "sampled requests record the trace id as an exemplar",
+			sampled:          true,
+			expectExemplar:   true,
+			expectedMaxBound: 32.768,
+		}, {
+			name:             "duration buckets may be configured",
+			opts:             []MetricsOption{WithDurationBuckets([]float64{0.1, 1, 10})},
+			expectedMaxBound: 10,
+		}, {
+			name:             "native histograms may be enabled",
+			opts:             []MetricsOption{WithNativeHistograms(1.1)},
+			expectNative:     true,
+			expectedMaxBound: 32.768,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			metrics := NewMetrics(registry, true, test.opts...)
+			inFlightLabels := prometheus.Labels{"path": "/items", "method": http.MethodGet}
+			router := mux.NewRouter()
+			router.Use(writer.StatusRecorderMiddleware, metrics.Middleware)
+			router.HandleFunc("/items", func(w http.ResponseWriter, _ *http.Request) {
+				assert.Equal(t, float64(1), testutil.ToFloat64(metrics.inFlight.With(inFlightLabels)))
+				_, _ = w.Write([]byte("hello"))
+			})
+
+			traceID := trace.TraceID{1, 2, 3}
+			spanContext := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: trace.SpanID{1}})
+			if test.sampled {
+				spanContext = spanContext.WithTraceFlags(trace.FlagsSampled)
+			}
+			ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil).WithContext(ctx))
+			assert.Equal(t, float64(0), testutil.ToFloat64(metrics.inFlight.With(inFlightLabels)))
+
+			labels := prometheus.Labels{
+				"path":                 "/items",
+				"authenticated_client": UNAUTHENTICATED,
+				"method":               http.MethodGet,
+				"status_code":          "200",
+			}
+			pb := &dto.Metric{}
+			require.NoError(t, metrics.responseSize.With(labels).(prometheus.Histogram).Write(pb))
+			assert.Equal(t, float64(5), pb.Histogram.GetSampleSum())
+
+			pb = &dto.Metric{}
+			require.NoError(t, metrics.duration.With(labels).(prometheus.Histogram).Write(pb))
+			buckets := pb.Histogram.GetBucket()
+			require.NotEmpty(t, buckets)
+			assert.InDelta(t, test.expectedMaxBound, buckets[len(buckets)-1].GetUpperBound(), 0.0001)
+			assert.Equal(t, test.expectNative, pb.Histogram.Schema != nil)
+			var exemplarTraceID string
+			for _, bucket := range buckets {
+				for _, label := range bucket.GetExemplar().GetLabel() {
+					if label.GetName() == "trace_id" {
+						exemplarTraceID = label.GetValue()
+					}
+				}
+			}
+			if test.expectExemplar {
+				assert.Equal(t, traceID.String(), exemplarTraceID)
+			} else {
+				assert.Empty(t, exemplarTraceID)
+			}
+		})
+	}
+}
@@ -15,8 +15,10 @@
 package http
 
 import (
-	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -24,10 +26,15 @@ import (
 	"go.uber.org/zap"
 )
 
+// maxDrainBytes is the largest response body read from a discarded response so that its
+// connection may be reused. Larger bodies are closed without being read.
+const maxDrainBytes = 64 << 10
+
 // RetryRoundTripper wraps a roundtripper with retry logic
 type RetryRoundTripper struct {
 	RoundTripper         http.RoundTripper
 	RetriableStatusCodes map[int]bool
+	Budget               *RetryBudget // If set, caps retries to each host as a fraction of requests
 	InitialInterval      time.Duration
 	RandomizationFactor  float64
 	Multiplier           float64
@@ -35,13 +42,43 @@ type RetryRoundTripper struct {
 	MaxRetries           uint8
 }
 
+// RetryBudgetConfig defines the configuration of a RetryBudget
+type RetryBudgetConfig struct {
+	Ratio               float64       // Maximum number of retries to each host as a fraction of requests. Defaults to 0.2.
+	MinRetriesPerSecond float64       // Retries permitted per second regardless of the ratio, so that hosts receiving few requests may be retried. Defaults to 10.
+	Window              time.Duration // Period over which requests and retries are counted. Defaults to 10 seconds.
+}
+
+// RetryBudget limits the number of retries sent to each host to a fraction of the requests sent to
+// it, so that retries cannot multiply the load on a host which is failing. Requests and retries
+// are counted over a sliding window. Hosts which have received no requests for two windows are
+// forgotten.
+type RetryBudget struct {
+	hosts               map[string]*retryWindow
+	evicted             time.Time // When idle hosts were last removed from hosts
+	mutex               *sync.Mutex
+	ratio               float64
+	minRetriesPerSecond float64
+	window              time.Duration
+}
+
+// retryWindow counts the requests and retries sent to a host in the current and previous windows
+type retryWindow struct {
+	start            time.Time
+	requests         float64
+	retries          float64
+	previousRequests float64
+	previousRetries  float64
+}
+
 // NewDefaultRetryRoundTripper constructs and returns the default RetryRoundTripper configuration.
 //
-// By default, the round tripper provides exponential backoff on [500-504] errors. The default
-// configuration for exponential backoff is to start with an interval of 100 milliseconds, a
-// multiplier of two, a randomization factor of up to 0.5 milliseconds (for jitter), a max
+// By default, the round tripper provides exponential backoff on 429 and [500-504] errors. The
+// default configuration for exponential backoff is to start with an interval of 100 milliseconds,
+// a multiplier of two, a randomization factor of up to 0.5 milliseconds (for jitter), a max
 // interval of 10 seconds, and finally, the retry will attempt 5 times before failing if the
-// error is retriable.
+// error is retriable. Retries to each host are limited to 20% of requests, plus 10 retries per
+// second, over a 10 second window.
 func NewDefaultRetryRoundTripper(roundTripper http.RoundTripper) RetryRoundTripper {
 	// Ensure the RoundTripper was set on the CircuitBreakerRoundTripper
 	if roundTripper == nil {
@@ -50,11 +87,13 @@ func NewDefaultRetryRoundTripper(roundTripper http.RoundTripper) RetryRoundTripp
 	return RetryRoundTripper{
 		RoundTripper: roundTripper,
 		RetriableStatusCodes: map[int]bool{
+			http.StatusTooManyRequests:     true,
 			http.StatusInternalServerError: true,
 			http.StatusBadGateway:          true,
 			http.StatusServiceUnavailable:  true,
 			http.StatusGatewayTimeout:      true,
 		},
+		Budget:              RetryBudgetConfig{}.NewRetryBudget(),
 		InitialInterval:     100 * time.Millisecond,
 		Multiplier:          2,
 		MaxInterval:         10 * time.Second,
@@ -64,53 +103,237 @@ func NewDefaultRetryRoundTripper(roundTripper http.RoundTripper) RetryRoundTripp
 }
 
 // RoundTrip completes the http request round trip but attempts retries for configured error codes
+// and failures to get a response.
+//
+// Only requests with idempotent methods, or with an Idempotency-Key header, are retried. Request
+// bodies are rewound for each retry with GetBody, which is set by http.NewRequest for common body
+// types, and requests with a body but no GetBody are not retried. When a 429 or 503 response
+// includes a Retry-After header, the retry waits for the given time instead of the backoff
+// interval, and the response is returned without retrying if that time exceeds MaxInterval. If a
+// Budget is set, no further retries are made once the budget for the host is exhausted. The
+// bodies of discarded responses are drained and closed before waiting to retry, so that their
+// connections may be reused. If the request context is done while waiting, its error is returned.
 func (rrt RetryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	// Ensure the RoundTripper was set on the RetryRoundTripper
 	if rrt.RoundTripper == nil {
 		panic("no roundtripper provided to retry round tripper")
 	}
+	logger := log.Get(req.Context())
+	if rrt.Budget != nil {
+		rrt.Budget.recordRequest(req.URL.Host, time.Now())
+	}
 
-	var resp *http.Response
-	var err error
-	makeRequestRetriable := func() error {
-		resp, err = rrt.RoundTripper.RoundTrip(req)
+	// Each backoff policy contains state, so unfortunately we must create a fresh backoff
+	// policy for every request
+	expBackOff := backoff.NewExponentialBackOff()
+	expBackOff.InitialInterval = rrt.InitialInterval
+	expBackOff.Multiplier = rrt.Multiplier
+	expBackOff.MaxInterval = rrt.MaxInterval
+	expBackOff.RandomizationFactor = rrt.RandomizationFactor
+	expBackOff.Reset()
+	backoffPolicy := backoff.WithMaxRetries(expBackOff, uint64(rrt.MaxRetries))
 
-		// If an error was encountered, retry. This typically indicates a failure to get a
-		// response.
-		if err != nil {
-			log.Get(req.Context()).Debug("retrying failed http request", zap.Error(err))
-			return err
+	attempt := req
+	for {
+		resp, err := rrt.RoundTripper.RoundTrip(attempt)
+		if !rrt.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		if !retryAllowed(req) {
+			logger.Debug("could not retry non-idempotent http request", zap.String("http.method", req.Method))
+			return resp, err
 		}
+		wait := backoffPolicy.NextBackOff()
+		if wait == backoff.Stop {
+			logger.Debug("failed retrying http request")
+			return resp, err
+		}
+		if retryAfter, ok := retryAfterDelay(resp, time.Now()); ok {
+			if rrt.MaxInterval > 0 && retryAfter > rrt.MaxInterval {
+				logger.Debug("could not retry http request before retry-after", zap.Duration("retry_after", retryAfter))
+				return resp, err
+			}
+			wait = retryAfter
+		}
+		if rrt.Budget != nil && !rrt.Budget.withdraw(req.URL.Host, time.Now()) {
+			logger.Debug("retry budget exhausted for host", zap.String("http.host", req.URL.Host))
+			return resp, err
+		}
+		next, rewindErr := rewindRequest(req)
+		if rewindErr != nil {
+			logger.Debug("could not rewind http request body for retry", zap.Error(rewindErr))
+			return resp, err
+		}
+		// The discarded response is released before waiting so that its connection is not held
+		drainResponse(resp)
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		attempt = next
+	}
+}
+
+// shouldRetry returns true if the outcome of an attempt is a failure which may be retried
+func (rrt RetryRoundTripper) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	// If an error was encountered, retry. This typically indicates a failure to get a
+	// response.
+	if err != nil {
+		log.Get(req.Context()).Debug("retrying failed http request", zap.Error(err))
+		return true
+	}
 
-		// If no error was encountered, return immediately
-		if resp.StatusCode < http.StatusBadRequest {
-			return nil
+	// If no error was encountered, return immediately
+	if resp.StatusCode < http.StatusBadRequest {
+		return false
+	}
+
+	// Check to see if this status code is retriable
+	if _, ok := rrt.RetriableStatusCodes[resp.StatusCode]; ok {
+		log.Get(req.Context()).Debug("retrying retriable http request", zap.Int("http.status_code", resp.StatusCode))
+		return true
+	}
+
+	// The status code is not retriable
+	log.Get(req.Context()).Debug("could not retry failed http request", zap.Int("http.status_code", resp.StatusCode))
+	return false
+}
+
+// retryAllowed returns true if the request may safely be sent again, because its method is
+// idempotent or it carries an Idempotency-Key, and its body, if any, can be rewound
+func retryAllowed(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+	default:
+		if req.Header.Get("Idempotency-Key") == "" {
+			return false
 		}
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
 
-		// Check to see if this status code is retriable
-		if _, ok := rrt.RetriableStatusCodes[resp.StatusCode]; ok {
-			log.Get(req.Context()).Debug("retrying retriable http request", zap.Int("http.status_code", resp.StatusCode))
-			return fmt.Errorf("status code `%v` is retriable", resp.StatusCode)
+// rewindRequest returns the request to send as a retry, with a fresh copy of its body if it has one
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	next := req.Clone(req.Context())
+	next.Body = body
+	return next, nil
+}
+
+// retryAfterDelay returns the delay requested by the Retry-After header of a 429 or 503 response,
+// given either as a number of seconds or as an HTTP date
+func retryAfterDelay(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
 		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(date.Sub(now), 0), true
+}
 
-		// The status code is not retriable
-		log.Get(req.Context()).Debug("could not retry failed http request", zap.Int("http.status_code", resp.StatusCode))
-		return nil
+// drainResponse reads the remainder of a discarded response body, up to a limit, and closes it so
+// that the underlying connection may be reused
+func drainResponse(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
 	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	_ = resp.Body.Close()
+}
 
-	// Each backoff policy contains state, so unfortunately we must create a fresh backoff
-	// policy for every request
-	expBackOff := backoff.NewExponentialBackOff()
-	expBackOff.InitialInterval = rrt.InitialInterval
-	expBackOff.Multiplier = rrt.Multiplier
-	expBackOff.MaxInterval = rrt.MaxInterval
-	expBackOff.RandomizationFactor = rrt.RandomizationFactor
-	backoffPolicy := backoff.WithContext(
-		backoff.WithMaxRetries(expBackOff, uint64(rrt.MaxRetries)),
-		req.Context(),
-	)
-	if retryErr := backoff.Retry(makeRequestRetriable, backoffPolicy); retryErr != nil {
-		log.Get(req.Context()).Debug("failed retrying http request")
-	}
-	return resp, err
+// NewRetryBudget creates a RetryBudget from the RetryBudgetConfig. The RetryBudget should be
+// shared by all RetryRoundTrippers sending requests to the same hosts.
+func (c RetryBudgetConfig) NewRetryBudget() *RetryBudget {
+	rb := &RetryBudget{
+		hosts:               make(map[string]*retryWindow),
+		mutex:               &sync.Mutex{},
+		ratio:               c.Ratio,
+		minRetriesPerSecond: c.MinRetriesPerSecond,
+		window:              c.Window,
+	}
+	if rb.ratio <= 0 {
+		rb.ratio = 0.2
+	}
+	if rb.minRetriesPerSecond <= 0 {
+		rb.minRetriesPerSecond = 10
+	}
+	if rb.window <= 0 {
+		rb.window = 10 * time.Second
+	}
+	return rb
+}
+
+// recordRequest counts a request to the given host
+func (rb *RetryBudget) recordRequest(host string, now time.Time) {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+	rb.hostWindow(host, now).requests++
+}
+
+// withdraw counts a retry to the given host and returns true if the budget for the host permits
+// it. Retries which are not permitted are not counted.
+func (rb *RetryBudget) withdraw(host string, now time.Time) bool {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+	w := rb.hostWindow(host, now)
+	// The previous window is weighted by the fraction of it which overlaps the sliding window
+	weight := 1 - float64(now.Sub(w.start))/float64(rb.window)
+	requests := w.requests + w.previousRequests*weight
+	retries := w.retries + w.previousRetries*weight
+	if retries+1 > rb.minRetriesPerSecond*rb.window.Seconds()+rb.ratio*requests {
+		return false
+	}
+	w.retries++
+	return true
+}
+
+// hostWindow returns the counts of the given host, advanced to the window containing now
+func (rb *RetryBudget) hostWindow(host string, now time.Time) *retryWindow {
+	// Hosts idle for two windows have no counts left, so at most once per window they are removed
+	// to bound the memory held for clients calling many hosts
+	if now.Sub(rb.evicted) >= rb.window {
+		rb.evicted = now
+		for name, idle := range rb.hosts {
+			if now.Sub(idle.start) >= 2*rb.window {
+				delete(rb.hosts, name)
+			}
+		}
+	}
+	w, ok := rb.hosts[host]
+	if !ok {
+		w = &retryWindow{start: now}
+		rb.hosts[host] = w
+	}
+	switch elapsed := now.Sub(w.start); {
+	case elapsed >= 2*rb.window:
+		*w = retryWindow{start: now}
+	case elapsed >= rb.window:
+		*w = retryWindow{
+			start:            w.start.Add(rb.window),
+			previousRequests: w.requests,
+			previousRetries:  w.retries,
+		}
+	}
+	return w
 }
@@ -15,13 +15,18 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/spothero/tools/http/mock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewDefaultRetryRoundTripper(t *testing.T) {
@@ -51,11 +56,13 @@ func TestNewDefaultRetryRoundTripper(t *testing.T) {
 					RetryRoundTripper{
 						RoundTripper: test.roundTripper,
 						RetriableStatusCodes: map[int]bool{
+							http.StatusTooManyRequests:     true,
 							http.StatusInternalServerError: true,
 							http.StatusBadGateway:          true,
 							http.StatusServiceUnavailable:  true,
 							http.StatusGatewayTimeout:      true,
 						},
+						Budget:              RetryBudgetConfig{}.NewRetryBudget(),
 						InitialInterval:     100 * time.Millisecond,
 						Multiplier:          2,
 						MaxInterval:         10 * time.Second,
@@ -165,3 +172,262 @@ func TestRetryRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+// trackedBody is a response body which records whether it was read to the end and closed
+type trackedBody struct {
+	io.Reader
+	drained bool
+	closed  bool
+}
+
+func (tb *trackedBody) Read(p []byte) (int, error) {
+	n, err := tb.Reader.Read(p)
+	if err == io.EOF {
+		tb.drained = true
+	}
+	return n, err
+}
+
+func (tb *trackedBody) Close() error {
+	tb.closed = true
+	return nil
+}
+
+// recordingRoundTripper returns the given responses in turn and records the request bodies sent
+type recordingRoundTripper struct {
+	responses []*http.Response
+	bodies    []string
+}
+
+func (rrt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = string(b)
+	}
+	resp := rrt.responses[len(rrt.bodies)]
+	rrt.bodies = append(rrt.bodies, body)
+	return resp, nil
+}
+
+// newResponse creates a response with the given status code, Retry-After header and a tracked body
+func newResponse(statusCode int, retryAfter string) *http.Response {
+	resp := &http.Response{StatusCode: statusCode, Header: http.Header{}, Body: &trackedBody{Reader: strings.NewReader("body")}}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestRetryRoundTripRequests(t *testing.T) {
+	tests := []struct {
+		newRequest         func() *http.Request
+		name               string
+		responses          []*http.Response
+		expectedBodies     []string
+		expectedStatusCode int
+	}{
+		{
+			name: "request bodies are rewound for each retry",
+			newRequest: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPut, "/spots/1", strings.NewReader(`{"name":"wrigley"}`))
+				req.GetBody = func() (io.ReadCloser, error) {
+					return io.NopCloser(strings.NewReader(`{"name":"wrigley"}`)), nil
+				}
+				return req
+			},
+			responses:          []*http.Response{newResponse(http.StatusServiceUnavailable, ""), newResponse(http.StatusOK, "")},
+			expectedBodies:     []string{`{"name":"wrigley"}`, `{"name":"wrigley"}`},
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name: "requests with bodies which cannot be rewound are not retried",
+			newRequest: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPut, "http://spothero.com/spots/1", io.NopCloser(strings.NewReader("body")))
+				return req
+			},
+			responses:          []*http.Response{newResponse(http.StatusServiceUnavailable, ""), newResponse(http.StatusOK, "")},
+			expectedBodies:     []string{"body"},
+			expectedStatusCode: http.StatusServiceUnavailable,
+		}, {
+			name: "non-idempotent requests are not retried",
+			newRequest: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPost, "http://spothero.com/reservations", bytes.NewReader([]byte("body")))
+				return req
+			},
+			responses:          []*http.Response{newResponse(http.StatusServiceUnavailable, ""), newResponse(http.StatusOK, "")},
+			expectedBodies:     []string{"body"},
+			expectedStatusCode: http.StatusServiceUnavailable,
+		}, {
+			name: "non-idempotent requests with an idempotency key are retried",
+			newRequest: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPost, "http://spothero.com/reservations", bytes.NewReader([]byte("body")))
+				req.Header.Set("Idempotency-Key", "abc")
+				return req
+			},
+			responses:          []*http.Response{newResponse(http.StatusServiceUnavailable, ""), newResponse(http.StatusOK, "")},
+			expectedBodies:     []string{"body", "body"},
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name: "retry-after is honored when within the max interval",
+			newRequest: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/spots", nil)
+			},
+			responses:          []*http.Response{newResponse(http.StatusTooManyRequests, "0"), newResponse(http.StatusOK, "")},
+			expectedBodies:     []string{"", ""},
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name: "responses are returned when retry-after exceeds the max interval",
+			newRequest: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/spots", nil)
+			},
+			responses:          []*http.Response{newResponse(http.StatusServiceUnavailable, "120"), newResponse(http.StatusOK, "")},
+			expectedBodies:     []string{""},
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roundTripper := &recordingRoundTripper{responses: test.responses}
+			rrt := RetryRoundTripper{
+				RoundTripper: roundTripper,
+				RetriableStatusCodes: map[int]bool{
+					http.StatusTooManyRequests:    true,
+					http.StatusServiceUnavailable: true,
+				},
+				MaxRetries:      3,
+				InitialInterval: time.Nanosecond,
+				MaxInterval:     time.Second,
+			}
+			resp, err := rrt.RoundTrip(test.newRequest())
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatusCode, resp.StatusCode)
+			assert.Equal(t, test.expectedBodies, roundTripper.bodies)
+			// discarded responses are drained and closed, while the returned response is not
+			for i, response := range test.responses[:len(roundTripper.bodies)-1] {
+				body := response.Body.(*trackedBody)
+				assert.Truef(t, body.drained && body.closed, "response %d was not drained and closed", i)
+			}
+			assert.False(t, resp.Body.(*trackedBody).closed)
+		})
+	}
+}
+
+func TestRetryRoundTripCancelled(t *testing.T) {
+	responses := []*http.Response{newResponse(http.StatusServiceUnavailable, "1"), newResponse(http.StatusOK, "")}
+	rrt := RetryRoundTripper{
+		RoundTripper:         &recordingRoundTripper{responses: responses},
+		RetriableStatusCodes: map[int]bool{http.StatusServiceUnavailable: true},
+		MaxRetries:           3,
+		InitialInterval:      time.Nanosecond,
+		MaxInterval:          time.Minute,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp, err := rrt.RoundTrip(httptest.NewRequest(http.MethodGet, "/spots", nil).WithContext(ctx))
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, context.Canceled)
+	// the discarded response is released before waiting for the retry
+	body := responses[0].Body.(*trackedBody)
+	assert.True(t, body.drained && body.closed)
+}
+
+func TestRetryRoundTripBudget(t *testing.T) {
+	roundTripper := &mock.RoundTripper{ResponseStatusCodes: []int{
+		http.StatusInternalServerError,
+		http.StatusInternalServerError,
+		http.StatusInternalServerError,
+		http.StatusInternalServerError,
+	}}
+	rrt := RetryRoundTripper{
+		RoundTripper:         roundTripper,
+		RetriableStatusCodes: map[int]bool{http.StatusInternalServerError: true},
+		Budget:               RetryBudgetConfig{Ratio: 0.1, MinRetriesPerSecond: 0.1, Window: 10 * time.Second}.NewRetryBudget(),
+		MaxRetries:           3,
+		InitialInterval:      time.Nanosecond,
+	}
+	resp, err := rrt.RoundTrip(httptest.NewRequest(http.MethodGet, "/spots", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	// the budget permits a single retry before it is exhausted
+	assert.Equal(t, 2, roundTripper.CallNumber)
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		statusCode    int
+		retryAfter    string
+		expectedDelay time.Duration
+		expectedOK    bool
+	}{
+		{"seconds are parsed", http.StatusServiceUnavailable, "3", 3 * time.Second, true},
+		{"dates are parsed", http.StatusTooManyRequests, now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second, true},
+		{"past dates result in no delay", http.StatusTooManyRequests, now.Add(-5 * time.Second).Format(http.TimeFormat), 0, true},
+		{"invalid values are ignored", http.StatusServiceUnavailable, "soon", 0, false},
+		{"negative values are ignored", http.StatusServiceUnavailable, "-1", 0, false},
+		{"missing headers are ignored", http.StatusServiceUnavailable, "", 0, false},
+		{"other status codes are ignored", http.StatusInternalServerError, "3", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delay, ok := retryAfterDelay(newResponse(test.statusCode, test.retryAfter), now)
+			assert.Equal(t, test.expectedOK, ok)
+			assert.Equal(t, test.expectedDelay, delay)
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	budget := RetryBudgetConfig{Ratio: 0.5, MinRetriesPerSecond: 0.1, Window: 10 * time.Second}.NewRetryBudget()
+
+	// one retry is always permitted by the minimum rate
+	assert.True(t, budget.withdraw("spothero.com", start))
+	assert.False(t, budget.withdraw("spothero.com", start))
+
+	// requests add to the budget at the configured ratio
+	for i := 0; i < 4; i++ {
+		budget.recordRequest("spothero.com", start)
+	}
+	assert.True(t, budget.withdraw("spothero.com", start))
+	assert.True(t, budget.withdraw("spothero.com", start))
+	assert.False(t, budget.withdraw("spothero.com", start))
+
+	// budgets are kept per host
+	assert.True(t, budget.withdraw("api.spothero.com", start))
+
+	// the previous window counts in proportion to its overlap with the sliding window
+	assert.False(t, budget.withdraw("spothero.com", start.Add(12*time.Second)))
+	for i := 0; i < 4; i++ {
+		budget.recordRequest("spothero.com", start.Add(15*time.Second))
+	}
+	assert.True(t, budget.withdraw("spothero.com", start.Add(15*time.Second)))
+
+	// counts expire once the window has passed
+	budget.recordRequest("spothero.com", start.Add(time.Minute))
+	assert.True(t, budget.withdraw("spothero.com", start.Add(time.Minute)))
+}
+
+func TestRetryBudgetEviction(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	budget := RetryBudgetConfig{Window: 10 * time.Second}.NewRetryBudget()
+	budget.recordRequest("spothero.com", start)
+	budget.recordRequest("api.spothero.com", start.Add(15*time.Second))
+	assert.Len(t, budget.hosts, 2)
+
+	// hosts idle for two windows are removed when another host is counted
+	budget.recordRequest("api.spothero.com", start.Add(25*time.Second))
+	assert.Len(t, budget.hosts, 1)
+	assert.Contains(t, budget.hosts, "api.spothero.com")
+}
+
+func TestNewRetryBudget(t *testing.T) {
+	budget := RetryBudgetConfig{}.NewRetryBudget()
+	assert.Equal(t, 0.2, budget.ratio)
+	assert.Equal(t, 10.0, budget.minRetriesPerSecond)
+	assert.Equal(t, 10*time.Second, budget.window)
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/spothero/tools/jose"
+	"google.golang.org/grpc"
+)
+
+// RouteInfo describes a route registered with a mux.Router. Authenticated is only set for routes
+// whose handler is known to enforce authentication, and is otherwise omitted rather than false,
+// since authentication enforced by router middleware cannot be detected.
+type RouteInfo struct {
+	Name           string   `json:"name,omitempty"`
+	Host           string   `json:"host,omitempty"`
+	Path           string   `json:"path"`
+	Timeout        string   `json:"timeout,omitempty"`
+	Methods        []string `json:"methods,omitempty"`
+	RequiredScopes []string `json:"required_scopes,omitempty"`
+	Middleware     []string `json:"middleware,omitempty"`
+	Authenticated  bool     `json:"authenticated,omitempty"`
+}
+
+// GRPCMethodInfo describes a method of a registered gRPC service
+type GRPCMethodInfo struct {
+	Name            string `json:"name"`
+	FullMethod      string `json:"full_method"`
+	ClientStreaming bool   `json:"client_streaming"`
+	ServerStreaming bool   `json:"server_streaming"`
+}
+
+// GRPCServiceInfo describes a registered gRPC service and its methods
+type GRPCServiceInfo struct {
+	Name    string           `json:"name"`
+	Methods []GRPCMethodInfo `json:"methods"`
+}
+
+// RouteInventory lists the HTTP routes and gRPC services exposed by a server
+type RouteInventory struct {
+	HTTP []RouteInfo       `json:"http"`
+	GRPC []GRPCServiceInfo `json:"grpc,omitempty"`
+}
+
+// GRPCServiceLister is implemented by gRPC servers, such as *grpc.Server, whose registered
+// services are listed in the route inventory
+type GRPCServiceLister interface {
+	GetServiceInfo() map[string]grpc.ServiceInfo
+}
+
+// namedMiddleware is a handler for a single route wrapped with named middleware
+type namedMiddleware struct {
+	http.Handler
+	next http.Handler
+	name string
+}
+
+// Unwrap returns the handler wrapped by the middleware
+func (nm namedMiddleware) Unwrap() http.Handler {
+	return nm.next
+}
+
+// MiddlewareName returns the name of the middleware
+func (nm namedMiddleware) MiddlewareName() string {
+	return nm.name
+}
+
+// RouteMiddleware returns middleware for the handler of a single route which applies the given
+// middleware and records its name, so that the middleware is listed for the route in the route
+// inventory. For example:
+//
+//	router.Handle("/v1/reservations", shHTTP.RouteMiddleware("idempotency", idempotent)(handler))
+func RouteMiddleware(name string, middleware mux.MiddlewareFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return namedMiddleware{Handler: middleware(next), next: next, name: name}
+	}
+}
+
+// Routes walks the router, including any subrouters, and describes each route with a handler in
+// the order in which the routes are matched. Handlers are inspected for the middleware applied
+// with RouteMiddleware and the scopes required by a jose.AuthorizedHandler, following handlers
+// which implement `Unwrap() http.Handler`. Middleware applied to a router with Use is not listed.
+func Routes(router *mux.Router) []RouteInfo {
+	routes := make([]RouteInfo, 0)
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		handler := route.GetHandler()
+		if handler == nil {
+			return nil
+		}
+		info := RouteInfo{Name: route.GetName()}
+		if host, err := route.GetHostTemplate(); err == nil {
+			info.Host = host
+		}
+		if path, err := route.GetPathTemplate(); err == nil {
+			info.Path = path
+		}
+		if methods, err := route.GetMethods(); err == nil {
+			info.Methods = methods
+		}
+		describeHandler(handler, &info)
+		routes = append(routes, info)
+		return nil
+	})
+	return routes
+}
+
+// describeHandler records the middleware and authorization requirements of the handler and the
+// handlers it wraps on the RouteInfo
+func describeHandler(handler http.Handler, info *RouteInfo) {
+	for handler != nil {
+		if named, ok := handler.(interface{ MiddlewareName() string }); ok {
+			info.Middleware = append(info.Middleware, named.MiddlewareName())
+		}
+		if authorized, ok := handler.(jose.AuthorizedHandler); ok {
+			info.Authenticated = true
+			info.RequiredScopes = append(info.RequiredScopes, authorized.Params.RequiredScopes...)
+		}
+		unwrapper, ok := handler.(interface{ Unwrap() http.Handler })
+		if !ok {
+			return
+		}
+		handler = unwrapper.Unwrap()
+	}
+}
+
+// GRPCServices describes the services registered with the gRPC server, sorted by name. Methods are
+// listed in the order in which they were registered.
+func GRPCServices(server GRPCServiceLister) []GRPCServiceInfo {
+	services := make([]GRPCServiceInfo, 0)
+	for name, info := range server.GetServiceInfo() {
+		service := GRPCServiceInfo{Name: name, Methods: make([]GRPCMethodInfo, 0, len(info.Methods))}
+		for _, method := range info.Methods {
+			service.Methods = append(service.Methods, GRPCMethodInfo{
+				Name:            method.Name,
+				FullMethod:      "/" + name + "/" + method.Name,
+				ClientStreaming: method.IsClientStream,
+				ServerStreaming: method.IsServerStream,
+			})
+		}
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	return services
+}
+
+// routesHandler returns a handler which writes the route inventory of the router, and of the gRPC
+// server if one is configured, as JSON. Routes are annotated with the handler timeout configured
+// for them. The inventory is built on each request so that it includes routes registered after
+// the handler.
+func (c Config) routesHandler(router *mux.Router) http.Handler {
+	grpcServer := c.GRPCServer
+	if grpcServer == nil {
+		grpcServer, _ = c.GRPCHandler.(GRPCServiceLister)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		inventory := RouteInventory{HTTP: Routes(router)}
+		for i, route := range inventory.HTTP {
+			timeout := c.HandlerTimeout
+			if routeTimeout, ok := c.RouteTimeouts[route.Path]; ok {
+				timeout = routeTimeout
+			}
+			if timeout > 0 {
+				inventory.HTTP[i].Timeout = timeout.String()
+			}
+		}
+		if grpcServer != nil {
+			inventory.GRPC = GRPCServices(grpcServer)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(inventory)
+	})
+}
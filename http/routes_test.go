@@ -0,0 +1,177 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spothero/tools/jose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// registerInventoryRoutes registers routes exercising each feature of the route inventory
+func registerInventoryRoutes(router *mux.Router) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router.Handle("/v1/spots", handler).Methods(http.MethodGet).Name("list-spots")
+	router.Handle(
+		"/v1/spots/{id}",
+		jose.EnforceAuthenticationWithAuthorization(handler, jose.AuthParams{RequiredScopes: []string{"update:spots"}}),
+	).Methods(http.MethodPut, http.MethodPatch)
+	router.Handle(
+		"/v1/spots/{id}/photos",
+		jose.EnforceAuthenticationWithAuthorization(handler, jose.AuthParams{RequiredScopes: []string{"update:photos"}}),
+	).Methods(http.MethodPost)
+	reservations := router.PathPrefix("/v1/reservations").Subrouter()
+	reservations.Handle("", RouteMiddleware("idempotency", func(next http.Handler) http.Handler {
+		return next
+	})(jose.EnforceAuthenticationWithAuthorization(handler, jose.AuthParams{}))).Methods(http.MethodPost)
+}
+
+func TestRoutes(t *testing.T) {
+	router := mux.NewRouter()
+	registerInventoryRoutes(router)
+	assert.Equal(t, []RouteInfo{
+		{
+			Name:    "list-spots",
+			Path:    "/v1/spots",
+			Methods: []string{http.MethodGet},
+		}, {
+			Path:           "/v1/spots/{id}",
+			Methods:        []string{http.MethodPut, http.MethodPatch},
+			RequiredScopes: []string{"update:spots"},
+			Authenticated:  true,
+		}, {
+			Path:           "/v1/spots/{id}/photos",
+			Methods:        []string{http.MethodPost},
+			RequiredScopes: []string{"update:photos"},
+			Authenticated:  true,
+		}, {
+			Path:          "/v1/reservations",
+			Methods:       []string{http.MethodPost},
+			Middleware:    []string{"idempotency"},
+			Authenticated: true,
+		},
+	}, Routes(router))
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	called := false
+	handler := RouteMiddleware("mark", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			next.ServeHTTP(w, r)
+		})
+	})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, called)
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+}
+
+func TestGRPCServices(t *testing.T) {
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, grpchealth.NewServer())
+	services := GRPCServices(server)
+	require.Len(t, services, 1)
+	assert.Equal(t, "grpc.health.v1.Health", services[0].Name)
+	assert.Contains(t, services[0].Methods, GRPCMethodInfo{
+		Name:       "Check",
+		FullMethod: "/grpc.health.v1.Health/Check",
+	})
+	assert.Contains(t, services[0].Methods, GRPCMethodInfo{
+		Name:            "Watch",
+		FullMethod:      "/grpc.health.v1.Health/Watch",
+		ServerStreaming: true,
+	})
+}
+
+func TestRoutesHandler(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, grpchealth.NewServer())
+	tests := []struct {
+		name         string
+		config       Config
+		expectedGRPC []string
+	}{
+		{
+			name: "http routes are listed with their timeouts",
+			config: Config{
+				HandlerTimeout: 5 * time.Second,
+				RouteTimeouts:  map[string]time.Duration{"/v1/spots": time.Second},
+			},
+		}, {
+			name: "grpc services are listed when a grpc server is provided",
+			config: Config{
+				HandlerTimeout: 5 * time.Second,
+				RouteTimeouts:  map[string]time.Duration{"/v1/spots": time.Second},
+				GRPCServer:     grpcServer,
+			},
+			expectedGRPC: []string{"grpc.health.v1.Health"},
+		}, {
+			name: "grpc services are listed when grpc is served on the same port",
+			config: Config{
+				HandlerTimeout: 5 * time.Second,
+				RouteTimeouts:  map[string]time.Duration{"/v1/spots": time.Second},
+				GRPCHandler:    grpcServer,
+			},
+			expectedGRPC: []string{"grpc.health.v1.Health"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.AdminPort = 9091
+			test.config.RoutesHandler = true
+			test.config.PprofHandler = true
+			test.config.RegisterHandlers = registerInventoryRoutes
+			server := test.config.NewServer()
+
+			// the inventory is served by the admin router and lists the public router
+			recorder := httptest.NewRecorder()
+			server.adminRouter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+			require.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+			var inventory RouteInventory
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &inventory))
+			require.Len(t, inventory.HTTP, 4)
+			// authentication is omitted rather than reported as false for routes without it
+			assert.NotContains(t, recorder.Body.String(), `"authenticated":false`)
+			assert.Equal(t, "1s", inventory.HTTP[0].Timeout)
+			assert.Equal(t, "5s", inventory.HTTP[1].Timeout)
+			assert.Equal(t, []string{"update:spots"}, inventory.HTTP[1].RequiredScopes)
+			services := make([]string, 0)
+			for _, service := range inventory.GRPC {
+				services = append(services, service.Name)
+			}
+			if test.expectedGRPC == nil {
+				assert.Empty(t, services)
+			} else {
+				assert.Equal(t, test.expectedGRPC, services)
+			}
+		})
+	}
+}
@@ -17,17 +17,21 @@ package http
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spothero/tools/health"
 	"github.com/spothero/tools/http/writer"
 	"github.com/spothero/tools/log"
+	shTLS "github.com/spothero/tools/tls"
 	"go.uber.org/zap"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
@@ -35,35 +39,70 @@ import (
 
 // Config contains the configuration necessary for running an HTTP/HTTPS Server.
 type Config struct {
-	PreStart         func(ctx context.Context, router *mux.Router, server *http.Server)
-	RegisterHandlers func(*mux.Router)
-	PostShutdown     func(ctx context.Context)
-	TLSCrtPath       string
-	Name             string
-	TLSKeyPath       string
-	Address          string
-	CancelSignals    []os.Signal
-	Middleware       []mux.MiddlewareFunc
-	ReadTimeout      int
-	WriteTimeout     int
-	Port             uint16
-	TLSEnabled       bool
-	DynamicLogLevel  bool
-	PprofHandler     bool
-	MetricsHandler   bool
-	HealthHandler    bool
+	PreStart            func(ctx context.Context, router *mux.Router, server *http.Server)
+	RegisterHandlers    func(*mux.Router)
+	RegisterAdmin       func(*mux.Router)
+	PostShutdown        func(ctx context.Context)
+	GRPCHandler         http.Handler
+	GRPCServer          GRPCServiceLister
+	Registry            prometheus.Registerer
+	Health              *health.Registry
+	Metrics             *Metrics
+	RouteTimeouts       map[string]time.Duration
+	Listener            net.Listener
+	TLSCrtPath          string
+	Name                string
+	TLSKeyPath          string
+	TLSClientCAPath     string
+	TLSClientAuth       string
+	TLSMinVersion       string
+	Address             string
+	AdminAddress        string
+	CancelSignals       []os.Signal
+	Middleware          []mux.MiddlewareFunc
+	TLSCipherSuites     []string
+	Compression         CompressionConfig
+	ReadTimeout         int
+	WriteTimeout        int
+	MaxRequestBodyBytes int64
+	ReadHeaderTimeout   time.Duration
+	IdleTimeout         time.Duration
+	HandlerTimeout      time.Duration
+	ShutdownTimeout     time.Duration
+	PreStopDelay        time.Duration
+	Port                uint16
+	AdminPort           uint16
+	TLSEnabled          bool
+	DynamicLogLevel     bool
+	PprofHandler        bool
+	RoutesHandler       bool
+	MetricsHandler      bool
+	HealthHandler       bool
 }
 
 // Server contains unexported fields and is used to start and manage the Server.
 type Server struct {
-	httpServer    *http.Server
-	router        *mux.Router
-	preStart      func(ctx context.Context, router *mux.Router, server *http.Server)
-	postShutdown  func(ctx context.Context)
-	tlsCrtPath    string
-	tlsKeyPath    string
-	cancelSignals []os.Signal
-	tlsEnabled    bool
+	httpServer       *http.Server
+	adminServer      *http.Server
+	router           *mux.Router
+	adminRouter      *mux.Router
+	preStart         func(ctx context.Context, router *mux.Router, server *http.Server)
+	postShutdown     func(ctx context.Context)
+	health           *health.Registry
+	listener         net.Listener
+	shutdownDuration *prometheus.HistogramVec
+	grpcHandler      grpcShutdowner
+	cancelSignals    []os.Signal
+	tls              shTLS.Config
+	shutdownTimeout  time.Duration
+	preStopDelay     time.Duration
+	tlsEnabled       bool
+}
+
+// grpcShutdowner is implemented by GRPC handlers, such as a grpc.Server, which must be stopped
+// when the HTTP server serving them shuts down
+type grpcShutdowner interface {
+	Shutdown(ctx context.Context)
 }
 
 // NewDefaultConfig returns a standard configuration given a server name. It is recommended to
@@ -73,26 +112,166 @@ func NewDefaultConfig(name string) Config {
 		Name:            name,
 		Address:         "127.0.0.1",
 		Port:            8080,
+		AdminAddress:    "127.0.0.1",
 		ReadTimeout:     5,
 		WriteTimeout:    60,
+		ShutdownTimeout: 5 * time.Second,
 		HealthHandler:   true,
 		MetricsHandler:  true,
 		PprofHandler:    false,
 		DynamicLogLevel: true,
 		CancelSignals:   []os.Signal{os.Interrupt},
+		Compression:     CompressionConfig{Enabled: true},
 	}
 }
 
 // NewServer uses the given http Config to create and return a server ready to be run.
 // Note that this method prepends writer.StatusRecorderMiddleware to the middleware specified
-// in the config as a convenience.
+// in the config as a convenience. If HealthHandler is enabled and a health Registry is provided,
+// the /health/live and /health/ready endpoints are registered alongside /health.
+//
+// If AdminPort is non-zero, the health, metrics, pprof and log level endpoints are registered on
+// a separate internal admin server listening on AdminAddress and AdminPort instead of the public
+// router, which then only serves the handlers registered by RegisterHandlers. Any handlers
+// registered by RegisterAdmin are served alongside the admin endpoints.
+//
+// If a GRPCHandler, such as a grpc.Server, is provided, HTTP/2 requests with a content-type of
+// `application/grpc` are dispatched to it rather than to the router, allowing gRPC and HTTP to be
+// served on a single port with or without TLS. Note that the ReadTimeout and WriteTimeout apply
+// to each gRPC stream as well, so long-lived streams require correspondingly long timeouts. As
+// HTTP/2 connections without TLS are hijacked from the HTTP server, it cannot wait for their
+// streams on shutdown; if the GRPCHandler has a Shutdown method, it is called alongside the
+// shutdown of the HTTP server to drain in-flight RPCs.
+//
+// If RoutesHandler is enabled, the /debug/routes endpoint lists the routes of the public router
+// and, if a GRPCServer is provided or the GRPCHandler lists its services, the registered gRPC
+// services and methods. See Routes and GRPCServices.
+//
+// If a Listener is provided, the server accepts connections on it instead of listening on Address
+// and Port. This allows callers, such as tests, to bind an ephemeral port in advance.
+//
+// The histogram timing each phase of shutdown is registered with the Registry, or with the global
+// Prometheus Registry if none is provided. If the Registry is also a prometheus.Gatherer, its
+// metrics are served on /metrics alongside those of the global Registry.
+//
+// If Compression is enabled, responses are compressed with the best encoding accepted by the client
+// and, if DecompressRequests is set, compressed request bodies are decompressed. The compression
+// middleware is attached before all other middleware, so the response sizes recorded by Metrics
+// and access logs are those of the uncompressed body.
+//
+// If MaxRequestBodyBytes is positive, request bodies are limited to that size with
+// MaxRequestBodyMiddleware. If a HandlerTimeout or RouteTimeouts, keyed by route path template,
+// are provided, handlers are bounded with TimeoutMiddleware and overruns are recorded in Metrics,
+// if provided. Both are attached after the middleware specified in the config.
 func (c Config) NewServer() Server {
 	router := mux.NewRouter()
-	router.Use(handlers.CompressHandler)
+	if c.Compression.Enabled || c.Compression.DecompressRequests {
+		router.Use(c.Compression.NewMiddleware())
+	}
 	router.Use(writer.StatusRecorderMiddleware)
 	router.Use(c.Middleware...)
+	router.Use(MaxRequestBodyMiddleware(c.MaxRequestBodyBytes))
+	if c.HandlerTimeout > 0 || len(c.RouteTimeouts) > 0 {
+		var metrics Metrics
+		if c.Metrics != nil {
+			metrics = *c.Metrics
+		}
+		router.Use(metrics.TimeoutMiddleware(c.HandlerTimeout, c.RouteTimeouts))
+	}
+	var handler http.Handler = router
+	if c.GRPCHandler != nil {
+		handler = grpcDispatcher(c.GRPCHandler, router)
+	}
+	server := Server{
+		httpServer: &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", c.Address, c.Port),
+			Handler:           h2c.NewHandler(handler, &http2.Server{MaxConcurrentStreams: 100}),
+			ReadTimeout:       time.Duration(c.ReadTimeout) * time.Second,
+			WriteTimeout:      time.Duration(c.WriteTimeout) * time.Second,
+			ReadHeaderTimeout: c.ReadHeaderTimeout,
+			IdleTimeout:       c.IdleTimeout,
+		},
+		router:           router,
+		preStart:         c.PreStart,
+		postShutdown:     c.PostShutdown,
+		health:           c.Health,
+		shutdownDuration: newShutdownDuration(c.Registry),
+		cancelSignals:    c.CancelSignals,
+		shutdownTimeout:  c.ShutdownTimeout,
+		preStopDelay:     c.PreStopDelay,
+		listener:         c.Listener,
+		tlsEnabled:       c.TLSEnabled,
+		tls: shTLS.Config{
+			CertPath:     c.TLSCrtPath,
+			KeyPath:      c.TLSKeyPath,
+			ClientCAPath: c.TLSClientCAPath,
+			ClientAuth:   c.TLSClientAuth,
+			MinVersion:   c.TLSMinVersion,
+			CipherSuites: c.TLSCipherSuites,
+		},
+	}
+	if grpcHandler, ok := c.GRPCHandler.(grpcShutdowner); ok {
+		server.grpcHandler = grpcHandler
+	}
+	if c.AdminPort != 0 {
+		server.adminRouter = mux.NewRouter()
+		server.adminServer = &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", c.AdminAddress, c.AdminPort),
+			Handler:           server.adminRouter,
+			ReadTimeout:       time.Duration(c.ReadTimeout) * time.Second,
+			WriteTimeout:      time.Duration(c.WriteTimeout) * time.Second,
+			ReadHeaderTimeout: c.ReadHeaderTimeout,
+			IdleTimeout:       c.IdleTimeout,
+		}
+		c.registerAdminHandlers(server.adminRouter, router)
+	} else {
+		c.registerAdminHandlers(router, router)
+	}
+	if c.RegisterHandlers != nil {
+		c.RegisterHandlers(router)
+	}
+	return server
+}
+
+// NewAdminServer returns a server which only serves the health, metrics, pprof and log level
+// endpoints and any handlers registered by RegisterAdmin, listening on AdminAddress and AdminPort.
+// This is intended for processes which do not expose a public API, such as workers. Public
+// handlers, gRPC, TLS, compression and handler timeouts are not applied to the admin server.
+func (c Config) NewAdminServer() Server {
+	c.Address, c.Port, c.AdminPort = c.AdminAddress, c.AdminPort, 0
+	c.RegisterHandlers, c.GRPCHandler, c.GRPCServer = nil, nil, nil
+	c.HandlerTimeout, c.RouteTimeouts = 0, nil
+	c.Compression = CompressionConfig{}
+	c.TLSEnabled = false
+	c.RoutesHandler = false
+	return c.NewServer()
+}
+
+// grpcDispatcher returns a handler which dispatches gRPC requests to grpcHandler and all other
+// requests to next
+func grpcDispatcher(grpcHandler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// registerAdminHandlers registers the enabled health, routes, pprof, metrics and log level
+// endpoints and any additional admin handlers. The routes endpoint lists the routes of the public
+// router.
+func (c Config) registerAdminHandlers(router, publicRouter *mux.Router) {
 	if c.HealthHandler {
 		router.HandleFunc("/health", healthHandler)
+		if c.Health != nil {
+			c.Health.RegisterHandlers(router)
+		}
+	}
+	if c.RoutesHandler {
+		// Registered ahead of pprof, which handles all other paths under /debug/
+		router.Handle("/debug/routes", c.routesHandler(publicRouter)).Methods(http.MethodGet)
 	}
 	if c.PprofHandler {
 		router.PathPrefix("/debug/").Handler(http.DefaultServeMux)
@@ -103,29 +282,41 @@ func (c Config) NewServer() Server {
 		router.HandleFunc("/debug/pprof/trace", pprof.Trace)
 	}
 	if c.MetricsHandler {
-		router.Handle("/metrics", promhttp.Handler())
+		gatherer := prometheus.Gatherer(prometheus.DefaultGatherer)
+		if registry, ok := c.Registry.(prometheus.Gatherer); ok && c.Registry != prometheus.DefaultRegisterer {
+			// Metrics of the configured registry are served alongside those of the global registry
+			gatherer = prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+		}
+		// OpenMetrics is negotiated so that exemplars are exposed to scrapers which support them
+		router.Handle("/metrics", promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+		))
 	}
 	if c.DynamicLogLevel {
 		log.RegisterLogLevelHandler(router)
 	}
-	if c.RegisterHandlers != nil {
-		c.RegisterHandlers(router)
+	if c.RegisterAdmin != nil {
+		c.RegisterAdmin(router)
 	}
-	return Server{
-		httpServer: &http.Server{
-			Addr:         fmt.Sprintf("%s:%d", c.Address, c.Port),
-			Handler:      h2c.NewHandler(router, &http2.Server{MaxConcurrentStreams: 100}),
-			ReadTimeout:  time.Duration(c.ReadTimeout) * time.Second,
-			WriteTimeout: time.Duration(c.WriteTimeout) * time.Second,
-		},
-		router:        router,
-		preStart:      c.PreStart,
-		postShutdown:  c.PostShutdown,
-		cancelSignals: c.CancelSignals,
-		tlsEnabled:    c.TLSEnabled,
-		tlsCrtPath:    c.TLSCrtPath,
-		tlsKeyPath:    c.TLSKeyPath,
+}
+
+// newShutdownDuration creates the histogram used to time each phase of server shutdown and
+// registers it with the given Prometheus Registry, or the global Registry if none is given,
+// reusing the existing histogram if one has already been registered.
+func newShutdownDuration(registry prometheus.Registerer) *prometheus.HistogramVec {
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
 	}
+	shutdownDuration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_server_shutdown_phase_duration_seconds",
+			Help:    "Amount of time spent in each phase of HTTP server shutdown",
+			Buckets: []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120},
+		},
+		[]string{"phase"},
+	)
+	return registerCollector(registry, shutdownDuration, false).(*prometheus.HistogramVec)
 }
 
 // Run starts the web server, calling any provided preStart hooks and registering the provided
@@ -136,10 +327,31 @@ func (c Config) NewServer() Server {
 // down. If no cancelSignals are provided, this defaults to os.Interrupt. Note that if you override
 // this value and still wish to handle os.Interrupt you _must_ additionally include that value.
 func (s Server) Run() {
+	if err := s.RunContext(context.Background()); err != nil {
+		log.Get(context.Background()).Error("failed to start http server", zap.Error(err))
+	}
+}
+
+// RunContext behaves like Run, but additionally stops the server when the given context is
+// cancelled. This allows the server to be shut down programmatically, for example when a
+// service component fails.
+//
+// If TLS is enabled, the certificate and key are reloaded whenever they change on disk while the
+// server is running. If the TLS configuration is invalid, the server is not started and the error
+// is returned immediately.
+func (s Server) RunContext(ctx context.Context) error {
 	// Setup a context to send cancellation signals to goroutines
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	if s.tlsEnabled {
+		tlsConfig, err := s.tls.NewTLSConfig(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to configure https server tls: %w", err)
+		}
+		s.httpServer.TLSConfig = tlsConfig
+	}
+
 	// Call any existing pre-start callback
 	if s.preStart != nil {
 		s.preStart(ctx, s.router, s.httpServer)
@@ -147,10 +359,17 @@ func (s Server) Run() {
 
 	go func() {
 		var err error
-		if s.tlsEnabled {
+		switch {
+		case s.listener != nil && s.tlsEnabled:
+			log.Get(ctx).Info(fmt.Sprintf("https server started on %s", s.listener.Addr()))
+			err = s.httpServer.ServeTLS(s.listener, "", "")
+		case s.listener != nil:
+			log.Get(ctx).Info(fmt.Sprintf("http server started on %s", s.listener.Addr()))
+			err = s.httpServer.Serve(s.listener)
+		case s.tlsEnabled:
 			log.Get(ctx).Info(fmt.Sprintf("https server started on %s", s.httpServer.Addr))
-			err = s.httpServer.ListenAndServeTLS(s.tlsCrtPath, s.tlsKeyPath)
-		} else {
+			err = s.httpServer.ListenAndServeTLS("", "")
+		default:
 			log.Get(ctx).Info(fmt.Sprintf("http server started on %s", s.httpServer.Addr))
 			err = s.httpServer.ListenAndServe()
 		}
@@ -161,22 +380,110 @@ func (s Server) Run() {
 			log.Get(ctx).Error("http server encountered an error and shutdown", zap.Error(err))
 		}
 	}()
+	if s.adminServer != nil {
+		go func() {
+			log.Get(ctx).Info(fmt.Sprintf("http admin server started on %s", s.adminServer.Addr))
+			switch err := s.adminServer.ListenAndServe(); err {
+			case http.ErrServerClosed:
+				log.Get(ctx).Info("http admin server shutdown")
+			default:
+				log.Get(ctx).Error("http admin server encountered an error and shutdown", zap.Error(err))
+			}
+		}()
+	}
 
-	// Capture cancellation signal and gracefully shutdown goroutines
+	// Capture cancellation signal or context cancellation and gracefully shutdown goroutines
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, s.cancelSignals...)
-	<-signals
-	log.Get(ctx).Info("received interrupt, shutting down http server")
-
-	// Wait for servers to finish exiting and initiate shutdown
-	shutdown, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-	if err := s.httpServer.Shutdown(shutdown); err != nil {
-		log.Get(shutdown).Error("error waiting to shutdown http server", zap.Error(err))
+	defer signal.Stop(signals)
+	select {
+	case <-signals:
+		log.Get(ctx).Info("received interrupt, shutting down http server")
+	case <-ctx.Done():
+		log.Get(ctx).Info("context cancelled, shutting down http server")
 	}
 
+	// Gracefully shutdown the server. The shutdown must not be cancelled along with the server.
+	shutdown := context.WithoutCancel(ctx)
+	s.shutdown(shutdown)
+	// The admin server is stopped last so that probes and metrics remain available while draining
+	s.shutdownAdmin(shutdown)
+
 	// Call any existing post-shutdown callback
 	if s.postShutdown != nil {
 		s.postShutdown(shutdown)
 	}
+	return nil
+}
+
+// shutdown gracefully stops the server. The health registry is first marked as draining so that
+// readiness probes fail, and the server continues to accept requests for the pre-stop delay so
+// that load balancers can observe the failing probe. Listeners are then closed and in-flight
+// requests are given up to the shutdown timeout to complete, after which all remaining
+// connections are forcibly closed. A shutdown timeout of zero waits indefinitely. In-flight RPCs
+// of the GRPC handler, if any, are drained at the same time by its own Shutdown method.
+func (s Server) shutdown(ctx context.Context) {
+	if s.health != nil {
+		s.health.Drain()
+	}
+	if s.preStopDelay > 0 {
+		log.Get(ctx).Info("http server draining, waiting for pre-stop delay", zap.Duration("pre_stop_delay", s.preStopDelay))
+		start := time.Now()
+		time.Sleep(s.preStopDelay)
+		s.observeShutdownPhase(ctx, "pre_stop", start)
+	}
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		defer close(grpcStopped)
+		if s.grpcHandler != nil {
+			s.grpcHandler.Shutdown(ctx)
+		}
+	}()
+	defer func() { <-grpcStopped }()
+
+	drainCtx := ctx
+	if s.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithTimeout(ctx, s.shutdownTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := s.httpServer.Shutdown(drainCtx)
+	s.observeShutdownPhase(ctx, "drain", start)
+	if err == nil {
+		return
+	}
+	log.Get(ctx).Error("error waiting to shutdown http server, forcing close", zap.Error(err))
+	start = time.Now()
+	if err := s.httpServer.Close(); err != nil {
+		log.Get(ctx).Error("error forcing http server to close", zap.Error(err))
+	}
+	s.observeShutdownPhase(ctx, "force_stop", start)
+}
+
+// observeShutdownPhase logs and records the duration of a single phase of shutdown
+func (s Server) observeShutdownPhase(ctx context.Context, phase string, start time.Time) {
+	duration := time.Since(start)
+	log.Get(ctx).Info("http server shutdown phase complete", zap.String("phase", phase), zap.Duration("duration", duration))
+	if s.shutdownDuration != nil {
+		s.shutdownDuration.With(prometheus.Labels{"phase": phase}).Observe(duration.Seconds())
+	}
+}
+
+// shutdownAdmin stops the admin server, if any, waiting up to the shutdown timeout for in-flight
+// requests before forcibly closing it
+func (s Server) shutdownAdmin(ctx context.Context) {
+	if s.adminServer == nil {
+		return
+	}
+	if s.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.shutdownTimeout)
+		defer cancel()
+	}
+	if err := s.adminServer.Shutdown(ctx); err != nil {
+		log.Get(ctx).Error("error waiting to shutdown http admin server, forcing close", zap.Error(err))
+		_ = s.adminServer.Close()
+	}
 }
@@ -17,13 +17,23 @@ package http
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"syscall"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spothero/tools/health"
+	shTLS "github.com/spothero/tools/tls"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func TestNewDefaultConfig(t *testing.T) {
@@ -33,14 +43,17 @@ func TestNewDefaultConfig(t *testing.T) {
 		Name:            "test",
 		Address:         "127.0.0.1",
 		Port:            8080,
+		AdminAddress:    "127.0.0.1",
 		ReadTimeout:     5,
 		WriteTimeout:    60,
+		ShutdownTimeout: 5 * time.Second,
 		HealthHandler:   true,
 		MetricsHandler:  true,
 		PprofHandler:    false,
 		DynamicLogLevel: true,
 		Middleware:      nil,
 		CancelSignals:   []os.Signal{os.Interrupt},
+		Compression:     CompressionConfig{Enabled: true},
 	}, config)
 }
 
@@ -51,27 +64,43 @@ func TestNewServer(t *testing.T) {
 	}
 	mockPreStart := func(_ context.Context, _ *mux.Router, _ *http.Server) {}
 	mockPostShutdown := func(_ context.Context) {}
+	registry := prometheus.NewRegistry()
 
 	config := Config{
-		Address:          "127.0.0.1",
-		Port:             9090,
-		HealthHandler:    true,
-		MetricsHandler:   true,
-		PprofHandler:     true,
-		DynamicLogLevel:  true,
-		RegisterHandlers: mockRegistration,
-		PreStart:         mockPreStart,
-		PostShutdown:     mockPostShutdown,
+		Registry:          registry,
+		Address:           "127.0.0.1",
+		Port:              9090,
+		HealthHandler:     true,
+		Health:            health.NewRegistry(prometheus.NewRegistry()),
+		MetricsHandler:    true,
+		PprofHandler:      true,
+		DynamicLogLevel:   true,
+		RegisterHandlers:  mockRegistration,
+		PreStart:          mockPreStart,
+		PostShutdown:      mockPostShutdown,
+		ReadHeaderTimeout: time.Second,
+		IdleTimeout:       2 * time.Second,
 	}
 	server := config.NewServer()
 	assert.Equal(t, "127.0.0.1:9090", server.httpServer.Addr)
+	assert.Equal(t, time.Second, server.httpServer.ReadHeaderTimeout)
+	assert.Equal(t, 2*time.Second, server.httpServer.IdleTimeout)
 	assert.True(t, registrationCalled)
 	assert.NotNil(t, server.preStart)
 	assert.NotNil(t, server.postShutdown)
+	// the shutdown histogram is registered with the configured registry
+	assert.Same(t, server.shutdownDuration, newShutdownDuration(registry))
+	// metrics of the configured registry are served on /metrics
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "test_registry_total"}))
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), "test_registry_total")
 
 	// walk routes to ensure default routes are registered
 	expectedRoutes := map[string]bool{
 		"/health":              true,
+		"/health/live":         true,
+		"/health/ready":        true,
 		"/debug/":              true,
 		"/debug/pprof/":        true,
 		"/debug/pprof/cmdline": true,
@@ -94,6 +123,204 @@ func TestNewServer(t *testing.T) {
 	assert.Lenf(t, expectedRoutes, 0, "some expected routes were not registered: %v", expectedRoutes)
 }
 
+func TestNewServerAdmin(t *testing.T) {
+	config := Config{
+		Address:          "127.0.0.1",
+		Port:             9090,
+		AdminAddress:     "127.0.0.1",
+		AdminPort:        9091,
+		HealthHandler:    true,
+		Health:           health.NewRegistry(prometheus.NewRegistry()),
+		MetricsHandler:   true,
+		PprofHandler:     true,
+		DynamicLogLevel:  true,
+		RegisterHandlers: func(router *mux.Router) { router.HandleFunc("/api", nil) },
+		RegisterAdmin:    func(router *mux.Router) { router.HandleFunc("/version", nil) },
+	}
+	server := config.NewServer()
+	require.NotNil(t, server.adminServer)
+	assert.Equal(t, "127.0.0.1:9091", server.adminServer.Addr)
+
+	routes := func(router *mux.Router) []string {
+		paths := make([]string, 0)
+		err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			path, err := route.GetPathTemplate()
+			paths = append(paths, path)
+			return err
+		})
+		assert.NoError(t, err)
+		return paths
+	}
+	// the public router only serves the registered handlers
+	assert.Equal(t, []string{"/api"}, routes(server.router))
+	assert.ElementsMatch(t, []string{
+		"/health", "/health/live", "/health/ready", "/debug/", "/debug/pprof/", "/debug/pprof/cmdline",
+		"/debug/pprof/profile", "/debug/pprof/symbol", "/debug/pprof/trace", "/metrics", "/loglevel", "/version",
+	}, routes(server.adminRouter))
+
+	// the admin server is not created unless an admin port is given
+	config.AdminPort = 0
+	assert.Nil(t, config.NewServer().adminServer)
+}
+
+func TestNewAdminServer(t *testing.T) {
+	config := NewDefaultConfig("test")
+	config.AdminPort = 9091
+	config.RoutesHandler = true
+	config.RegisterHandlers = func(router *mux.Router) { router.HandleFunc("/api", nil) }
+	config.RegisterAdmin = func(router *mux.Router) { router.HandleFunc("/version", nil) }
+	server := config.NewAdminServer()
+	// the admin endpoints are served on a single listener bound to the admin address and port
+	assert.Nil(t, server.adminServer)
+	assert.Equal(t, "127.0.0.1:9091", server.httpServer.Addr)
+	paths := make([]string, 0)
+	err := server.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		paths = append(paths, path)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"/health", "/metrics", "/loglevel", "/version"}, paths)
+}
+
+func TestRunContextAdmin(t *testing.T) {
+	config := Config{
+		Address:         "127.0.0.1",
+		Port:            60993,
+		AdminAddress:    "127.0.0.1",
+		AdminPort:       60994,
+		HealthHandler:   true,
+		ShutdownTimeout: time.Second,
+		CancelSignals:   []os.Signal{syscall.SIGUSR1},
+	}
+	server := config.NewServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.RunContext(ctx)
+		close(done)
+	}()
+	status := func(url string) int {
+		resp, err := http.Get(url)
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Eventually(t, func() bool {
+		return status("http://127.0.0.1:60994/health") == http.StatusOK
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, status("http://127.0.0.1:60993/health"))
+	cancel()
+	<-done
+	assert.Equal(t, 0, status("http://127.0.0.1:60994/health"))
+}
+
+func TestRunContextGRPC(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, grpchealth.NewServer())
+	config := Config{
+		Address:         "127.0.0.1",
+		Port:            60995,
+		HealthHandler:   true,
+		GRPCHandler:     grpcServer,
+		ShutdownTimeout: time.Second,
+		CancelSignals:   []os.Signal{syscall.SIGUSR1},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		config.NewServer().RunContext(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// HTTP requests are served by the router
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get("http://127.0.0.1:60995/health")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 5*time.Millisecond)
+
+	// gRPC requests on the same port are served by the gRPC server
+	conn, err := grpc.DialContext(ctx, "127.0.0.1:60995", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+}
+
+// shutdownHandler is a GRPC handler which records when it is shut down
+type shutdownHandler struct {
+	http.Handler
+	shutdown chan struct{}
+}
+
+func (h shutdownHandler) Shutdown(context.Context) {
+	close(h.shutdown)
+}
+
+func TestRunContextGRPCShutdown(t *testing.T) {
+	handler := shutdownHandler{Handler: http.NotFoundHandler(), shutdown: make(chan struct{})}
+	config := Config{
+		Address:         "127.0.0.1",
+		Port:            60996,
+		GRPCHandler:     handler,
+		ShutdownTimeout: time.Second,
+		CancelSignals:   []os.Signal{syscall.SIGUSR1},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		config.NewServer().RunContext(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+	// the GRPC handler is shut down along with the HTTP server
+	select {
+	case <-handler.shutdown:
+	default:
+		t.Fatal("the grpc handler was not shut down")
+	}
+}
+
+func TestGRPCDispatcher(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		protoMajor  int
+		expected    string
+	}{
+		{"http/2 grpc requests are dispatched to the grpc handler", "application/grpc", 2, "grpc"},
+		{"grpc content subtypes are dispatched to the grpc handler", "application/grpc+proto", 2, "grpc"},
+		{"http/1 requests are dispatched to the router", "application/grpc", 1, "router"},
+		{"other http/2 requests are dispatched to the router", "application/json", 2, "router"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handled := ""
+			handler := grpcDispatcher(
+				http.HandlerFunc(func(http.ResponseWriter, *http.Request) { handled = "grpc" }),
+				http.HandlerFunc(func(http.ResponseWriter, *http.Request) { handled = "router" }),
+			)
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.ProtoMajor = test.protoMajor
+			req.Header.Set("Content-Type", test.contentType)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, test.expected, handled)
+		})
+	}
+}
+
 func TestRun(t *testing.T) {
 	preStartCalled := false
 	mockPreStart := func(_ context.Context, _ *mux.Router, _ *http.Server) {
@@ -146,8 +373,7 @@ func TestRun(t *testing.T) {
 				postShutdown:  mockPostShutdown,
 				cancelSignals: []os.Signal{syscall.SIGUSR1},
 				tlsEnabled:    true,
-				tlsCrtPath:    "../testdata/fake-crt.pem",
-				tlsKeyPath:    "../testdata/fake-key.pem",
+				tls:           shTLS.Config{CertPath: "../testdata/fake-crt.pem", KeyPath: "../testdata/fake-key.pem"},
 			},
 		},
 	}
@@ -164,3 +390,95 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRunContext(t *testing.T) {
+	postShutdownCalled := false
+	router := mux.NewRouter()
+	server := Server{
+		httpServer: &http.Server{
+			Addr:    "127.0.0.1:60988",
+			Handler: router,
+		},
+		router:        router,
+		postShutdown:  func(_ context.Context) { postShutdownCalled = true },
+		cancelSignals: []os.Signal{syscall.SIGUSR1},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	assert.NoError(t, server.RunContext(ctx))
+	assert.True(t, postShutdownCalled)
+}
+
+func TestRunContextInvalidTLS(t *testing.T) {
+	postShutdownCalled := false
+	router := mux.NewRouter()
+	server := Server{
+		httpServer: &http.Server{
+			Addr:    "127.0.0.1:60988",
+			Handler: router,
+		},
+		router:        router,
+		postShutdown:  func(_ context.Context) { postShutdownCalled = true },
+		cancelSignals: []os.Signal{syscall.SIGUSR1},
+		tlsEnabled:    true,
+		tls:           shTLS.Config{CertPath: "../testdata/does-not-exist-crt.pem", KeyPath: "../testdata/fake-key.pem"},
+	}
+	// the server returns immediately rather than waiting for cancellation
+	assert.Error(t, server.RunContext(context.Background()))
+	assert.False(t, postShutdownCalled)
+}
+
+func TestShutdown(t *testing.T) {
+	registry := health.NewRegistry(prometheus.NewRegistry())
+	router := mux.NewRouter()
+	registry.RegisterHandlers(router)
+	release := make(chan struct{})
+	defer close(release)
+	router.HandleFunc("/slow", func(_ http.ResponseWriter, _ *http.Request) { <-release })
+	shutdownDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test"}, []string{"phase"})
+	server := Server{
+		httpServer: &http.Server{
+			Addr:    "127.0.0.1:60989",
+			Handler: router,
+		},
+		router:           router,
+		health:           registry,
+		shutdownDuration: shutdownDuration,
+		cancelSignals:    []os.Signal{syscall.SIGUSR1},
+		preStopDelay:     200 * time.Millisecond,
+		shutdownTimeout:  50 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.RunContext(ctx)
+		close(done)
+	}()
+	readyStatus := func() int {
+		resp, err := http.Get("http://127.0.0.1:60989/health/ready")
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Eventually(t, func() bool { return readyStatus() == http.StatusOK }, time.Second, 5*time.Millisecond)
+
+	// an in-flight request which never completes forces the server to close
+	slowErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://127.0.0.1:60989/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+		slowErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	// readiness fails while the server is still accepting requests during the pre-stop delay
+	assert.Eventually(t, func() bool { return readyStatus() == http.StatusServiceUnavailable }, 100*time.Millisecond, 5*time.Millisecond)
+	<-done
+	assert.Error(t, <-slowErr)
+	assert.Equal(t, 3, testutil.CollectAndCount(shutdownDuration))
+}
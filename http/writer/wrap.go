@@ -0,0 +1,180 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"io"
+	"net/http"
+)
+
+// The optional interfaces of the underlying ResponseWriter preserved by Wrap, as bit flags
+const (
+	isFlusher = 1 << iota
+	isHijacker
+	isReaderFrom
+	isPusher
+)
+
+// Wrap wraps the given ResponseWriter with a StatusRecorder. The returned ResponseWriter records
+// into the returned StatusRecorder and implements http.Flusher, http.Hijacker, io.ReaderFrom and
+// http.Pusher only if the given ResponseWriter implements them, so that streaming responses,
+// Server-Sent Events and WebSockets continue to function. It also supports http.ResponseController.
+func Wrap(w http.ResponseWriter) (http.ResponseWriter, *StatusRecorder) {
+	sr := &StatusRecorder{ResponseWriter: w, StatusCode: http.StatusOK}
+	var flusher http.Flusher
+	var hijacker http.Hijacker
+	var readerFrom io.ReaderFrom
+	var pusher http.Pusher
+	interfaces := 0
+	if f, ok := w.(http.Flusher); ok {
+		flusher = flushRecorder{sr, f}
+		interfaces |= isFlusher
+	}
+	if h, ok := w.(http.Hijacker); ok {
+		hijacker = h
+		interfaces |= isHijacker
+	}
+	if rf, ok := w.(io.ReaderFrom); ok {
+		readerFrom = readerFromRecorder{sr, rf}
+		interfaces |= isReaderFrom
+	}
+	if p, ok := w.(http.Pusher); ok {
+		pusher = p
+		interfaces |= isPusher
+	}
+	switch interfaces {
+	case isFlusher:
+		return &struct {
+			*StatusRecorder
+			http.Flusher
+		}{sr, flusher}, sr
+	case isHijacker:
+		return &struct {
+			*StatusRecorder
+			http.Hijacker
+		}{sr, hijacker}, sr
+	case isFlusher | isHijacker:
+		return &struct {
+			*StatusRecorder
+			http.Flusher
+			http.Hijacker
+		}{sr, flusher, hijacker}, sr
+	case isReaderFrom:
+		return &struct {
+			*StatusRecorder
+			io.ReaderFrom
+		}{sr, readerFrom}, sr
+	case isFlusher | isReaderFrom:
+		return &struct {
+			*StatusRecorder
+			http.Flusher
+			io.ReaderFrom
+		}{sr, flusher, readerFrom}, sr
+	case isHijacker | isReaderFrom:
+		return &struct {
+			*StatusRecorder
+			http.Hijacker
+			io.ReaderFrom
+		}{sr, hijacker, readerFrom}, sr
+	case isFlusher | isHijacker | isReaderFrom:
+		return &struct {
+			*StatusRecorder
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{sr, flusher, hijacker, readerFrom}, sr
+	case isPusher:
+		return &struct {
+			*StatusRecorder
+			http.Pusher
+		}{sr, pusher}, sr
+	case isFlusher | isPusher:
+		return &struct {
+			*StatusRecorder
+			http.Flusher
+			http.Pusher
+		}{sr, flusher, pusher}, sr
+	case isHijacker | isPusher:
+		return &struct {
+			*StatusRecorder
+			http.Hijacker
+			http.Pusher
+		}{sr, hijacker, pusher}, sr
+	case isFlusher | isHijacker | isPusher:
+		return &struct {
+			*StatusRecorder
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{sr, flusher, hijacker, pusher}, sr
+	case isReaderFrom | isPusher:
+		return &struct {
+			*StatusRecorder
+			io.ReaderFrom
+			http.Pusher
+		}{sr, readerFrom, pusher}, sr
+	case isFlusher | isReaderFrom | isPusher:
+		return &struct {
+			*StatusRecorder
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+		}{sr, flusher, readerFrom, pusher}, sr
+	case isHijacker | isReaderFrom | isPusher:
+		return &struct {
+			*StatusRecorder
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{sr, hijacker, readerFrom, pusher}, sr
+	case isFlusher | isHijacker | isReaderFrom | isPusher:
+		return &struct {
+			*StatusRecorder
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{sr, flusher, hijacker, readerFrom, pusher}, sr
+	default:
+		return sr, sr
+	}
+}
+
+// flushRecorder records that the headers have been sent when the response is flushed
+type flushRecorder struct {
+	sr      *StatusRecorder
+	flusher http.Flusher
+}
+
+// Flush sends any buffered data to the client
+func (fr flushRecorder) Flush() {
+	fr.sr.WroteHeader = true
+	fr.flusher.Flush()
+}
+
+// readerFromRecorder records the bytes written when the response body is read from a Reader
+type readerFromRecorder struct {
+	sr         *StatusRecorder
+	readerFrom io.ReaderFrom
+}
+
+// ReadFrom writes the response body from the given Reader, allowing the underlying
+// ResponseWriter to use optimizations such as sendfile
+func (rfr readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rfr.sr.WroteHeader = true
+	n, err := rfr.readerFrom.ReadFrom(src)
+	rfr.sr.BytesWritten += n
+	return n, err
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unwrapper is a ResponseWriter wrapping another ResponseWriter, as added by other middleware
+type unwrapper struct {
+	http.ResponseWriter
+}
+
+func (u unwrapper) Unwrap() http.ResponseWriter {
+	return u.ResponseWriter
+}
+
+// basicWriter is a ResponseWriter implementing none of the optional interfaces
+type basicWriter struct {
+	header http.Header
+}
+
+func (bw basicWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw basicWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (bw basicWriter) WriteHeader(_ int) {}
+
+// fullWriter is a ResponseWriter implementing all of the optional interfaces preserved by Wrap
+type fullWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (fw fullWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func (fw fullWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(fw.ResponseRecorder, src)
+}
+
+func (fw fullWriter) Push(_ string, _ *http.PushOptions) error {
+	return nil
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		writer           http.ResponseWriter
+		name             string
+		expectFlusher    bool
+		expectHijacker   bool
+		expectReaderFrom bool
+		expectPusher     bool
+	}{
+		{
+			name:   "writers without optional interfaces are wrapped without them",
+			writer: basicWriter{http.Header{}},
+		}, {
+			name:          "flushers remain flushers",
+			writer:        httptest.NewRecorder(),
+			expectFlusher: true,
+		}, {
+			name:             "all optional interfaces are preserved",
+			writer:           fullWriter{httptest.NewRecorder()},
+			expectFlusher:    true,
+			expectHijacker:   true,
+			expectReaderFrom: true,
+			expectPusher:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w, sr := Wrap(test.writer)
+			assert.Equal(t, http.StatusOK, sr.StatusCode)
+			_, ok := w.(http.Flusher)
+			assert.Equal(t, test.expectFlusher, ok)
+			_, ok = w.(http.Hijacker)
+			assert.Equal(t, test.expectHijacker, ok)
+			_, ok = w.(io.ReaderFrom)
+			assert.Equal(t, test.expectReaderFrom, ok)
+			_, ok = w.(http.Pusher)
+			assert.Equal(t, test.expectPusher, ok)
+
+			recorder, ok := Recorder(w)
+			assert.True(t, ok)
+			assert.Same(t, sr, recorder)
+		})
+	}
+}
+
+func TestWrapFlushAndReadFrom(t *testing.T) {
+	underlying := fullWriter{httptest.NewRecorder()}
+	w, sr := Wrap(underlying)
+
+	n, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, int64(5), sr.BytesWritten)
+	assert.True(t, sr.WroteHeader)
+
+	w, sr = Wrap(httptest.NewRecorder())
+	require.NoError(t, http.NewResponseController(w).Flush())
+	assert.True(t, sr.WroteHeader)
+}
+
+func TestWrapResponseController(t *testing.T) {
+	w, _ := Wrap(basicWriter{http.Header{}})
+	assert.ErrorIs(t, http.NewResponseController(w).Flush(), http.ErrNotSupported)
+
+	// the real server's ResponseWriter supports hijacking through the StatusRecorder
+	server := httptest.NewServer(StatusRecorderMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if assert.NoError(t, err) {
+			_, _ = conn.Write([]byte("HTTP/1.1 204 No Content\r\n\r\n"))
+			conn.Close()
+		}
+	})))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestRecorder(t *testing.T) {
+	w, sr := Wrap(httptest.NewRecorder())
+	recorder, ok := Recorder(unwrapper{w})
+	assert.True(t, ok)
+	assert.Same(t, sr, recorder)
+
+	recorder, ok = Recorder(sr)
+	assert.True(t, ok)
+	assert.Same(t, sr, recorder)
+
+	_, ok = Recorder(httptest.NewRecorder())
+	assert.False(t, ok)
+	_, ok = Recorder(unwrapper{})
+	assert.False(t, ok)
+}
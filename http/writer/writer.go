@@ -21,26 +21,72 @@ import (
 )
 
 // StatusRecorder wraps the http ResponseWriter, allowing additional instrumentation and metrics
-// capture before the response is returned to the client.
+// capture before the response is returned to the client. StatusRecorders should be created with
+// Wrap so that the optional interfaces of the underlying ResponseWriter are preserved, and found
+// by downstream handlers with Recorder.
 type StatusRecorder struct {
 	http.ResponseWriter
-	StatusCode int
+	StatusCode   int   // The status code of the response. Defaults to 200.
+	BytesWritten int64 // The number of bytes of response body written
+	WroteHeader  bool  // Whether the response headers have been sent
 }
 
 // WriteHeader implements the http ResponseWriter WriteHeader interface. This function acts as a
 // middleware which captures the StatusCode on the StatusRecorder and then delegates the actual
-// work of writing the header to the underlying http ResponseWriter.
+// work of writing the header to the underlying http ResponseWriter. Informational status codes
+// other than 101 Switching Protocols do not complete the headers and are not recorded.
 func (sr *StatusRecorder) WriteHeader(code int) {
-	sr.StatusCode = code
+	if !sr.WroteHeader && (code >= http.StatusOK || code == http.StatusSwitchingProtocols) {
+		sr.StatusCode = code
+		sr.WroteHeader = true
+	}
 	sr.ResponseWriter.WriteHeader(code)
 }
 
+// Write implements the http ResponseWriter Write interface. This function records the number of
+// bytes written on the StatusRecorder and then delegates the actual work of writing the body to
+// the underlying http ResponseWriter.
+func (sr *StatusRecorder) Write(b []byte) (int, error) {
+	sr.WroteHeader = true
+	n, err := sr.ResponseWriter.Write(b)
+	sr.BytesWritten += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying http ResponseWriter. This allows http.ResponseController to
+// access the features of the underlying ResponseWriter.
+func (sr *StatusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// statusRecorder returns the StatusRecorder. This method is promoted to the ResponseWriters
+// returned by Wrap, allowing Recorder to find the StatusRecorder behind them.
+func (sr *StatusRecorder) statusRecorder() *StatusRecorder {
+	return sr
+}
+
+// Recorder returns the StatusRecorder recording the given ResponseWriter, if any. Writers which
+// wrap a StatusRecorder and implement `Unwrap() http.ResponseWriter` are unwrapped.
+func Recorder(w http.ResponseWriter) (*StatusRecorder, bool) {
+	for w != nil {
+		switch rw := w.(type) {
+		case interface{ statusRecorder() *StatusRecorder }:
+			return rw.statusRecorder(), true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
 // StatusRecorderMiddleware wraps the http.ResponseWriter with StatusRecorder so that downstream middlewares can
 // utilize the outcome status code after the response completes. This middleware should be attached as early as
 // possible.
 func StatusRecorderMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		wrappedWriter := &StatusRecorder{ResponseWriter: w, StatusCode: http.StatusOK}
+		wrappedWriter, _ := Wrap(w)
 		next.ServeHTTP(wrappedWriter, r)
 	})
 }
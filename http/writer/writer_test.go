@@ -26,12 +26,37 @@ import (
 
 func TestWriteHeader(t *testing.T) {
 	recorder := httptest.NewRecorder()
-	sr := StatusRecorder{recorder, http.StatusNotImplemented}
+	sr := StatusRecorder{ResponseWriter: recorder, StatusCode: http.StatusNotImplemented}
 	sr.WriteHeader(http.StatusOK)
 	assert.Equal(t, sr.StatusCode, http.StatusOK)
 	assert.Equal(t, recorder.Result().StatusCode, http.StatusOK)
 }
 
+func TestWriteHeaderRecordsFinalStatus(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	sr := StatusRecorder{ResponseWriter: recorder, StatusCode: http.StatusOK}
+	sr.WriteHeader(http.StatusEarlyHints)
+	assert.Equal(t, http.StatusOK, sr.StatusCode)
+	assert.False(t, sr.WroteHeader)
+	sr.WriteHeader(http.StatusNotFound)
+	sr.WriteHeader(http.StatusInternalServerError)
+	assert.Equal(t, http.StatusNotFound, sr.StatusCode)
+	assert.True(t, sr.WroteHeader)
+}
+
+func TestWrite(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	sr := StatusRecorder{ResponseWriter: recorder, StatusCode: http.StatusOK}
+	n, err := sr.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	_, err = sr.Write([]byte(" world"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), sr.BytesWritten)
+	assert.True(t, sr.WroteHeader)
+	assert.Equal(t, "hello world", recorder.Body.String())
+}
+
 func TestFetchRoutePathTemplate(t *testing.T) {
 	tests := []struct {
 		name            string
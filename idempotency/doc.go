@@ -0,0 +1,7 @@
+// Package idempotency provides HTTP middleware which honors the `Idempotency-Key` request header,
+// so that clients may safely retry requests which are not otherwise idempotent. The first response
+// for each key is stored and replayed for subsequent requests with the same key, while duplicate
+// requests which arrive before the first has completed are rejected. Keys are scoped to the
+// authenticated caller and to the method and route of the request, and responses are held in a
+// pluggable Store, with in-memory and SQL implementations provided.
+package idempotency
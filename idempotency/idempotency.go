@@ -0,0 +1,244 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spothero/tools/errors"
+	"github.com/spothero/tools/http/writer"
+	"github.com/spothero/tools/jose"
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// Header is the request header containing the idempotency key
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses which were replayed from the Store
+	ReplayedHeader = "Idempotent-Replayed"
+	// maxKeyLength is the maximum length of an idempotency key
+	maxKeyLength = 255
+)
+
+// Response is a stored HTTP response
+type Response struct {
+	Header     http.Header
+	Body       []byte
+	StatusCode int
+}
+
+// Store holds the responses for idempotency keys. Implementations must be safe for concurrent
+// use, including across instances of a service if requests may be retried against any instance.
+type Store interface {
+	// Lock reserves the given key for the given duration, after which the reservation lapses unless
+	// a response has been saved for it. If the key was not reserved, true is returned. Otherwise
+	// false is returned, along with the stored response if the request which reserved the key has
+	// completed, or nil if it is still in progress.
+	Lock(ctx context.Context, key string, ttl time.Duration) (*Response, bool, error)
+	// Save stores the response for a reserved key, which is kept for the given duration
+	Save(ctx context.Context, key string, response Response, ttl time.Duration) error
+	// Unlock releases a reserved key without storing a response so that the request may be retried
+	Unlock(ctx context.Context, key string) error
+}
+
+// Config defines the configuration of the idempotency middleware
+type Config struct {
+	Store       Store         // Storage for responses. If nil, a MemoryStore is used.
+	Methods     []string      // Request methods to which keys apply. Defaults to POST and PATCH.
+	TTL         time.Duration // Time for which responses are stored. Defaults to 24 hours.
+	LockTimeout time.Duration // Time for which keys are reserved while in progress. Defaults to 1 minute.
+}
+
+// NewMiddleware returns middleware which stores the first response for each idempotency key and
+// replays it, with the Idempotent-Replayed header set, for subsequent requests with the same key,
+// method and route from the same caller. Requests without a key, with methods to which keys do not
+// apply, or from anonymous callers are passed through unchanged. Duplicate requests which arrive
+// while the first request is still in progress are rejected with a 409 status.
+//
+// Server error responses are not stored so that clients may retry them, and the key is likewise
+// released if the handler panics. Keys reserved by an instance which stops before releasing them
+// lapse after the LockTimeout, which should therefore exceed the time taken to handle a request.
+// If the Store fails, requests are rejected with a 503 status rather than risk processing them
+// twice. The middleware must be attached to a mux.Router after the JOSE middleware so that callers
+// can be identified. Callers are identified by the subject of their token, or by the client name
+// for client credentials tokens.
+func (c Config) NewMiddleware() mux.MiddlewareFunc {
+	if c.Store == nil {
+		c.Store = NewMemoryStore()
+	}
+	if c.TTL <= 0 {
+		c.TTL = 24 * time.Hour
+	}
+	if c.LockTimeout <= 0 {
+		c.LockTimeout = time.Minute
+	}
+	if c.Methods == nil {
+		c.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	methods := make(map[string]bool, len(c.Methods))
+	for _, method := range c.Methods {
+		methods[method] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get(Header)
+			ctx := r.Context()
+			caller := callerID(ctx)
+			if idempotencyKey == "" || !methods[r.Method] || caller == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(idempotencyKey) > maxKeyLength {
+				errors.WriteHTTP(w, r, errors.New(
+					errors.InvalidArgument, "invalid_idempotency_key",
+					"idempotency keys may not exceed "+strconv.Itoa(maxKeyLength)+" characters",
+				))
+				return
+			}
+			route := writer.FetchRoutePathTemplate(r)
+			if route == "" {
+				route = r.URL.Path
+			}
+			key := strings.Join([]string{caller, r.Method, route, idempotencyKey}, " ")
+			stored, locked, err := c.Store.Lock(ctx, key, c.LockTimeout)
+			switch {
+			case err != nil:
+				errors.WriteHTTP(w, r, errors.Wrap(err, errors.Unavailable, "idempotency_unavailable", "the request could not be checked for duplicates"))
+				return
+			case stored != nil:
+				stored.write(w)
+				return
+			case !locked:
+				errors.WriteHTTP(w, r, errors.New(errors.AlreadyExists, "idempotency_key_in_use", "a request with this idempotency key is already in progress"))
+				return
+			}
+
+			rec := &recorder{ResponseWriter: w, initialHeader: w.Header().Clone()}
+			saved := false
+			defer func() {
+				if saved {
+					return
+				}
+				// The key is released if the handler panics or fails so that the request may be retried
+				if err := c.Store.Unlock(context.WithoutCancel(ctx), key); err != nil {
+					log.Get(ctx).Error("failed to release idempotency key", zap.Error(err))
+				}
+			}()
+			next.ServeHTTP(rec, r)
+			if rec.status() >= http.StatusInternalServerError {
+				return
+			}
+			header := rec.header
+			if header == nil {
+				header = handlerHeader(rec.initialHeader, w.Header())
+			}
+			response := Response{StatusCode: rec.status(), Header: header, Body: rec.body.Bytes()}
+			if err := c.Store.Save(context.WithoutCancel(ctx), key, response, c.TTL); err != nil {
+				log.Get(ctx).Error("failed to store idempotent response", zap.Error(err))
+				return
+			}
+			saved = true
+		})
+	}
+}
+
+// callerID returns the identity of the authenticated caller on the context, or an empty string
+// for anonymous callers. Users are identified by the subject of their token so that users of the
+// same application do not share keys, while client credentials tokens are identified by the name
+// of the client.
+func callerID(ctx context.Context) string {
+	claim, err := jose.FromContext(ctx)
+	if err != nil {
+		return ""
+	}
+	if claim.GetClientID() != "" && claim.ClientName != "" {
+		return "client:" + claim.ClientName
+	}
+	if claim.ID == "" {
+		return ""
+	}
+	return "sub:" + claim.ID
+}
+
+// handlerHeader returns the headers which were added or changed since the initial headers were
+// captured. Headers set by outer middleware, such as request IDs, are therefore not stored and
+// are not replaced when the response is replayed.
+func handlerHeader(initial, current http.Header) http.Header {
+	header := make(http.Header, len(current))
+	for name, values := range current {
+		if !slices.Equal(initial[name], values) {
+			header[name] = slices.Clone(values)
+		}
+	}
+	return header
+}
+
+// write replays the stored response
+func (resp Response) write(w http.ResponseWriter) {
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(resp.Body)
+}
+
+// recorder captures the status, headers and body of a response while writing it to the client
+type recorder struct {
+	http.ResponseWriter
+	initialHeader http.Header
+	header        http.Header
+	body          bytes.Buffer
+	statusCode    int
+}
+
+// WriteHeader captures the status of the final response and the headers set by the handler
+func (rec *recorder) WriteHeader(statusCode int) {
+	if rec.statusCode == 0 && statusCode >= http.StatusOK {
+		rec.statusCode = statusCode
+		rec.header = handlerHeader(rec.initialHeader, rec.Header())
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write captures the body of the response
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter so that http.ResponseController may reach it
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// status returns the status of the response, which is 200 if the handler wrote nothing
+func (rec *recorder) status() int {
+	if rec.statusCode == 0 {
+		return http.StatusOK
+	}
+	return rec.statusCode
+}
@@ -0,0 +1,299 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spothero/tools/errors"
+	"github.com/spothero/tools/jose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore is a Store whose operations always fail
+type failingStore struct{}
+
+func (failingStore) Lock(context.Context, string, time.Duration) (*Response, bool, error) {
+	return nil, false, fmt.Errorf("connection refused")
+}
+
+func (failingStore) Save(context.Context, string, Response, time.Duration) error {
+	return fmt.Errorf("connection refused")
+}
+
+func (failingStore) Unlock(context.Context, string) error {
+	return fmt.Errorf("connection refused")
+}
+
+// newRequest creates a request with the given method, target and idempotency key, from the user
+// with the given subject if not empty
+func newRequest(method, target, key, subject string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	if key != "" {
+		r.Header.Set(Header, key)
+	}
+	if subject != "" {
+		r = r.WithContext(jose.Auth0Claim{ID: subject, ClientName: "app"}.NewContext(r.Context()))
+	}
+	return r
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if r.URL.Query().Get("status") == "500" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/reservations/%d", n))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"id":%d}`, n)
+	})
+
+	tests := []struct {
+		name           string
+		store          Store
+		requests       []*http.Request
+		expectedStatus []int
+		expectedBody   []string
+		expectedCalls  int32
+	}{
+		{
+			name:           "requests without a key are not deduplicated",
+			requests:       []*http.Request{newRequest(http.MethodPost, "/reservations", "", "user"), newRequest(http.MethodPost, "/reservations", "", "user")},
+			expectedStatus: []int{http.StatusCreated, http.StatusCreated},
+			expectedBody:   []string{`{"id":1}`, `{"id":2}`},
+			expectedCalls:  2,
+		},
+		{
+			name:           "keys do not apply to other methods",
+			requests:       []*http.Request{newRequest(http.MethodPut, "/reservations", "a", "user"), newRequest(http.MethodPut, "/reservations", "a", "user")},
+			expectedStatus: []int{http.StatusCreated, http.StatusCreated},
+			expectedBody:   []string{`{"id":1}`, `{"id":2}`},
+			expectedCalls:  2,
+		},
+		{
+			name:           "keys do not apply to anonymous callers",
+			requests:       []*http.Request{newRequest(http.MethodPost, "/reservations", "a", ""), newRequest(http.MethodPost, "/reservations", "a", "")},
+			expectedStatus: []int{http.StatusCreated, http.StatusCreated},
+			expectedBody:   []string{`{"id":1}`, `{"id":2}`},
+			expectedCalls:  2,
+		},
+		{
+			name:           "the first response is replayed for the same key",
+			requests:       []*http.Request{newRequest(http.MethodPost, "/reservations", "a", "user"), newRequest(http.MethodPost, "/reservations", "a", "user")},
+			expectedStatus: []int{http.StatusCreated, http.StatusCreated},
+			expectedBody:   []string{`{"id":1}`, `{"id":1}`},
+			expectedCalls:  1,
+		},
+		{
+			name:           "keys are scoped to the authenticated user",
+			requests:       []*http.Request{newRequest(http.MethodPost, "/reservations", "a", "user"), newRequest(http.MethodPost, "/reservations", "a", "other")},
+			expectedStatus: []int{http.StatusCreated, http.StatusCreated},
+			expectedBody:   []string{`{"id":1}`, `{"id":2}`},
+			expectedCalls:  2,
+		},
+		{
+			name:           "keys are scoped to the route",
+			requests:       []*http.Request{newRequest(http.MethodPost, "/reservations", "a", "user"), newRequest(http.MethodPost, "/payments", "a", "user")},
+			expectedStatus: []int{http.StatusCreated, http.StatusCreated},
+			expectedBody:   []string{`{"id":1}`, `{"id":2}`},
+			expectedCalls:  2,
+		},
+		{
+			name:           "keys are scoped to the method",
+			requests:       []*http.Request{newRequest(http.MethodPost, "/reservations", "a", "user"), newRequest(http.MethodPatch, "/reservations", "a", "user")},
+			expectedStatus: []int{http.StatusCreated, http.StatusCreated},
+			expectedBody:   []string{`{"id":1}`, `{"id":2}`},
+			expectedCalls:  2,
+		},
+		{
+			name: "server errors are not stored",
+			requests: []*http.Request{
+				newRequest(http.MethodPost, "/reservations?status=500", "a", "user"),
+				newRequest(http.MethodPost, "/reservations?status=500", "a", "user"),
+			},
+			expectedStatus: []int{http.StatusInternalServerError, http.StatusInternalServerError},
+			expectedCalls:  2,
+		},
+		{
+			name:           "keys longer than the maximum are rejected",
+			requests:       []*http.Request{newRequest(http.MethodPost, "/reservations", strings.Repeat("a", maxKeyLength+1), "user")},
+			expectedStatus: []int{http.StatusBadRequest},
+		},
+		{
+			name:           "store failures reject the request",
+			store:          failingStore{},
+			requests:       []*http.Request{newRequest(http.MethodPost, "/reservations", "a", "user")},
+			expectedStatus: []int{http.StatusServiceUnavailable},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+			middleware := Config{Store: test.store}.NewMiddleware()(handler)
+			for i, r := range test.requests {
+				recorder := httptest.NewRecorder()
+				middleware.ServeHTTP(recorder, r)
+				assert.Equal(t, test.expectedStatus[i], recorder.Code)
+				if test.expectedBody != nil {
+					assert.Equal(t, test.expectedBody[i], recorder.Body.String())
+				}
+				if i > 0 && test.expectedCalls == 1 {
+					assert.Equal(t, "true", recorder.Header().Get(ReplayedHeader))
+					assert.Equal(t, "/reservations/1", recorder.Header().Get("Location"))
+				}
+			}
+			assert.Equal(t, test.expectedCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	store := NewMemoryStore()
+	middleware := Config{Store: store}.NewMiddleware()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("handler failed")
+	}))
+	assert.Panics(t, func() {
+		middleware.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "/reservations", "a", "user"))
+	})
+	// the key is released so that the request may be retried
+	_, locked, err := store.Lock(context.Background(), "sub:user POST /reservations a", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, locked)
+}
+
+func TestMiddlewareConcurrentDuplicate(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	middleware := Config{}.NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		middleware.ServeHTTP(first, newRequest(http.MethodPost, "/reservations", "a", "user"))
+		close(done)
+	}()
+	<-started
+
+	duplicate := httptest.NewRecorder()
+	middleware.ServeHTTP(duplicate, newRequest(http.MethodPost, "/reservations", "a", "user"))
+	assert.Equal(t, http.StatusConflict, duplicate.Code)
+	assert.Equal(t, errors.ProblemContentType, duplicate.Header().Get("Content-Type"))
+
+	close(release)
+	<-done
+	assert.Equal(t, http.StatusCreated, first.Code)
+}
+
+func TestCallerID(t *testing.T) {
+	tests := []struct {
+		claim    *jose.Auth0Claim
+		name     string
+		expected string
+	}{
+		{name: "anonymous callers have no identity"},
+		{
+			name:     "users are identified by subject",
+			claim:    &jose.Auth0Claim{ID: "auth0|123", ClientName: "app", GrantType: "password"},
+			expected: "sub:auth0|123",
+		},
+		{
+			name:     "client credentials tokens are identified by client name",
+			claim:    &jose.Auth0Claim{ID: "abc@clients", ClientName: "app", GrantType: "client-credentials"},
+			expected: "client:app",
+		},
+		{
+			name:     "client credentials tokens without a client name are identified by subject",
+			claim:    &jose.Auth0Claim{ID: "abc@clients", GrantType: "client-credentials"},
+			expected: "sub:abc@clients",
+		},
+		{
+			name:  "claims without a subject have no identity",
+			claim: &jose.Auth0Claim{ClientName: "app"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.claim != nil {
+				ctx = test.claim.NewContext(ctx)
+			}
+			assert.Equal(t, test.expected, callerID(ctx))
+		})
+	}
+}
+
+func TestMiddlewareReplayedHeaders(t *testing.T) {
+	var requestID int32
+	handler := Config{}.NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Location", "/reservations/1")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	// outer middleware sets a header which differs for each request
+	withRequestID := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", fmt.Sprint(atomic.AddInt32(&requestID, 1)))
+		handler.ServeHTTP(w, r)
+	})
+	first := httptest.NewRecorder()
+	withRequestID.ServeHTTP(first, newRequest(http.MethodPost, "/reservations", "a", "user"))
+	assert.Equal(t, "1", first.Header().Get("X-Request-ID"))
+
+	replayed := httptest.NewRecorder()
+	withRequestID.ServeHTTP(replayed, newRequest(http.MethodPost, "/reservations", "a", "user"))
+	assert.Equal(t, "true", replayed.Header().Get(ReplayedHeader))
+	assert.Equal(t, "/reservations/1", replayed.Header().Get("Location"))
+	assert.Equal(t, "2", replayed.Header().Get("X-Request-ID"))
+}
+
+func TestMiddlewareLockTimeout(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	middleware := Config{Store: store, LockTimeout: time.Minute}.NewMiddleware()(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusCreated) }),
+	)
+	// the key is reserved by an instance which stopped before releasing it
+	_, locked, err := store.Lock(context.Background(), "sub:user POST /reservations a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	inProgress := httptest.NewRecorder()
+	middleware.ServeHTTP(inProgress, newRequest(http.MethodPost, "/reservations", "a", "user"))
+	assert.Equal(t, http.StatusConflict, inProgress.Code)
+
+	// the reservation lapses after the lock timeout rather than the response TTL
+	now = now.Add(2 * time.Minute)
+	retried := httptest.NewRecorder()
+	middleware.ServeHTTP(retried, newRequest(http.MethodPost, "/reservations", "a", "user"))
+	assert.Equal(t, http.StatusCreated, retried.Code)
+
+	// the stored response is kept for the response TTL
+	now = now.Add(time.Hour)
+	replayed := httptest.NewRecorder()
+	middleware.ServeHTTP(replayed, newRequest(http.MethodPost, "/reservations", "a", "user"))
+	assert.Equal(t, "true", replayed.Header().Get(ReplayedHeader))
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the minimum interval between removals of expired entries from a MemoryStore
+const sweepInterval = time.Minute
+
+// entry is a reserved key and its response, if the request has completed
+type entry struct {
+	expires  time.Time
+	response *Response
+}
+
+// MemoryStore is a Store which holds responses in memory. Duplicate requests are therefore only
+// detected when they are handled by the same instance of a service. Expired entries are removed
+// periodically so that memory use is proportional to the number of recent requests.
+type MemoryStore struct {
+	entries   map[string]entry
+	mutex     *sync.Mutex
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:   make(map[string]entry),
+		mutex:     &sync.Mutex{},
+		now:       time.Now,
+		lastSweep: time.Now(),
+	}
+}
+
+// Lock reserves the given key for the given duration if it is not reserved or its entry has
+// expired
+func (ms *MemoryStore) Lock(_ context.Context, key string, ttl time.Duration) (*Response, bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	now := ms.now()
+	ms.sweep(now)
+	if e, ok := ms.entries[key]; ok && now.Before(e.expires) {
+		return e.response, false, nil
+	}
+	ms.entries[key] = entry{expires: now.Add(ttl)}
+	return nil, true, nil
+}
+
+// Save stores the response for the given key
+func (ms *MemoryStore) Save(_ context.Context, key string, response Response, ttl time.Duration) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.entries[key] = entry{expires: ms.now().Add(ttl), response: &response}
+	return nil
+}
+
+// Unlock releases the given key if no response has been stored for it
+func (ms *MemoryStore) Unlock(_ context.Context, key string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if e, ok := ms.entries[key]; ok && e.response == nil {
+		delete(ms.entries, key)
+	}
+	return nil
+}
+
+// sweep removes expired entries, at most once per sweepInterval
+func (ms *MemoryStore) sweep(now time.Time) {
+	if now.Sub(ms.lastSweep) < sweepInterval {
+		return
+	}
+	ms.lastSweep = now
+	for key, e := range ms.entries {
+		if !now.Before(e.expires) {
+			delete(ms.entries, key)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	store.lastSweep = now
+
+	response, locked, err := store.Lock(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, locked)
+	assert.Nil(t, response)
+
+	// in-progress keys may not be reserved again
+	response, locked, err = store.Lock(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, locked)
+	assert.Nil(t, response)
+
+	// unlocked keys may be reserved again
+	require.NoError(t, store.Unlock(ctx, "a"))
+	_, locked, err = store.Lock(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, locked)
+
+	// stored responses are returned and are not released by Unlock
+	stored := Response{StatusCode: http.StatusCreated, Header: http.Header{"Location": {"/reservations/1"}}, Body: []byte("{}")}
+	require.NoError(t, store.Save(ctx, "a", stored, time.Hour))
+	require.NoError(t, store.Unlock(ctx, "a"))
+	response, locked, err = store.Lock(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, locked)
+	assert.Equal(t, &stored, response)
+
+	// expired entries may be reserved again and are swept
+	_, _, err = store.Lock(ctx, "b", time.Minute)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Hour)
+	_, locked, err = store.Lock(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, locked)
+	assert.NotContains(t, store.entries, "b")
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLStore is a Store which holds responses in a SQL database table, so that duplicate requests
+// are detected across all instances of a service. It is intended for use with the instrumented
+// *sqlx.DB returned by the Connect functions of the sql package, and supports any database whose
+// bind variables sqlx can rebind. The table must have the following schema, shown for PostgreSQL:
+//
+//	CREATE TABLE idempotency_keys (
+//		idempotency_key VARCHAR(1024) PRIMARY KEY,
+//		status_code     INTEGER,
+//		header          TEXT,
+//		body            BYTEA,
+//		expires_at      TIMESTAMP NOT NULL
+//	);
+//
+// Expired rows are replaced when their key is reused, and may be removed in bulk with
+// DeleteExpired.
+type SQLStore struct {
+	db    *sqlx.DB
+	now   func() time.Time
+	table string
+}
+
+// sqlResponse is a row of the idempotency key table
+type sqlResponse struct {
+	Header     sql.NullString `db:"header"`
+	Body       []byte         `db:"body"`
+	StatusCode sql.NullInt64  `db:"status_code"`
+}
+
+// NewSQLStore creates a SQLStore which stores responses in the given table. NewSQLStore panics if
+// no table is provided.
+func NewSQLStore(db *sqlx.DB, table string) *SQLStore {
+	if table == "" {
+		panic("no table was specified for the idempotency sql store")
+	}
+	return &SQLStore{db: db, table: table, now: time.Now}
+}
+
+// Lock reserves the given key by inserting a row for it which expires after the given duration.
+// If the row already exists and has not expired, the key is not reserved and the stored response,
+// if any, is returned. Rows without a stored response expire with their reservation, so that keys
+// held by an instance which stopped before releasing them may be reserved again.
+func (s *SQLStore) Lock(ctx context.Context, key string, ttl time.Duration) (*Response, bool, error) {
+	now := s.now().UTC()
+	// An expired row is removed so that its key may be reserved again
+	if _, err := s.db.ExecContext(
+		ctx, s.db.Rebind("DELETE FROM "+s.table+" WHERE idempotency_key = ? AND expires_at <= ?"), key, now,
+	); err != nil {
+		return nil, false, fmt.Errorf("failed to remove expired idempotency key: %w", err)
+	}
+	_, insertErr := s.db.ExecContext(
+		ctx, s.db.Rebind("INSERT INTO "+s.table+" (idempotency_key, expires_at) VALUES (?, ?)"), key, now.Add(ttl),
+	)
+	if insertErr == nil {
+		return nil, true, nil
+	}
+	// The insert fails if the key has already been reserved, in which case the row is returned
+	var row sqlResponse
+	err := s.db.GetContext(
+		ctx, &row, s.db.Rebind("SELECT status_code, header, body FROM "+s.table+" WHERE idempotency_key = ?"), key,
+	)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", insertErr)
+	case err != nil:
+		return nil, false, fmt.Errorf("failed to read idempotency key: %w", err)
+	case !row.StatusCode.Valid:
+		return nil, false, nil
+	}
+	response := &Response{StatusCode: int(row.StatusCode.Int64), Body: row.Body}
+	if err := json.Unmarshal([]byte(row.Header.String), &response.Header); err != nil {
+		return nil, false, fmt.Errorf("failed to decode stored response headers: %w", err)
+	}
+	return response, false, nil
+}
+
+// Save stores the response in the row of the given key
+func (s *SQLStore) Save(ctx context.Context, key string, response Response, ttl time.Duration) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return fmt.Errorf("failed to encode response headers: %w", err)
+	}
+	if _, err := s.db.ExecContext(
+		ctx,
+		s.db.Rebind("UPDATE "+s.table+" SET status_code = ?, header = ?, body = ?, expires_at = ? WHERE idempotency_key = ?"),
+		response.StatusCode, string(header), response.Body, s.now().UTC().Add(ttl), key,
+	); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Unlock deletes the row of the given key if no response has been stored for it
+func (s *SQLStore) Unlock(ctx context.Context, key string) error {
+	if _, err := s.db.ExecContext(
+		ctx, s.db.Rebind("DELETE FROM "+s.table+" WHERE idempotency_key = ? AND status_code IS NULL"), key,
+	); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes all expired rows, returning the number of rows deleted
+func (s *SQLStore) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, s.db.Rebind("DELETE FROM "+s.table+" WHERE expires_at <= ?"), s.now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockSQLStore creates a SQLStore backed by a mock PostgreSQL database with a fixed clock
+func newMockSQLStore(t *testing.T) (*SQLStore, sqlmock.Sqlmock, time.Time) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := NewSQLStore(sqlx.NewDb(db, "postgres"), "idempotency_keys")
+	store.now = func() time.Time { return now }
+	return store, mock, now
+}
+
+func TestNewSQLStore(t *testing.T) {
+	assert.Panics(t, func() { NewSQLStore(nil, "") })
+}
+
+func TestSQLStoreLock(t *testing.T) {
+	const (
+		deleteExpired = "DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND expires_at <= $2"
+		insert        = "INSERT INTO idempotency_keys (idempotency_key, expires_at) VALUES ($1, $2)"
+		selectRow     = "SELECT status_code, header, body FROM idempotency_keys WHERE idempotency_key = $1"
+	)
+	tests := []struct {
+		expectations     func(mock sqlmock.Sqlmock, now time.Time)
+		expectedResponse *Response
+		name             string
+		expectLocked     bool
+		expectErr        bool
+	}{
+		{
+			name: "unreserved keys are reserved",
+			expectations: func(mock sqlmock.Sqlmock, now time.Time) {
+				mock.ExpectExec(deleteExpired).WithArgs("a", now).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(insert).WithArgs("a", now.Add(time.Hour)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectLocked: true,
+		},
+		{
+			name: "in-progress keys are not reserved",
+			expectations: func(mock sqlmock.Sqlmock, now time.Time) {
+				mock.ExpectExec(deleteExpired).WithArgs("a", now).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(insert).WithArgs("a", now.Add(time.Hour)).WillReturnError(fmt.Errorf("duplicate key"))
+				mock.ExpectQuery(selectRow).WithArgs("a").WillReturnRows(
+					sqlmock.NewRows([]string{"status_code", "header", "body"}).AddRow(nil, nil, nil),
+				)
+			},
+		},
+		{
+			name: "stored responses are returned",
+			expectations: func(mock sqlmock.Sqlmock, now time.Time) {
+				mock.ExpectExec(deleteExpired).WithArgs("a", now).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(insert).WithArgs("a", now.Add(time.Hour)).WillReturnError(fmt.Errorf("duplicate key"))
+				mock.ExpectQuery(selectRow).WithArgs("a").WillReturnRows(
+					sqlmock.NewRows([]string{"status_code", "header", "body"}).
+						AddRow(http.StatusCreated, `{"Location":["/reservations/1"]}`, []byte("{}")),
+				)
+			},
+			expectedResponse: &Response{
+				StatusCode: http.StatusCreated,
+				Header:     http.Header{"Location": {"/reservations/1"}},
+				Body:       []byte("{}"),
+			},
+		},
+		{
+			name: "insert failures are returned if the key is not reserved",
+			expectations: func(mock sqlmock.Sqlmock, now time.Time) {
+				mock.ExpectExec(deleteExpired).WithArgs("a", now).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(insert).WithArgs("a", now.Add(time.Hour)).WillReturnError(fmt.Errorf("connection refused"))
+				mock.ExpectQuery(selectRow).WithArgs("a").WillReturnError(sql.ErrNoRows)
+			},
+			expectErr: true,
+		},
+		{
+			name: "delete failures are returned",
+			expectations: func(mock sqlmock.Sqlmock, now time.Time) {
+				mock.ExpectExec(deleteExpired).WithArgs("a", now).WillReturnError(fmt.Errorf("connection refused"))
+			},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, mock, now := newMockSQLStore(t)
+			test.expectations(mock, now)
+			response, locked, err := store.Lock(context.Background(), "a", time.Hour)
+			if test.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expectLocked, locked)
+			assert.Equal(t, test.expectedResponse, response)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSQLStoreSave(t *testing.T) {
+	store, mock, now := newMockSQLStore(t)
+	mock.ExpectExec(
+		"UPDATE idempotency_keys SET status_code = $1, header = $2, body = $3, expires_at = $4 WHERE idempotency_key = $5",
+	).WithArgs(http.StatusCreated, `{"Location":["/reservations/1"]}`, []byte("{}"), now.Add(time.Hour), "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, store.Save(context.Background(), "a", Response{
+		StatusCode: http.StatusCreated,
+		Header:     http.Header{"Location": {"/reservations/1"}},
+		Body:       []byte("{}"),
+	}, time.Hour))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLStoreUnlock(t *testing.T) {
+	store, mock, _ := newMockSQLStore(t)
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND status_code IS NULL").
+		WithArgs("a").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, store.Unlock(context.Background(), "a"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLStoreDeleteExpired(t *testing.T) {
+	store, mock, now := newMockSQLStore(t)
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE expires_at <= $1").
+		WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 3))
+	deleted, err := store.DeleteExpired(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-jose/go-jose/v3"
@@ -179,3 +180,31 @@ func (j JOSE) ParseValidateJWT(input string, claims ...Claim) error {
 	}
 	return err
 }
+
+// ReloadableHandler is a Handler whose underlying Handler may be replaced at runtime, for example
+// when the JWKS URLs or valid issuers change, without interrupting in-flight requests
+type ReloadableHandler struct {
+	handler atomic.Pointer[Handler]
+}
+
+// NewReloadableHandler creates and returns a ReloadableHandler wrapping the given Handler
+func NewReloadableHandler(handler Handler) *ReloadableHandler {
+	rh := &ReloadableHandler{}
+	rh.Reload(handler)
+	return rh
+}
+
+// Reload replaces the Handler used by all future requests
+func (rh *ReloadableHandler) Reload(handler Handler) {
+	rh.handler.Store(&handler)
+}
+
+// GetClaims returns the claims of the current Handler
+func (rh *ReloadableHandler) GetClaims() []Claim {
+	return (*rh.handler.Load()).GetClaims()
+}
+
+// ParseValidateJWT parses and validates the given JWT with the current Handler
+func (rh *ReloadableHandler) ParseValidateJWT(input string, claims ...Claim) error {
+	return (*rh.handler.Load()).ParseValidateJWT(input, claims...)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -199,3 +200,20 @@ b9Ym/nxaqyTu0PxajXkKm5Q=
 		})
 	}
 }
+
+func TestReloadableHandler(t *testing.T) {
+	first := &MockHandler{claimGenerators: []ClaimGenerator{MockGenerator{}}}
+	first.On("ParseValidateJWT", "token", []Claim(nil)).Return(fmt.Errorf("invalid token"))
+	second := &MockHandler{}
+	second.On("ParseValidateJWT", "token", []Claim(nil)).Return(nil)
+
+	rh := NewReloadableHandler(first)
+	assert.Len(t, rh.GetClaims(), 1)
+	assert.Error(t, rh.ParseValidateJWT("token"))
+
+	rh.Reload(second)
+	assert.Len(t, rh.GetClaims(), 0)
+	assert.NoError(t, rh.ParseValidateJWT("token"))
+	first.AssertExpectations(t)
+	second.AssertExpectations(t)
+}
@@ -21,10 +21,10 @@ import (
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spothero/tools/errors"
 	"github.com/spothero/tools/http/writer"
 	"github.com/spothero/tools/log"
 	tools_strings "github.com/spothero/tools/strings"
-	"go.uber.org/zap"
 )
 
 // authHeader defines the name of the header containing the JWT authorization data
@@ -57,9 +57,8 @@ func GetHTTPServerMiddleware(jh Handler) func(next http.Handler) http.Handler {
 			}
 
 			if !strings.HasPrefix(authHeader, bearerPrefix) {
-				logger.Debug(bearerPrefixNotFound)
 				w.Header().Set("WWW-Authenticate", "Bearer")
-				http.Error(w, bearerPrefixNotFound, http.StatusUnauthorized)
+				errors.WriteHTTP(w, r, errors.New(errors.Unauthenticated, "bearer_prefix_not_found", bearerPrefixNotFound))
 				return
 			}
 
@@ -67,8 +66,7 @@ func GetHTTPServerMiddleware(jh Handler) func(next http.Handler) http.Handler {
 			bearerToken := strings.TrimPrefix(authHeader, bearerPrefix)
 			err := jh.ParseValidateJWT(bearerToken, claims...)
 			if err != nil {
-				logger.Info("failed to parse and validate claims", zap.Error(err))
-				http.Error(w, invalidBearerToken, http.StatusForbidden)
+				errors.WriteHTTP(w, r, errors.Wrap(err, errors.PermissionDenied, "invalid_bearer_token", invalidBearerToken))
 				return
 			}
 			// Populate each claim on the context, if any
@@ -174,42 +172,65 @@ func validateRequiredScope(r *http.Request, params AuthParams) error {
 	return nil
 }
 
-func EnforceAuthenticationWithAuthorization(next http.HandlerFunc, params AuthParams) http.HandlerFunc {
-	var defaultRegistry prometheus.Registerer
-	metrics := newAuthMetrics(defaultRegistry)
-
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		logger := log.Get(ctx)
-		labels := prometheus.Labels{
-			"path":   writer.FetchRoutePathTemplate(r),
-			"method": r.Method,
-		}
+// AuthorizedHandler enforces authentication for a single HTTP handler and, if RequiredScopes are
+// given, that the token grants every required scope. The route inventory of the http package
+// reports the Params of routes whose handler is an AuthorizedHandler. AuthorizedHandlers must be
+// created with EnforceAuthenticationWithAuthorization, which configures their metrics.
+type AuthorizedHandler struct {
+	Next    http.Handler
+	metrics authMetrics
+	Params  AuthParams
+}
 
-		isAuthenticated := ctx.Value(JWTClaimKey) != nil
-		if !isAuthenticated {
-			logger.Debug("authentication enforcement failed on request")
-			metrics.authFailureCounter.With(labels).Inc()
-			w.Header().Set("WWW-Authenticate", "Bearer")
-			http.Error(w, bearerPrefixNotFound, http.StatusUnauthorized)
-			return
-		}
+// ServeHTTP rejects unauthenticated requests with a 401 and requests lacking a required scope
+// with a 403, and otherwise calls the next handler
+func (ah AuthorizedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := log.Get(ctx)
+	labels := prometheus.Labels{
+		"path":   writer.FetchRoutePathTemplate(r),
+		"method": r.Method,
+	}
 
-		if err := validateRequiredScope(r, params); err != nil {
-			logger.Debug("authorization enforcement failed on request")
-			metrics.authFailureCounter.With(labels).Inc()
-			http.Error(w, err.Error(), http.StatusForbidden)
-			return
-		}
+	isAuthenticated := ctx.Value(JWTClaimKey) != nil
+	if !isAuthenticated {
+		logger.Debug("authentication enforcement failed on request")
+		ah.metrics.authFailureCounter.With(labels).Inc()
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		errors.WriteHTTP(w, r, errors.New(errors.Unauthenticated, "bearer_prefix_not_found", bearerPrefixNotFound))
+		return
+	}
 
-		logger.Debug("authentication successfully enforced on request")
-		metrics.authSuccessCounter.With(labels).Inc()
-		next(w, r)
+	if err := validateRequiredScope(r, ah.Params); err != nil {
+		logger.Debug("authorization enforcement failed on request")
+		ah.metrics.authFailureCounter.With(labels).Inc()
+		errors.WriteHTTP(w, r, errors.New(errors.PermissionDenied, "insufficient_scope", err.Error()))
+		return
+	}
+
+	logger.Debug("authentication successfully enforced on request")
+	ah.metrics.authSuccessCounter.With(labels).Inc()
+	ah.Next.ServeHTTP(w, r)
+}
+
+// Unwrap returns the handler protected by the AuthorizedHandler
+func (ah AuthorizedHandler) Unwrap() http.Handler {
+	return ah.Next
+}
+
+// EnforceAuthenticationWithAuthorization enforces authentication for a single HTTP handler and,
+// if RequiredScopes are given, that the token grants every required scope.
+func EnforceAuthenticationWithAuthorization(next http.HandlerFunc, params AuthParams) AuthorizedHandler {
+	var defaultRegistry prometheus.Registerer
+	return AuthorizedHandler{
+		Next:    next,
+		metrics: newAuthMetrics(defaultRegistry),
+		Params:  params,
 	}
 }
 
 // EnforceAuthentication enforces authentication for a single HTTP handler.
 // This handler only performs authentication.  For authorization see EnforceAuthenticationWithAuthorization
 func EnforceAuthentication(next http.HandlerFunc) http.HandlerFunc {
-	return EnforceAuthenticationWithAuthorization(next, AuthParams{})
+	return EnforceAuthenticationWithAuthorization(next, AuthParams{}).ServeHTTP
 }
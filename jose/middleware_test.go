@@ -21,6 +21,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/spothero/tools/errors"
 	"github.com/spothero/tools/http/mock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,7 +48,7 @@ func TestGetHTTPServerMiddleware(t *testing.T) {
 			authHeaderPresent:  true,
 			authHeader:         "bearer fake.jwt.header",
 			expectedStatusCode: 401,
-			expectedHeaders:    map[string]string{"WWW-Authenticate": "Bearer"},
+			expectedHeaders:    map[string]string{"WWW-Authenticate": "Bearer", "Content-Type": errors.ProblemContentType},
 		}, {
 			name:               "failed jwt parsings are rejected",
 			authHeaderPresent:  true,
@@ -55,6 +56,7 @@ func TestGetHTTPServerMiddleware(t *testing.T) {
 			jwt:                "fake.jwt.header",
 			parseJWTError:      true,
 			expectedStatusCode: 403,
+			expectedHeaders:    map[string]string{"Content-Type": errors.ProblemContentType},
 		}, {
 			name:                    "jwt tokens are parsed and placed in context when present",
 			authHeaderPresent:       true,
@@ -189,13 +191,14 @@ func TestEnforceAuthentication(t *testing.T) {
 			request, err := http.NewRequestWithContext(reqCtx, "GET", "url", nil)
 			assertTest.NoError(err)
 			responseRecorder := httptest.NewRecorder()
-			authenticatedHandler(responseRecorder, request)
+			authenticatedHandler.ServeHTTP(responseRecorder, request)
 			actualResponse := responseRecorder.Result()
 
 			if test.expectedAuthSuccess {
 				assertTest.Equal(http.StatusOK, actualResponse.StatusCode)
 			} else {
 				assertTest.Equal(http.StatusUnauthorized, actualResponse.StatusCode)
+				assertTest.Equal(errors.ProblemContentType, actualResponse.Header.Get("Content-Type"))
 			}
 		})
 	}
@@ -275,13 +278,14 @@ func TestEnforceAuthenticationWithAuthorization(t *testing.T) {
 			request, err := http.NewRequestWithContext(reqCtx, "GET", "url", nil)
 			assertTest.NoError(err)
 			responseRecorder := httptest.NewRecorder()
-			authenticatedHandler(responseRecorder, request)
+			authenticatedHandler.ServeHTTP(responseRecorder, request)
 			actualResponse := responseRecorder.Result()
 
 			if test.expectedAuthSuccess {
 				assertTest.Equal(http.StatusOK, actualResponse.StatusCode)
 			} else {
 				assertTest.Equal(http.StatusForbidden, actualResponse.StatusCode)
+				assertTest.Equal(errors.ProblemContentType, actualResponse.Header.Get("Content-Type"))
 			}
 		})
 	}
@@ -347,3 +351,21 @@ func TestValidateRequiredScope(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthorizedHandler(t *testing.T) {
+	next := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	handler := EnforceAuthenticationWithAuthorization(next, AuthParams{RequiredScopes: []string{"update:service"}})
+	assert.Equal(t, []string{"update:service"}, handler.Params.RequiredScopes)
+	assert.NotNil(t, handler.Unwrap())
+
+	unauthenticated := httptest.NewRecorder()
+	handler.ServeHTTP(unauthenticated, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, unauthenticated.Code)
+
+	ctx := Auth0Claim{Scope: "update:service"}.NewContext(context.WithValue(context.Background(), JWTClaimKey, true))
+	authorized := httptest.NewRecorder()
+	handler.ServeHTTP(authorized, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusOK, authorized.Code)
+}
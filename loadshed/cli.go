@@ -0,0 +1,26 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadshed
+
+import "github.com/spf13/pflag"
+
+// RegisterFlags registers adaptive concurrency limiting flags with pflags
+func (c *Config) RegisterFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&c.Enabled, "adaptive-concurrency-enabled", c.Enabled, "Reject requests with a 503 status when the server is overloaded, adjusting the number of requests permitted in flight from observed latency")
+	flags.IntVar(&c.InitialLimit, "adaptive-concurrency-initial-limit", c.InitialLimit, "Number of requests permitted in flight at startup. Defaults to 20.")
+	flags.IntVar(&c.MinLimit, "adaptive-concurrency-min-limit", c.MinLimit, "Lowest number of requests the limit may be reduced to. Defaults to 5.")
+	flags.IntVar(&c.MaxLimit, "adaptive-concurrency-max-limit", c.MaxLimit, "Highest number of requests the limit may be increased to. Defaults to 1000.")
+	flags.DurationVar(&c.RetryAfter, "adaptive-concurrency-retry-after", c.RetryAfter, "Time after which rejected clients are asked to retry. Defaults to 1s.")
+}
@@ -0,0 +1,42 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadshed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterFlags(t *testing.T) {
+	c := Config{}
+	flags := pflag.NewFlagSet("pflags", pflag.PanicOnError)
+	c.RegisterFlags(flags)
+	err := flags.Parse([]string{
+		"--adaptive-concurrency-enabled",
+		"--adaptive-concurrency-initial-limit", "50",
+		"--adaptive-concurrency-min-limit", "10",
+		"--adaptive-concurrency-max-limit", "500",
+		"--adaptive-concurrency-retry-after", "5s",
+	})
+	assert.NoError(t, err)
+	assert.True(t, c.Enabled)
+	assert.Equal(t, 50, c.InitialLimit)
+	assert.Equal(t, 10, c.MinLimit)
+	assert.Equal(t, 500, c.MaxLimit)
+	assert.Equal(t, 5*time.Second, c.RetryAfter)
+}
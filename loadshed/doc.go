@@ -0,0 +1,6 @@
+// Package loadshed provides adaptive concurrency limiting for HTTP and gRPC servers. The number of
+// requests permitted in flight is adjusted continuously from observed latency using a gradient
+// algorithm, so that a server sheds excess load with a 503 or Unavailable status when it or one
+// of its dependencies slows down, rather than accumulating requests until it fails. Health,
+// metrics and other administrative traffic bypasses the limit.
+package loadshed
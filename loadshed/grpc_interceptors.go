@@ -0,0 +1,83 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadshed
+
+import (
+	"context"
+	"time"
+
+	"github.com/spothero/tools/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// UnaryServerInterceptor limits the number of gRPC requests in flight. Requests received while the
+// limit is reached are rejected with an Unavailable status including a RetryInfo detail. Methods
+// matching the bypass prefixes are never limited. Requests which fail with an Unavailable or
+// DeadlineExceeded status are treated as dropped requests and reduce the limit.
+func (l *Limiter) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if bypassed(info.FullMethod, l.bypassMethods) {
+		return handler(ctx, req)
+	}
+	release, ok := l.acquire("grpc")
+	if !ok {
+		return nil, l.grpcRejection()
+	}
+	result := ignored
+	defer func() {
+		release(result)
+	}()
+	resp, err := handler(ctx, req)
+	result = grpcOutcome(err)
+	return resp, err
+}
+
+// StreamServerInterceptor limits the number of gRPC streams open. Streams opened while the limit
+// is reached are rejected with an Unavailable status including a RetryInfo detail. Methods
+// matching the bypass prefixes are never limited. Because the lifetime of a stream does not
+// reflect the latency of the server, streams occupy a slot while open but do not adjust the limit.
+func (l *Limiter) StreamServerInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if bypassed(info.FullMethod, l.bypassMethods) {
+		return handler(srv, stream)
+	}
+	release, ok := l.acquire("grpc")
+	if !ok {
+		return l.grpcRejection()
+	}
+	defer release(ignored)
+	return handler(srv, stream)
+}
+
+// grpcRejection returns an Unavailable status error asking the client to retry later
+func (l *Limiter) grpcRejection() error {
+	st := errors.New(errors.Unavailable, "overloaded", "server is overloaded").GRPCStatus()
+	retryDelay := time.Duration(l.retryAfterSeconds()) * time.Second
+	if withRetryInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)}); err == nil {
+		st = withRetryInfo
+	}
+	return st.Err()
+}
+
+// grpcOutcome classifies a gRPC request by the error returned by its handler
+func grpcOutcome(err error) outcome {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return dropped
+	}
+	return succeeded
+}
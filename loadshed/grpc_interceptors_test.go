@@ -0,0 +1,128 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadshed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mockServerStream is a grpc.ServerStream which only provides a context
+type mockServerStream struct {
+	grpc.ServerStream
+}
+
+func (mockServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		handlerErr   error
+		name         string
+		method       string
+		saturated    bool
+		expectedCode codes.Code
+		expectDrop   bool
+	}{
+		{
+			name:         "requests within the limit are allowed",
+			method:       "/spothero.v1.Spots/GetSpot",
+			expectedCode: codes.OK,
+		}, {
+			name:         "requests exceeding the limit are rejected",
+			method:       "/spothero.v1.Spots/GetSpot",
+			saturated:    true,
+			expectedCode: codes.Unavailable,
+		}, {
+			name:         "health checks bypass the limit",
+			method:       "/grpc.health.v1.Health/Check",
+			saturated:    true,
+			expectedCode: codes.OK,
+		}, {
+			name:         "requests exceeding their deadline reduce the limit",
+			method:       "/spothero.v1.Spots/GetSpot",
+			handlerErr:   status.Error(codes.DeadlineExceeded, "deadline exceeded"),
+			expectedCode: codes.DeadlineExceeded,
+			expectDrop:   true,
+		}, {
+			name:         "other errors do not reduce the limit",
+			method:       "/spothero.v1.Spots/GetSpot",
+			handlerErr:   status.Error(codes.NotFound, "not found"),
+			expectedCode: codes.NotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := Config{Registry: prometheus.NewRegistry(), InitialLimit: 10, MinLimit: 1, RetryAfter: 2 * time.Second}.NewLimiter()
+			if test.saturated {
+				for i := 0; i < 10; i++ {
+					release, ok := limiter.acquire("grpc")
+					require.True(t, ok)
+					defer release(ignored)
+				}
+			}
+			_, err := limiter.UnaryServerInterceptor(
+				context.Background(),
+				"request",
+				&grpc.UnaryServerInfo{FullMethod: test.method},
+				func(context.Context, interface{}) (interface{}, error) { return "response", test.handlerErr },
+			)
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			if test.saturated && test.expectedCode == codes.Unavailable {
+				var retryInfo *errdetails.RetryInfo
+				for _, detail := range status.Convert(err).Details() {
+					if ri, ok := detail.(*errdetails.RetryInfo); ok {
+						retryInfo = ri
+					}
+				}
+				require.NotNil(t, retryInfo)
+				assert.Equal(t, 2*time.Second, retryInfo.RetryDelay.AsDuration())
+				assert.Equal(t, 1.0, testutil.ToFloat64(limiter.rejections.WithLabelValues("grpc")))
+			}
+			if test.expectDrop {
+				assert.Less(t, limiter.limit, 10.0)
+			} else {
+				assert.Equal(t, 10.0, limiter.limit)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	limiter := Config{Registry: prometheus.NewRegistry(), InitialLimit: 1, MinLimit: 1}.NewLimiter()
+	info := &grpc.StreamServerInfo{FullMethod: "/spothero.v1.Spots/WatchSpots"}
+
+	// streams occupy a slot while open without adjusting the limit
+	err := limiter.StreamServerInterceptor(nil, mockServerStream{}, info, func(interface{}, grpc.ServerStream) error {
+		assert.Equal(t, 1.0, testutil.ToFloat64(limiter.inFlightGauge))
+		inner := limiter.StreamServerInterceptor(nil, mockServerStream{}, info, func(interface{}, grpc.ServerStream) error { return nil })
+		assert.Equal(t, codes.Unavailable, status.Code(inner))
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 0.0, testutil.ToFloat64(limiter.inFlightGauge))
+	assert.Equal(t, 1.0, limiter.limit)
+}
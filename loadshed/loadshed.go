@@ -0,0 +1,231 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadshed
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// tolerance is the ratio by which latency may exceed its long-term average before the limit is reduced
+	tolerance = 1.5
+	// smoothing is the weight given to each newly calculated limit
+	smoothing = 0.2
+	// longWindow is the number of samples over which the long-term average latency is calculated
+	longWindow = 600
+	// dropRatio is the factor by which the limit is reduced when a request is dropped
+	dropRatio = 0.9
+)
+
+// outcome describes how a request completed for the purposes of adjusting the limit
+type outcome int
+
+const (
+	// succeeded requests contribute their latency to the limit
+	succeeded outcome = iota
+	// dropped requests, such as those which timed out, reduce the limit
+	dropped
+	// ignored requests, such as long-lived streams, do not affect the limit
+	ignored
+)
+
+// Config defines the configuration of a Limiter
+type Config struct {
+	Registry      prometheus.Registerer // The Prometheus Registry to use. If nil, the global registry is used.
+	BypassPaths   []string              // HTTP paths, and the paths beneath them, which are never limited. Defaults to the health, metrics, pprof, log level and version endpoints.
+	BypassMethods []string              // gRPC full method name prefixes, ending at a `/`, which are never limited. Defaults to the gRPC health service.
+	RetryAfter    time.Duration         // Time after which rejected clients are asked to retry. Defaults to one second.
+	InitialLimit  int                   // Number of requests permitted in flight at startup. Defaults to 20.
+	MinLimit      int                   // Lowest number of requests the limit may be reduced to. Defaults to 5.
+	MaxLimit      int                   // Highest number of requests the limit may be increased to. Defaults to 1000.
+	Enabled       bool                  // Whether requests are limited
+}
+
+// Limiter limits the number of requests in flight, adjusting the limit from observed latency.
+// The limit is reduced when latency rises above its long-term average, and increased by roughly
+// the square root of the limit while latency remains stable and the limit is in use. Requests
+// which time out or fail because a dependency is unavailable reduce the limit multiplicatively.
+type Limiter struct {
+	mutex         *sync.Mutex
+	now           func() time.Time
+	limitGauge    prometheus.Gauge
+	inFlightGauge prometheus.Gauge
+	rejections    *prometheus.CounterVec
+	bypassPaths   []string
+	bypassMethods []string
+	limit         float64
+	minLimit      float64
+	maxLimit      float64
+	longLatency   float64
+	inFlight      int
+	retryAfter    time.Duration
+}
+
+// NewLimiter creates a Limiter from the Config. The current limit, the number of requests in
+// flight and the number of rejected requests by protocol are exported as the
+// `adaptive_concurrency_limit`, `adaptive_concurrency_in_flight` and
+// `adaptive_concurrency_rejections_total` metrics. If the metrics have already been registered,
+// the existing metrics are reused.
+func (c Config) NewLimiter() *Limiter {
+	// If the user has not provided a Prometheus Registry, use the global Registry
+	registry := c.Registry
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+	l := &Limiter{
+		mutex: &sync.Mutex{},
+		now:   time.Now,
+		limitGauge: registerCollector(registry, prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "adaptive_concurrency_limit",
+			Help: "Current number of requests permitted in flight by the adaptive concurrency limiter",
+		})).(prometheus.Gauge),
+		inFlightGauge: registerCollector(registry, prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "adaptive_concurrency_in_flight",
+			Help: "Number of requests in flight counted by the adaptive concurrency limiter",
+		})).(prometheus.Gauge),
+		rejections: registerCollector(registry, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "adaptive_concurrency_rejections_total",
+				Help: "Total number of requests rejected by the adaptive concurrency limiter, by protocol",
+			},
+			[]string{"protocol"},
+		)).(*prometheus.CounterVec),
+		bypassPaths:   c.BypassPaths,
+		bypassMethods: c.BypassMethods,
+		limit:         float64(c.InitialLimit),
+		minLimit:      float64(c.MinLimit),
+		maxLimit:      float64(c.MaxLimit),
+		retryAfter:    c.RetryAfter,
+	}
+	if l.bypassPaths == nil {
+		l.bypassPaths = []string{"/health", "/metrics", "/debug/", "/loglevel", "/version"}
+	}
+	if l.bypassMethods == nil {
+		l.bypassMethods = []string{"/grpc.health.v1.Health/"}
+	}
+	if l.minLimit <= 0 {
+		l.minLimit = 5
+	}
+	if l.maxLimit <= 0 {
+		l.maxLimit = 1000
+	}
+	if l.limit <= 0 {
+		l.limit = 20
+	}
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, l.limit))
+	if l.retryAfter <= 0 {
+		l.retryAfter = time.Second
+	}
+	l.limitGauge.Set(math.Floor(l.limit))
+	return l
+}
+
+// registerCollector registers the given collector, returning the existing collector if an
+// identical one has already been registered
+func registerCollector(registry prometheus.Registerer, collector prometheus.Collector) prometheus.Collector {
+	if err := registry.Register(collector); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		// metric has been registered before so use existing metric
+		return are.ExistingCollector
+	}
+	return collector
+}
+
+// acquire reserves a slot for a request if fewer requests than the limit are in flight. If a slot
+// is reserved, the returned function must be called with the outcome of the request when it
+// completes.
+func (l *Limiter) acquire(protocol string) (func(outcome), bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if float64(l.inFlight) >= math.Floor(l.limit) {
+		l.rejections.With(prometheus.Labels{"protocol": protocol}).Inc()
+		return nil, false
+	}
+	l.inFlight++
+	l.inFlightGauge.Inc()
+	inFlight := l.inFlight
+	start := l.now()
+	return func(result outcome) {
+		latency := l.now().Sub(start)
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.inFlight--
+		l.inFlightGauge.Dec()
+		l.update(result, latency, inFlight)
+	}, true
+}
+
+// update adjusts the limit following a request which completed with the given outcome and
+// latency while the given number of requests were in flight
+func (l *Limiter) update(result outcome, latency time.Duration, inFlight int) {
+	switch result {
+	case ignored:
+		return
+	case dropped:
+		l.setLimit(l.limit * dropRatio)
+		return
+	}
+	sample := latency.Seconds()
+	if sample <= 0 {
+		return
+	}
+	if l.longLatency == 0 {
+		l.longLatency = sample
+	} else {
+		l.longLatency += (sample - l.longLatency) / longWindow
+	}
+	// Recover quickly once a sustained period of high latency has passed
+	if l.longLatency/sample > 2 {
+		l.longLatency *= 0.95
+	}
+	// Latency does not indicate capacity while the limit is mostly unused
+	if float64(inFlight) < l.limit/2 {
+		return
+	}
+	gradient := math.Max(0.5, math.Min(1, tolerance*l.longLatency/sample))
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	l.setLimit(l.limit*(1-smoothing) + newLimit*smoothing)
+}
+
+// setLimit sets the limit within its bounds
+func (l *Limiter) setLimit(limit float64) {
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, limit))
+	l.limitGauge.Set(math.Floor(l.limit))
+}
+
+// bypassed returns true if name equals any of the given prefixes or begins with one followed by a
+// `/`, so that a prefix of /health matches /health/ready but not /healthcare
+func bypassed(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if name == prefix || strings.HasPrefix(name, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfterSeconds rounds the retry interval up to a whole number of seconds, with a minimum of
+// one second
+func (l *Limiter) retryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(l.retryAfter.Seconds())))
+}
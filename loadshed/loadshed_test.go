@@ -0,0 +1,212 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadshed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockClock is a clock which advances only when told to
+type mockClock struct {
+	now time.Time
+}
+
+func (mc *mockClock) Now() time.Time {
+	return mc.now
+}
+
+func TestNewLimiter(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		expectedLimit float64
+		expectedMin   float64
+		expectedMax   float64
+		expectedRetry time.Duration
+	}{
+		{
+			name:          "defaults are applied",
+			config:        Config{},
+			expectedLimit: 20,
+			expectedMin:   5,
+			expectedMax:   1000,
+			expectedRetry: time.Second,
+		}, {
+			name:          "configured values are used",
+			config:        Config{InitialLimit: 50, MinLimit: 10, MaxLimit: 100, RetryAfter: 5 * time.Second},
+			expectedLimit: 50,
+			expectedMin:   10,
+			expectedMax:   100,
+			expectedRetry: 5 * time.Second,
+		}, {
+			name:          "the initial limit is clamped to the maximum",
+			config:        Config{InitialLimit: 50, MaxLimit: 10},
+			expectedLimit: 10,
+			expectedMin:   5,
+			expectedMax:   10,
+			expectedRetry: time.Second,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.Registry = prometheus.NewRegistry()
+			l := test.config.NewLimiter()
+			assert.Equal(t, test.expectedLimit, l.limit)
+			assert.Equal(t, test.expectedMin, l.minLimit)
+			assert.Equal(t, test.expectedMax, l.maxLimit)
+			assert.Equal(t, test.expectedRetry, l.retryAfter)
+			assert.Equal(t, test.expectedLimit, testutil.ToFloat64(l.limitGauge))
+			assert.NotEmpty(t, l.bypassPaths)
+			assert.NotEmpty(t, l.bypassMethods)
+		})
+	}
+}
+
+func TestNewLimiterReusesMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	first := Config{Registry: registry}.NewLimiter()
+	second := Config{Registry: registry}.NewLimiter()
+	assert.Equal(t, first.limitGauge, second.limitGauge)
+	assert.Equal(t, first.rejections, second.rejections)
+}
+
+func TestAcquire(t *testing.T) {
+	l := Config{Registry: prometheus.NewRegistry(), InitialLimit: 2, MinLimit: 1}.NewLimiter()
+	release1, ok := l.acquire("http")
+	require.True(t, ok)
+	release2, ok := l.acquire("http")
+	require.True(t, ok)
+	assert.Equal(t, 2.0, testutil.ToFloat64(l.inFlightGauge))
+
+	_, ok = l.acquire("http")
+	assert.False(t, ok)
+	assert.Equal(t, 1.0, testutil.ToFloat64(l.rejections.WithLabelValues("http")))
+
+	release1(ignored)
+	release2(ignored)
+	assert.Equal(t, 0.0, testutil.ToFloat64(l.inFlightGauge))
+	_, ok = l.acquire("http")
+	assert.True(t, ok)
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		latencies  []time.Duration
+		result     outcome
+		inFlight   int
+		expectGrow bool
+		expectDrop bool
+	}{
+		{
+			name:       "the limit grows while latency is stable and the limit is in use",
+			latencies:  []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond},
+			result:     succeeded,
+			inFlight:   20,
+			expectGrow: true,
+		}, {
+			name:       "the limit shrinks when latency rises above its long-term average",
+			latencies:  []time.Duration{10 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond},
+			result:     succeeded,
+			inFlight:   20,
+			expectDrop: true,
+		}, {
+			name:      "the limit is unchanged while it is mostly unused",
+			latencies: []time.Duration{10 * time.Millisecond, 100 * time.Millisecond},
+			result:    succeeded,
+			inFlight:  2,
+		}, {
+			name:       "dropped requests shrink the limit",
+			latencies:  []time.Duration{10 * time.Millisecond},
+			result:     dropped,
+			inFlight:   20,
+			expectDrop: true,
+		}, {
+			name:      "ignored requests do not change the limit",
+			latencies: []time.Duration{10 * time.Millisecond},
+			result:    ignored,
+			inFlight:  20,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := Config{Registry: prometheus.NewRegistry(), InitialLimit: 20}.NewLimiter()
+			for _, latency := range test.latencies {
+				l.update(test.result, latency, test.inFlight)
+			}
+			switch {
+			case test.expectGrow:
+				assert.Greater(t, l.limit, 20.0)
+			case test.expectDrop:
+				assert.Less(t, l.limit, 20.0)
+			default:
+				assert.Equal(t, 20.0, l.limit)
+			}
+			assert.Equal(t, float64(int(l.limit)), testutil.ToFloat64(l.limitGauge))
+		})
+	}
+}
+
+func TestUpdateBounds(t *testing.T) {
+	l := Config{Registry: prometheus.NewRegistry(), InitialLimit: 10, MinLimit: 8, MaxLimit: 12}.NewLimiter()
+	for i := 0; i < 100; i++ {
+		l.update(succeeded, 10*time.Millisecond, 12)
+	}
+	assert.Equal(t, 12.0, l.limit)
+	for i := 0; i < 100; i++ {
+		l.update(dropped, 0, 12)
+	}
+	assert.Equal(t, 8.0, l.limit)
+}
+
+func TestAcquireMeasuresLatency(t *testing.T) {
+	clock := &mockClock{now: time.Unix(0, 0)}
+	l := Config{Registry: prometheus.NewRegistry(), InitialLimit: 2, MinLimit: 1}.NewLimiter()
+	l.now = clock.Now
+	release, ok := l.acquire("grpc")
+	require.True(t, ok)
+	clock.now = clock.now.Add(50 * time.Millisecond)
+	release(succeeded)
+	assert.Equal(t, 0.05, l.longLatency)
+}
+
+func TestBypassed(t *testing.T) {
+	prefixes := []string{"/health", "/debug/", "/grpc.health.v1.Health/"}
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"/health", true},
+		{"/health/ready", true},
+		{"/debug/pprof/heap", true},
+		{"/debug", false},
+		{"/grpc.health.v1.Health/Check", true},
+		{"/healthcare", false},
+		{"/health-check", false},
+		{"/debugger", false},
+		{"/grpc.health.v1.HealthCheck/Check", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, bypassed(test.name, prefixes))
+		})
+	}
+}
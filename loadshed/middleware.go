@@ -0,0 +1,60 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadshed
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/spothero/tools/errors"
+	"github.com/spothero/tools/http/writer"
+)
+
+// HTTPServerMiddleware limits the number of HTTP requests in flight. Requests received while the
+// limit is reached are rejected with a 503 status, a Retry-After header and a problem details
+// body. Requests to the bypass paths are never limited. Responses with a 503 or 504 status are
+// treated as dropped requests and reduce the limit.
+func (l *Limiter) HTTPServerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bypassed(r.URL.Path, l.bypassPaths) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		release, ok := l.acquire("http")
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(l.retryAfterSeconds()))
+			errors.WriteHTTP(w, r, errors.New(errors.Unavailable, "overloaded", "server is overloaded"))
+			return
+		}
+		wrappedWriter, recorder := writer.Wrap(w)
+		result := ignored
+		defer func() {
+			release(result)
+		}()
+		next.ServeHTTP(wrappedWriter, r)
+		result = httpOutcome(recorder.StatusCode)
+	})
+}
+
+// httpOutcome classifies a response by its status code
+func httpOutcome(statusCode int) outcome {
+	switch statusCode {
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return dropped
+	case http.StatusSwitchingProtocols:
+		return ignored
+	}
+	return succeeded
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadshed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spothero/tools/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPServerMiddleware(t *testing.T) {
+	tests := []struct {
+		name               string
+		path               string
+		handlerStatusCode  int
+		saturated          bool
+		expectedStatusCode int
+		expectRejection    bool
+		expectDrop         bool
+	}{
+		{
+			name:               "requests within the limit are allowed",
+			path:               "/v1/spots",
+			handlerStatusCode:  http.StatusOK,
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name:               "requests exceeding the limit are rejected",
+			path:               "/v1/spots",
+			handlerStatusCode:  http.StatusOK,
+			saturated:          true,
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectRejection:    true,
+		}, {
+			name:               "health checks bypass the limit",
+			path:               "/health",
+			handlerStatusCode:  http.StatusOK,
+			saturated:          true,
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name:               "metrics bypass the limit",
+			path:               "/metrics",
+			handlerStatusCode:  http.StatusOK,
+			saturated:          true,
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name:               "admin endpoints bypass the limit",
+			path:               "/debug/pprof/heap",
+			handlerStatusCode:  http.StatusOK,
+			saturated:          true,
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name:               "paths which only share a prefix with a bypass path are limited",
+			path:               "/healthcare",
+			handlerStatusCode:  http.StatusOK,
+			saturated:          true,
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectRejection:    true,
+		}, {
+			name:               "timed out requests reduce the limit",
+			path:               "/v1/spots",
+			handlerStatusCode:  http.StatusGatewayTimeout,
+			expectedStatusCode: http.StatusGatewayTimeout,
+			expectDrop:         true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := Config{Registry: prometheus.NewRegistry(), InitialLimit: 10, MinLimit: 1}.NewLimiter()
+			if test.saturated {
+				for i := 0; i < 10; i++ {
+					release, ok := limiter.acquire("http")
+					require.True(t, ok)
+					defer release(ignored)
+				}
+			}
+			handler := limiter.HTTPServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(test.handlerStatusCode)
+			}))
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+			assert.Equal(t, test.expectedStatusCode, recorder.Code)
+			if test.expectRejection {
+				assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+				assert.Equal(t, errors.ProblemContentType, recorder.Header().Get("Content-Type"))
+				assert.Equal(t, 1.0, testutil.ToFloat64(limiter.rejections.WithLabelValues("http")))
+			} else {
+				assert.Empty(t, recorder.Header().Get("Retry-After"))
+			}
+			if test.expectDrop {
+				assert.Less(t, limiter.limit, 10.0)
+			} else {
+				assert.Equal(t, 10.0, limiter.limit)
+			}
+		})
+	}
+}
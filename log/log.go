@@ -40,6 +40,10 @@ var loggerMutex = &sync.Mutex{}
 
 var globalLogLevel = zap.NewAtomicLevel()
 
+// replaceGRPCLogger ensures the gRPC logger is only replaced once, as it may not safely be
+// replaced while gRPC is in use
+var replaceGRPCLogger = &sync.Once{}
+
 // Config defines the necessary configuration for instantiating a Logger
 type Config struct {
 	Fields               map[string]interface{} // These fields will be applied to all logs. Strongly recommend `version` at a minimum.
@@ -123,7 +127,63 @@ func (c Config) InitializeLogger() error {
 	if logger, err = logConfig.Build(c.Options...); err != nil {
 		return fmt.Errorf("error initializing logger - %s", err.Error())
 	}
-	grpc_zap.ReplaceGrpcLoggerV2(logger)
+	replaceGRPCLogger.Do(func() {
+		grpc_zap.ReplaceGrpcLoggerV2(zap.New(globalCore{}))
+	})
+	return nil
+}
+
+// globalLogger returns the global logger
+func globalLogger() *zap.Logger {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	return logger
+}
+
+// globalCore is a zapcore.Core which writes to the core of the current global logger, so that
+// loggers built from it follow any later calls to InitializeLogger
+type globalCore struct {
+	fields []zapcore.Field
+}
+
+// core returns the core of the global logger with any fields added to this core
+func (gc globalCore) core() zapcore.Core {
+	return globalLogger().Core().With(gc.fields)
+}
+
+// Enabled implements zapcore.LevelEnabler
+func (gc globalCore) Enabled(level zapcore.Level) bool {
+	return gc.core().Enabled(level)
+}
+
+// With implements zapcore.Core
+func (gc globalCore) With(fields []zapcore.Field) zapcore.Core {
+	return globalCore{fields: append(append([]zapcore.Field{}, gc.fields...), fields...)}
+}
+
+// Check implements zapcore.Core
+func (gc globalCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return gc.core().Check(entry, checked)
+}
+
+// Write implements zapcore.Core
+func (gc globalCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return gc.core().Write(entry, fields)
+}
+
+// Sync implements zapcore.Core
+func (gc globalCore) Sync() error {
+	return globalLogger().Core().Sync()
+}
+
+// Reload re-applies the settings of the Config which may be changed at runtime. Only the Level
+// may be changed without re-initializing the logger; all other settings are ignored.
+func (c Config) Reload() error {
+	var level zapcore.Level
+	if err := level.Set(c.Level); err != nil {
+		return fmt.Errorf("invalid log level %s: %w", c.Level, err)
+	}
+	globalLogLevel.SetLevel(level)
 	return nil
 }
 
@@ -134,7 +194,7 @@ func (c Config) InitializeLogger() error {
 // unpacked the Trace ID, you may wish to log that information with every future request.
 func NewContext(ctx context.Context, l *zap.Logger) context.Context {
 	if l == nil {
-		return context.WithValue(ctx, logKey, logger)
+		return context.WithValue(ctx, logKey, globalLogger())
 	}
 	return context.WithValue(ctx, logKey, l)
 }
@@ -144,12 +204,12 @@ func NewContext(ctx context.Context, l *zap.Logger) context.Context {
 // context is passed, the default global logger is returned.
 func Get(ctx context.Context) *zap.Logger {
 	if ctx == nil {
-		return logger
+		return globalLogger()
 	}
 	if ctxLogger, ok := ctx.Value(logKey).(*zap.Logger); ok {
 		return ctxLogger
 	}
-	return logger
+	return globalLogger()
 }
 
 // RegisterLogLevelHandler registers an endpoint handler with the specified router to change the global log level
@@ -23,6 +23,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/grpclog"
 )
 
 func TestGet(t *testing.T) {
@@ -142,3 +144,26 @@ func TestInitializeLogger(t *testing.T) {
 		})
 	}
 }
+
+func TestInitializeLoggerGRPC(t *testing.T) {
+	// the gRPC logger writes to the most recently initialized logger
+	for i := 0; i < 2; i++ {
+		core, logs := observer.New(zapcore.InfoLevel)
+		assert.NoError(t, Config{Cores: []zapcore.Core{core}}.InitializeLogger())
+		grpclog.Info("transport closed")
+		entries := logs.FilterMessage("transport closed").All()
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, "grpc", entries[0].ContextMap()["system"])
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	defer globalLogLevel.SetLevel(globalLogLevel.Level())
+	assert.NoError(t, Config{Level: "debug"}.Reload())
+	assert.Equal(t, zapcore.DebugLevel, globalLogLevel.Level())
+	assert.NoError(t, Config{Level: "warn"}.Reload())
+	assert.Equal(t, zapcore.WarnLevel, globalLogLevel.Level())
+	assert.Error(t, Config{Level: "DOESNOTEXIST"}.Reload())
+	assert.Equal(t, zapcore.WarnLevel, globalLogLevel.Level())
+}
@@ -54,6 +54,7 @@ func getFields(r *http.Request) []zap.Field {
 //
 // On outbound response return these attributes include all of the above as well as:
 // * HTTP response code
+// * HTTP response size
 // Note that this middleware must be attached after writer.StatusRecorderMiddleware
 // for HTTP response code logging to function and after tracing.HTTPServerMiddleware for trace ids
 // to show up in logs.
@@ -63,13 +64,12 @@ func HTTPServerMiddleware(next http.Handler) http.Handler {
 		httpLogger := Get(r.Context()).Named("http").With(getFields(r)...)
 		httpLogger.Debug("http request received")
 		defer func() {
-			var responseCodeField zap.Field
-			if statusRecorder, ok := w.(*writer.StatusRecorder); ok {
+			responseCodeField, responseBytesField := zap.Skip(), zap.Skip()
+			if statusRecorder, ok := writer.Recorder(w); ok {
 				responseCodeField = zap.Int("http.status_code", statusRecorder.StatusCode)
-			} else {
-				responseCodeField = zap.Skip()
+				responseBytesField = zap.Int64("http.response_bytes", statusRecorder.BytesWritten)
 			}
-			httpLogger = httpLogger.With(responseCodeField, zap.Duration("http.duration", time.Since(startTime)))
+			httpLogger = httpLogger.With(responseCodeField, responseBytesField, zap.Duration("http.duration", time.Since(startTime)))
 			httpLogger.Debug("http response returned")
 			r = r.WithContext(NewContext(r.Context(), httpLogger))
 		}()
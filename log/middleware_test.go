@@ -70,8 +70,8 @@ func TestHTTPServerMiddleware(t *testing.T) {
 	for idx, field := range currLogs[1].Context {
 		foundLogKeysResponse[idx] = field.Key
 	}
-	assert.ElementsMatch(t, []string{"http.url", "http.method", "http.path", "http.status_code", "http.duration", "http.user_agent", "http.content_length"}, foundLogKeysResponse)
-	assert.Equal(t, currLogs[1].Context[len(currLogs[1].Context)-2].Integer, int64(statusCode))
+	assert.ElementsMatch(t, []string{"http.url", "http.method", "http.path", "http.status_code", "http.response_bytes", "http.duration", "http.user_agent", "http.content_length"}, foundLogKeysResponse)
+	assert.Equal(t, int64(statusCode), currLogs[1].ContextMap()["http.status_code"])
 }
 
 func TestRoundTripper(t *testing.T) {
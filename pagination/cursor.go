@@ -0,0 +1,122 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	shErrors "github.com/spothero/tools/errors"
+)
+
+// Direction is the direction of navigation relative to a cursor
+type Direction string
+
+// Directions of navigation
+const (
+	After  Direction = "after"  // The page contains the elements following the cursor
+	Before Direction = "before" // The page contains the elements preceding the cursor
+)
+
+var (
+	// ErrInvalidCursor is returned when a cursor is malformed or its signature does not match
+	ErrInvalidCursor = shErrors.New(shErrors.InvalidArgument, "invalid_cursor", "the pagination cursor is invalid")
+	// ErrInvalidLimit is returned when a requested page size is not a positive integer
+	ErrInvalidLimit = shErrors.New(shErrors.InvalidArgument, "invalid_limit", "the page size must be a positive integer")
+)
+
+// Cursor identifies a position in an ordered collection by the sort keys of the element at that
+// position, and the direction in which to navigate from it
+type Cursor struct {
+	Direction Direction `json:"d"`
+	Keys      []string  `json:"k"`
+}
+
+// Config contains the configuration necessary for paginating collections
+type Config struct {
+	SigningKey   []byte // Secret used to sign cursors so that clients cannot forge them
+	DefaultLimit int    // Page size used when a request does not specify one. Defaults to 20.
+	MaxLimit     int    // Largest page size a request may specify. Defaults to 100.
+}
+
+// Paginator issues and verifies cursors and bounds page sizes
+type Paginator struct {
+	signingKey   []byte
+	defaultLimit int
+	maxLimit     int
+}
+
+// NewPaginator creates a Paginator from the Config. NewPaginator panics if no signing key is
+// provided.
+func (c Config) NewPaginator() Paginator {
+	if len(c.SigningKey) == 0 {
+		panic("a signing key is required for pagination cursors")
+	}
+	p := Paginator{signingKey: c.SigningKey, defaultLimit: c.DefaultLimit, maxLimit: c.MaxLimit}
+	if p.defaultLimit <= 0 {
+		p.defaultLimit = 20
+	}
+	if p.maxLimit <= 0 {
+		p.maxLimit = 100
+	}
+	if p.defaultLimit > p.maxLimit {
+		p.defaultLimit = p.maxLimit
+	}
+	return p
+}
+
+// EncodeCursor returns the opaque representation of the cursor. The cursor is signed with the
+// signing key so that it may be safely handed to clients.
+func (p Paginator) EncodeCursor(cursor Cursor) string {
+	// Marshalling a struct of strings cannot fail
+	payload, _ := json.Marshal(cursor)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(p.sign(encoded))
+}
+
+// DecodeCursor verifies and decodes a cursor returned by EncodeCursor. ErrInvalidCursor is
+// returned if the cursor is malformed or has been tampered with.
+func (p Paginator) DecodeCursor(token string) (Cursor, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decodedSignature, p.sign(encoded)) {
+		return Cursor{}, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(payload, &cursor); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if cursor.Direction != After && cursor.Direction != Before {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// sign returns the HMAC-SHA256 signature of the encoded cursor payload
+func (p Paginator) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, p.signingKey)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
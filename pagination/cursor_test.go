@@ -0,0 +1,82 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPaginator(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected Paginator
+	}{
+		{
+			name:     "limits default when not provided",
+			config:   Config{SigningKey: []byte("secret")},
+			expected: Paginator{signingKey: []byte("secret"), defaultLimit: 20, maxLimit: 100},
+		},
+		{
+			name:     "the default limit may not exceed the maximum limit",
+			config:   Config{SigningKey: []byte("secret"), DefaultLimit: 50, MaxLimit: 10},
+			expected: Paginator{signingKey: []byte("secret"), defaultLimit: 10, maxLimit: 10},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.config.NewPaginator())
+		})
+	}
+	assert.Panics(t, func() { Config{}.NewPaginator() })
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	p := Config{SigningKey: []byte("secret")}.NewPaginator()
+	cursor := Cursor{Direction: Before, Keys: []string{"2024-03-01T00:00:00Z", "42"}}
+	token := p.EncodeCursor(cursor)
+	decoded, err := p.DecodeCursor(token)
+	require.NoError(t, err)
+	assert.Equal(t, cursor, decoded)
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	p := Config{SigningKey: []byte("secret")}.NewPaginator()
+	token := p.EncodeCursor(Cursor{Direction: After, Keys: []string{"42"}})
+	payload, signature, _ := strings.Cut(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"d":"after","k":["43"]}`))
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"tokens without a signature are rejected", payload},
+		{"tampered payloads are rejected", forged + "." + signature},
+		{"malformed signatures are rejected", payload + ".!!"},
+		{"tokens signed with another key are rejected", Config{SigningKey: []byte("other")}.NewPaginator().EncodeCursor(Cursor{Direction: After})},
+		{"malformed payloads are rejected", "!!." + base64.RawURLEncoding.EncodeToString(p.sign("!!"))},
+		{"unknown directions are rejected", p.EncodeCursor(Cursor{Direction: "sideways"})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := p.DecodeCursor(test.token)
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
@@ -1,2 +1,4 @@
-// Package pagination provides a simple pagination inteface for ordered items with string IDs.
+// Package pagination provides opaque, signed cursor pagination for ordered collections, with
+// helpers for parsing page requests from and writing pages to HTTP responses. A simple
+// pagination interface for ordered items with string IDs is also provided.
 package pagination
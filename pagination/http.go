@@ -0,0 +1,73 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ParseRequest parses the page requested by the `limit` and `cursor` query parameters of the
+// request. If no limit is given the default limit is used, and limits above the maximum are
+// reduced to it. ErrInvalidLimit or ErrInvalidCursor is returned if either parameter is invalid.
+// Both render as a 400 problem with errors.WriteHTTP.
+func (p Paginator) ParseRequest(r *http.Request) (Request, error) {
+	query := r.URL.Query()
+	req := Request{Limit: p.defaultLimit}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed <= 0 {
+			return Request{}, ErrInvalidLimit
+		}
+		req.Limit = p.limit(parsed)
+	}
+	if token := query.Get("cursor"); token != "" {
+		cursor, err := p.DecodeCursor(token)
+		if err != nil {
+			return Request{}, err
+		}
+		req.Cursor = &cursor
+	}
+	return req, nil
+}
+
+// SetLinkHeader sets an RFC 8288 `Link` header on the response with `next` and `prev` links to
+// the adjacent pages, if any. The links retain the path and other query parameters of the request.
+func (pg Page[T]) SetLinkHeader(w http.ResponseWriter, r *http.Request) {
+	links := make([]string, 0, 2)
+	for _, link := range []struct{ rel, cursor string }{{"next", pg.Next}, {"prev", pg.Prev}} {
+		if link.cursor == "" {
+			continue
+		}
+		query := r.URL.Query()
+		query.Set("cursor", link.cursor)
+		target := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, target.String(), link.rel))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// WriteJSON writes the page to the response as a JSON envelope containing the `items` and the
+// `next` and `prev` cursors
+func (pg Page[T]) WriteJSON(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pg)
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequest(t *testing.T) {
+	p := Config{SigningKey: []byte("secret"), DefaultLimit: 10, MaxLimit: 50}.NewPaginator()
+	cursor := Cursor{Direction: After, Keys: []string{"42"}}
+	tests := []struct {
+		expectedErr error
+		name        string
+		query       string
+		expected    Request
+	}{
+		{
+			name:     "the default limit is used when none is given",
+			expected: Request{Limit: 10},
+		},
+		{
+			name:     "limits and cursors are parsed",
+			query:    "limit=5&cursor=" + url.QueryEscape(p.EncodeCursor(cursor)),
+			expected: Request{Limit: 5, Cursor: &cursor},
+		},
+		{
+			name:     "limits above the maximum are reduced",
+			query:    "limit=500",
+			expected: Request{Limit: 50},
+		},
+		{
+			name:        "non-positive limits are rejected",
+			query:       "limit=0",
+			expectedErr: ErrInvalidLimit,
+		},
+		{
+			name:        "non-integer limits are rejected",
+			query:       "limit=ten",
+			expectedErr: ErrInvalidLimit,
+		},
+		{
+			name:        "invalid cursors are rejected",
+			query:       "cursor=forged",
+			expectedErr: ErrInvalidCursor,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := p.ParseRequest(httptest.NewRequest(http.MethodGet, "/spots?"+test.query, nil))
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, req)
+		})
+	}
+}
+
+func TestSetLinkHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     Page[string]
+		expected string
+	}{
+		{
+			name:     "next and prev links are set",
+			page:     Page[string]{Next: "n", Prev: "p"},
+			expected: `</spots?cursor=n&limit=5>; rel="next", </spots?cursor=p&limit=5>; rel="prev"`,
+		},
+		{
+			name:     "missing links are omitted",
+			page:     Page[string]{Next: "n"},
+			expected: `</spots?cursor=n&limit=5>; rel="next"`,
+		},
+		{
+			name: "no header is set for a single page",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			test.page.SetLinkHeader(recorder, httptest.NewRequest(http.MethodGet, "/spots?limit=5&cursor=c", nil))
+			assert.Equal(t, test.expected, recorder.Header().Get("Link"))
+		})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Page[string]{Items: []string{"a", "b"}, Next: "n"}.WriteJSON(recorder)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&body))
+	assert.Equal(t, map[string]interface{}{"items": []interface{}{"a", "b"}, "next": "n"}, body)
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"slices"
+	"sort"
+)
+
+// Request describes the page of a collection requested by a client
+type Request struct {
+	Cursor *Cursor // The position to navigate from, or nil for the first page
+	Limit  int     // The maximum number of elements in the page
+}
+
+// Page is a page of elements along with the opaque cursors of the adjacent pages
+type Page[T any] struct {
+	Next  string `json:"next,omitempty"` // Cursor of the following page, if any
+	Prev  string `json:"prev,omitempty"` // Cursor of the preceding page, if any
+	Items []T    `json:"items"`
+}
+
+// NewPage builds the Page for the request from elements fetched from a sorted collection, such as
+// a database table queried by the sort keys of the request cursor. Elements must be provided in
+// the direction of navigation: the elements following the cursor in ascending order for the first
+// page and After cursors, or the elements preceding the cursor in descending order for Before
+// cursors. Up to one more element than the limit of the request should be provided so that the
+// presence of a further page is known; any additional elements are discarded. The keys function
+// returns the sort keys of an element, which are encoded into the cursors of the adjacent pages.
+// The items of the page are always in ascending order.
+func NewPage[T any](p Paginator, req Request, elements []T, keys func(T) []string) Page[T] {
+	limit := p.limit(req.Limit)
+	more := len(elements) > limit
+	if more {
+		elements = elements[:limit]
+	}
+	backward := req.Cursor != nil && req.Cursor.Direction == Before
+	items := slices.Clone(elements)
+	if items == nil {
+		items = []T{}
+	}
+	if backward {
+		slices.Reverse(items)
+	}
+	page := Page[T]{Items: items}
+	if len(items) == 0 {
+		// A request past either end of the collection may still navigate back from its cursor
+		switch {
+		case backward:
+			page.Next = p.EncodeCursor(Cursor{Direction: After, Keys: req.Cursor.Keys})
+		case req.Cursor != nil:
+			page.Prev = p.EncodeCursor(Cursor{Direction: Before, Keys: req.Cursor.Keys})
+		}
+		return page
+	}
+	if more || backward {
+		page.Next = p.EncodeCursor(Cursor{Direction: After, Keys: keys(items[len(items)-1])})
+	}
+	if (more && backward) || (req.Cursor != nil && !backward) {
+		page.Prev = p.EncodeCursor(Cursor{Direction: Before, Keys: keys(items[0])})
+	}
+	return page
+}
+
+// Paginate returns the requested page of an in-memory collection sorted in ascending order. The
+// compare function returns a negative number, zero or a positive number if an element sorts
+// before, at or after the position identified by the given sort keys, which are returned for an
+// element by the keys function. The position of the cursor is found by binary search, so
+// pagination continues correctly even if the element at the cursor has since been removed.
+func Paginate[T any](p Paginator, req Request, elements []T, keys func(T) []string, compare func(T, []string) int) Page[T] {
+	limit := p.limit(req.Limit)
+	var fetched []T
+	switch {
+	case req.Cursor == nil:
+		fetched = elements[:min(limit+1, len(elements))]
+	case req.Cursor.Direction == Before:
+		end := sort.Search(len(elements), func(i int) bool { return compare(elements[i], req.Cursor.Keys) >= 0 })
+		fetched = slices.Clone(elements[max(0, end-limit-1):end])
+		slices.Reverse(fetched)
+	default:
+		start := sort.Search(len(elements), func(i int) bool { return compare(elements[i], req.Cursor.Keys) > 0 })
+		fetched = elements[start:min(start+limit+1, len(elements))]
+	}
+	return NewPage(p, Request{Cursor: req.Cursor, Limit: limit}, fetched, keys)
+}
+
+// limit bounds the requested page size by the maximum, using the default if none was requested
+func (p Paginator) limit(requested int) int {
+	if requested <= 0 {
+		return p.defaultLimit
+	}
+	return min(requested, p.maxLimit)
+}
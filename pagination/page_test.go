@@ -0,0 +1,149 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"cmp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type spot struct {
+	id int
+}
+
+func spotKeys(s spot) []string {
+	return []string{strconv.Itoa(s.id)}
+}
+
+func compareSpot(s spot, keys []string) int {
+	id, _ := strconv.Atoi(keys[0])
+	return cmp.Compare(s.id, id)
+}
+
+func spots(ids ...int) []spot {
+	result := make([]spot, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, spot{id: id})
+	}
+	return result
+}
+
+func TestPaginate(t *testing.T) {
+	p := Config{SigningKey: []byte("secret"), DefaultLimit: 2}.NewPaginator()
+	elements := spots(1, 2, 3, 4, 5)
+	after := func(id int) *Cursor { return &Cursor{Direction: After, Keys: []string{strconv.Itoa(id)}} }
+	before := func(id int) *Cursor { return &Cursor{Direction: Before, Keys: []string{strconv.Itoa(id)}} }
+	tests := []struct {
+		request      Request
+		expectedNext *Cursor
+		expectedPrev *Cursor
+		name         string
+		collection   []spot
+		expected     []spot
+	}{
+		{
+			name:         "the first page has no previous page",
+			request:      Request{},
+			expected:     spots(1, 2),
+			expectedNext: after(2),
+		},
+		{
+			name:         "pages after a cursor link in both directions",
+			request:      Request{Cursor: after(2), Limit: 2},
+			expected:     spots(3, 4),
+			expectedNext: after(4),
+			expectedPrev: before(3),
+		},
+		{
+			name:         "the last page has no next page",
+			request:      Request{Cursor: after(4), Limit: 2},
+			expected:     spots(5),
+			expectedPrev: before(5),
+		},
+		{
+			name:         "pages before a cursor are in ascending order",
+			request:      Request{Cursor: before(5), Limit: 2},
+			expected:     spots(3, 4),
+			expectedNext: after(4),
+			expectedPrev: before(3),
+		},
+		{
+			name:         "navigating back to the start has no previous page",
+			request:      Request{Cursor: before(3), Limit: 2},
+			expected:     spots(1, 2),
+			expectedNext: after(2),
+		},
+		{
+			name:         "cursors at removed elements continue from their position",
+			request:      Request{Cursor: after(3), Limit: 1},
+			collection:   spots(1, 2, 4, 5),
+			expected:     spots(4),
+			expectedNext: after(4),
+			expectedPrev: before(4),
+		},
+		{
+			name:         "empty pages past the end link back to the cursor",
+			request:      Request{Cursor: after(5), Limit: 2},
+			expected:     []spot{},
+			expectedPrev: before(5),
+		},
+		{
+			name:         "empty pages before the start link forward to the cursor",
+			request:      Request{Cursor: before(1), Limit: 2},
+			expected:     []spot{},
+			expectedNext: after(1),
+		},
+		{
+			name:     "limits above the maximum are reduced",
+			request:  Request{Limit: 1000},
+			expected: spots(1, 2, 3, 4, 5),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			collection := elements
+			if test.collection != nil {
+				collection = test.collection
+			}
+			page := Paginate(p, test.request, collection, spotKeys, compareSpot)
+			assert.Equal(t, test.expected, page.Items)
+			for _, link := range []struct {
+				expected *Cursor
+				token    string
+			}{{test.expectedNext, page.Next}, {test.expectedPrev, page.Prev}} {
+				if link.expected == nil {
+					assert.Empty(t, link.token)
+					continue
+				}
+				cursor, err := p.DecodeCursor(link.token)
+				require.NoError(t, err)
+				assert.Equal(t, *link.expected, cursor)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	p := Config{SigningKey: []byte("secret")}.NewPaginator()
+	// elements fetched in descending order before the cursor, with one extra element
+	page := NewPage(p, Request{Cursor: &Cursor{Direction: Before, Keys: []string{"10"}}, Limit: 2}, spots(9, 8, 7), spotKeys)
+	assert.Equal(t, spots(8, 9), page.Items)
+	assert.NotEmpty(t, page.Next)
+	assert.NotEmpty(t, page.Prev)
+}
@@ -17,6 +17,9 @@ type Pageable interface {
 // GetPageAfterID paginates elements. The first element of the returned page
 // directly follows the element in elements having an ID equivalent to after. At
 // most pageSize results are included in the returned page.
+//
+// Deprecated: GetPageAfterID scans every element and returns an empty page if no element has the
+// given ID. Use Paginate, which locates the position of an opaque cursor by its sort keys.
 func GetPageAfterID(
 	elements []Pageable,
 	after string,
@@ -0,0 +1,24 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import "github.com/spf13/pflag"
+
+// RegisterFlags registers rate limiting flags with pflags
+func (c *Config) RegisterFlags(flags *pflag.FlagSet) {
+	flags.Float64Var(&c.Default.Rate, "rate-limit", c.Default.Rate, "Default number of requests permitted per second for each client. 0 disables rate limiting for routes without a specific limit.")
+	flags.IntVar(&c.Default.Burst, "rate-limit-burst", c.Default.Burst, "Default number of requests permitted at once for each client")
+	flags.StringVar(&c.ClientIPHeader, "rate-limit-client-ip-header", c.ClientIPHeader, "Header, set by a trusted proxy, from which the IP address of anonymous clients is read (e.g. \"X-Forwarded-For\")")
+}
@@ -0,0 +1,33 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterFlags(t *testing.T) {
+	c := Config{}
+	flags := pflag.NewFlagSet("pflags", pflag.PanicOnError)
+	c.RegisterFlags(flags)
+	err := flags.Parse([]string{"--rate-limit", "10", "--rate-limit-burst", "20", "--rate-limit-client-ip-header", "X-Real-IP"})
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 10, Burst: 20}, c.Default)
+	assert.Equal(t, "X-Real-IP", c.ClientIPHeader)
+	assert.True(t, c.Enabled())
+}
@@ -0,0 +1,5 @@
+// Package ratelimit provides token bucket rate limiting for HTTP and gRPC servers. Requests are
+// limited per authenticated client, or per IP address for anonymous callers, with limits that may
+// be configured for each HTTP route template and gRPC method. Bucket state is held in a pluggable
+// Store, with an in-memory implementation provided.
+package ratelimit
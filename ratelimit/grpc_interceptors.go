@@ -0,0 +1,82 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/spothero/tools/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// UnaryServerInterceptor limits requests by gRPC method and client. Requests which exceed their
+// limit are rejected with a ResourceExhausted status including a RetryInfo detail. The
+// interceptor must be chained after the JOSE interceptor so that authenticated clients can be
+// identified.
+func (l *Limiter) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := l.grpcAllow(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor limits streams by gRPC method and client. Streams which exceed their
+// limit are rejected with a ResourceExhausted status including a RetryInfo detail. The
+// interceptor must be chained after the JOSE interceptor so that authenticated clients can be
+// identified.
+func (l *Limiter) StreamServerInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.grpcAllow(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// grpcAllow takes a token for the given method and returns a ResourceExhausted status error if the
+// limit has been exceeded
+func (l *Limiter) grpcAllow(ctx context.Context, method string) error {
+	allowed, retryAfter := l.allow(ctx, method, clientName(ctx), l.grpcClientIP(ctx))
+	if allowed {
+		return nil
+	}
+	st := errors.New(errors.ResourceExhausted, "rate_limited", "rate limit exceeded").GRPCStatus()
+	retryDelay := time.Duration(retryAfterSeconds(retryAfter)) * time.Second
+	if withRetryInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)}); err == nil {
+		st = withRetryInfo
+	}
+	return st.Err()
+}
+
+// grpcClientIP returns the IP address of the client from the configured metadata header, if
+// present, or from the peer address of the connection
+func (l *Limiter) grpcClientIP(ctx context.Context) string {
+	if l.clientIPHeader != "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(l.clientIPHeader); len(values) > 0 {
+				if ip := lastHeaderValue(values[len(values)-1]); ip != "" {
+					return ip
+				}
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return hostOnly(p.Addr.String())
+	}
+	return ""
+}
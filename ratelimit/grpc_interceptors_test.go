@@ -0,0 +1,115 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spothero/tools/jose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// mockServerStream is a grpc.ServerStream which only provides a context
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (mss mockServerStream) Context() context.Context {
+	return mss.ctx
+}
+
+func TestServerInterceptors(t *testing.T) {
+	limiter := Config{
+		Registry:       prometheus.NewRegistry(),
+		ClientIPHeader: "X-Forwarded-For",
+		Limits:         map[string]Limit{"/spothero.v1.Spots/GetSpot": {Rate: 0.5, Burst: 1}},
+	}.NewLimiter()
+	peerCtx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+	tests := []struct {
+		ctx          context.Context
+		name         string
+		method       string
+		expectedCode codes.Code
+	}{
+		{
+			name:         "the first request within the limit is allowed",
+			ctx:          peerCtx,
+			method:       "/spothero.v1.Spots/GetSpot",
+			expectedCode: codes.OK,
+		}, {
+			name:         "requests exceeding the limit are rejected",
+			ctx:          peerCtx,
+			method:       "/spothero.v1.Spots/GetSpot",
+			expectedCode: codes.ResourceExhausted,
+		}, {
+			name:         "anonymous clients are identified by the forwarded address",
+			ctx:          metadata.NewIncomingContext(peerCtx, metadata.Pairs("x-forwarded-for", "192.168.0.1")),
+			method:       "/spothero.v1.Spots/GetSpot",
+			expectedCode: codes.OK,
+		}, {
+			name:         "authenticated clients are identified by name",
+			ctx:          jose.Auth0Claim{ClientName: "partner"}.NewContext(peerCtx),
+			method:       "/spothero.v1.Spots/GetSpot",
+			expectedCode: codes.OK,
+		}, {
+			name:         "methods without a limit are not limited",
+			ctx:          peerCtx,
+			method:       "/spothero.v1.Spots/ListSpots",
+			expectedCode: codes.OK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := limiter.UnaryServerInterceptor(
+				test.ctx,
+				"request",
+				&grpc.UnaryServerInfo{FullMethod: test.method},
+				func(context.Context, interface{}) (interface{}, error) { return "response", nil },
+			)
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			if test.expectedCode == codes.ResourceExhausted {
+				var retryInfo *errdetails.RetryInfo
+				for _, detail := range status.Convert(err).Details() {
+					if ri, ok := detail.(*errdetails.RetryInfo); ok {
+						retryInfo = ri
+					}
+				}
+				require.NotNil(t, retryInfo)
+				assert.Equal(t, 2*time.Second, retryInfo.RetryDelay.AsDuration())
+			}
+		})
+	}
+
+	// streams share the limits of unary calls
+	err := limiter.StreamServerInterceptor(
+		nil,
+		mockServerStream{ctx: peerCtx},
+		&grpc.StreamServerInfo{FullMethod: "/spothero.v1.Spots/GetSpot"},
+		func(interface{}, grpc.ServerStream) error { return nil },
+	)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
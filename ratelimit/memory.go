@@ -0,0 +1,91 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the minimum interval between removals of idle buckets from a MemoryStore
+const sweepInterval = time.Minute
+
+// bucket is the state of a single token bucket
+type bucket struct {
+	updated time.Time
+	tokens  float64
+	limit   Limit
+}
+
+// refill adds the tokens accrued since the bucket was last updated
+func (b *bucket) refill(now time.Time, limit Limit) {
+	b.tokens = math.Min(limit.capacity(), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	b.limit = limit
+}
+
+// MemoryStore is a Store which holds token buckets in memory. Limits are therefore applied per
+// instance of a service rather than across all instances. Buckets which have refilled completely
+// are removed periodically so that memory use is proportional to the number of active clients.
+type MemoryStore struct {
+	buckets   map[string]*bucket
+	mutex     *sync.Mutex
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		mutex:     &sync.Mutex{},
+		now:       time.Now,
+		lastSweep: time.Now(),
+	}
+}
+
+// Take removes a token from the bucket identified by key. Buckets start full.
+func (ms *MemoryStore) Take(_ context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	now := ms.now()
+	ms.sweep(now)
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.capacity(), updated: now}
+		ms.buckets[key] = b
+	}
+	b.refill(now, limit)
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second)), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// sweep removes buckets which have refilled completely, at most once per sweepInterval
+func (ms *MemoryStore) sweep(now time.Time) {
+	if now.Sub(ms.lastSweep) < sweepInterval {
+		return
+	}
+	ms.lastSweep = now
+	for key, b := range ms.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= b.limit.capacity() {
+			delete(ms.buckets, key)
+		}
+	}
+}
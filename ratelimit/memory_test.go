@@ -0,0 +1,72 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Unix(0, 0)
+	ms := NewMemoryStore()
+	ms.now = func() time.Time { return now }
+	ms.lastSweep = now
+	limit := Limit{Rate: 2, Burst: 3}
+	ctx := context.Background()
+
+	// buckets start full
+	for i := 0; i < 3; i++ {
+		allowed, _, err := ms.Take(ctx, "client", limit)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, retryAfter, err := ms.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// other keys have their own bucket
+	allowed, _, err = ms.Take(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// tokens are refilled at the limit rate
+	now = now.Add(500 * time.Millisecond)
+	allowed, _, err = ms.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, _, err = ms.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	// buckets which have refilled are removed when idle
+	now = now.Add(sweepInterval)
+	_, _, err = ms.Take(ctx, "new", limit)
+	require.NoError(t, err)
+	assert.Len(t, ms.buckets, 1)
+	assert.Contains(t, ms.buckets, "new")
+}
+
+func TestLimitCapacity(t *testing.T) {
+	assert.Equal(t, 1.0, Limit{Rate: 1}.capacity())
+	assert.Equal(t, 5.0, Limit{Rate: 1, Burst: 5}.capacity())
+	assert.True(t, Limit{}.Unlimited())
+	assert.False(t, Limit{Rate: 0.5}.Unlimited())
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spothero/tools/errors"
+	"github.com/spothero/tools/http/writer"
+	"github.com/spothero/tools/jose"
+)
+
+// HTTPServerMiddleware limits requests by route template and client. Requests which exceed their
+// limit are rejected with a 429 status, a Retry-After header and a problem details body. The
+// middleware must be attached to a mux.Router after the JOSE middleware so that authenticated
+// clients can be identified.
+func (l *Limiter) HTTPServerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, retryAfter := l.allow(r.Context(), writer.FetchRoutePathTemplate(r), clientName(r.Context()), l.httpClientIP(r))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+			errors.WriteHTTP(w, r, errors.New(errors.ResourceExhausted, "rate_limited", "rate limit exceeded"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpClientIP returns the IP address of the client from the configured header, if present, or
+// from the remote address of the request
+func (l *Limiter) httpClientIP(r *http.Request) string {
+	if l.clientIPHeader != "" {
+		if ip := lastHeaderValue(r.Header.Get(l.clientIPHeader)); ip != "" {
+			return ip
+		}
+	}
+	return hostOnly(r.RemoteAddr)
+}
+
+// clientName returns the name of the authenticated client on the context, if any
+func clientName(ctx context.Context) string {
+	claim, err := jose.FromContext(ctx)
+	if err != nil {
+		return ""
+	}
+	return claim.ClientName
+}
+
+// lastHeaderValue returns the last entry of a comma separated header value, such as
+// X-Forwarded-For, which is the entry added by the nearest proxy
+func lastHeaderValue(value string) string {
+	values := strings.Split(value, ",")
+	return strings.TrimSpace(values[len(values)-1])
+}
+
+// hostOnly strips the port, if any, from an address
+func hostOnly(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// retryAfterSeconds rounds the given duration up to a whole number of seconds, with a minimum
+// of one second
+func retryAfterSeconds(retryAfter time.Duration) int {
+	return int(math.Max(1, math.Ceil(retryAfter.Seconds())))
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spothero/tools/errors"
+	"github.com/spothero/tools/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPServerMiddleware(t *testing.T) {
+	limiter := Config{
+		Registry:       prometheus.NewRegistry(),
+		ClientIPHeader: "X-Forwarded-For",
+		Limits:         map[string]Limit{"/v1/spots/{id}": {Rate: 0.5, Burst: 1}},
+	}.NewLimiter()
+	router := mux.NewRouter()
+	router.Use(limiter.HTTPServerMiddleware)
+	router.HandleFunc("/v1/spots/{id}", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	router.HandleFunc("/v1/reservations", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	tests := []struct {
+		name               string
+		path               string
+		remoteAddr         string
+		forwardedFor       string
+		clientName         string
+		expectedStatusCode int
+	}{
+		{
+			name:               "the first request within the limit is allowed",
+			path:               "/v1/spots/1",
+			remoteAddr:         "10.0.0.1:1234",
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name:               "requests to the same route template exceeding the limit are rejected",
+			path:               "/v1/spots/2",
+			remoteAddr:         "10.0.0.1:5678",
+			expectedStatusCode: http.StatusTooManyRequests,
+		}, {
+			name:               "anonymous clients are identified by the forwarded address",
+			path:               "/v1/spots/1",
+			remoteAddr:         "10.0.0.1:1234",
+			forwardedFor:       "192.168.0.1, 172.16.0.1",
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name:               "authenticated clients are identified by name",
+			path:               "/v1/spots/1",
+			remoteAddr:         "10.0.0.1:1234",
+			clientName:         "partner",
+			expectedStatusCode: http.StatusOK,
+		}, {
+			name:               "authenticated clients exceeding the limit are rejected",
+			path:               "/v1/spots/1",
+			remoteAddr:         "10.0.0.2:1234",
+			clientName:         "partner",
+			expectedStatusCode: http.StatusTooManyRequests,
+		}, {
+			name:               "routes without a limit are not limited",
+			path:               "/v1/reservations",
+			remoteAddr:         "10.0.0.1:1234",
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			if test.clientName != "" {
+				req = req.WithContext(jose.Auth0Claim{ClientName: test.clientName}.NewContext(req.Context()))
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, test.expectedStatusCode, recorder.Code)
+			if test.expectedStatusCode == http.StatusTooManyRequests {
+				assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+				assert.Equal(t, errors.ProblemContentType, recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
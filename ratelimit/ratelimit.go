@@ -0,0 +1,155 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+)
+
+// Limit defines the rate at which a token bucket is refilled and its capacity
+type Limit struct {
+	Rate  float64 // Number of requests permitted per second. Zero or less permits unlimited requests.
+	Burst int     // Maximum number of requests permitted at once. Values less than 1 are treated as 1.
+}
+
+// Unlimited returns true if the Limit permits unlimited requests
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// capacity returns the capacity of a token bucket for the Limit
+func (l Limit) capacity() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+	return float64(l.Burst)
+}
+
+// Store holds the state of token buckets. Implementations must be safe for concurrent use.
+type Store interface {
+	// Take removes a token from the bucket identified by key, which is refilled according to the
+	// given limit. If the bucket is empty, false is returned along with the time until a token
+	// becomes available.
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
+
+// Config defines the configuration of a Limiter
+type Config struct {
+	Store          Store                 // Storage for token buckets. If nil, a MemoryStore is used.
+	Registry       prometheus.Registerer // The Prometheus Registry to use. If nil, the global registry is used.
+	Limits         map[string]Limit      // Limits by HTTP route template (e.g. "/v1/spots/{id}") or gRPC full method name
+	ClientIPHeader string                // If set, the IP address of anonymous clients is read from this header, as set by a trusted proxy
+	Default        Limit                 // Limit applied to routes and methods without a specific limit
+}
+
+// Enabled returns true if the Config limits any route or method
+func (c Config) Enabled() bool {
+	if !c.Default.Unlimited() {
+		return true
+	}
+	for _, limit := range c.Limits {
+		if !limit.Unlimited() {
+			return true
+		}
+	}
+	return false
+}
+
+// Limiter limits requests per client using token buckets
+type Limiter struct {
+	store          Store
+	requests       *prometheus.CounterVec
+	limits         map[string]Limit
+	clientIPHeader string
+	defaultLimit   Limit
+}
+
+// NewLimiter creates a Limiter from the Config. Every request is counted in the
+// `rate_limit_requests_total` metric by route, authenticated client and result. If the metric has
+// already been registered, the existing metric is reused.
+func (c Config) NewLimiter() *Limiter {
+	// If the user has not provided a Prometheus Registry, use the global Registry
+	registry := c.Registry
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+	requests := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_requests_total",
+			Help: "Total number of requests evaluated by the rate limiter, by route, client and result",
+		},
+		[]string{"route", "authenticated_client", "result"},
+	)
+	if err := registry.Register(requests); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		// metric has been registered before so use existing metric
+		requests = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+	store := c.Store
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	limits := make(map[string]Limit, len(c.Limits))
+	for route, limit := range c.Limits {
+		limits[route] = limit
+	}
+	return &Limiter{
+		store:          store,
+		requests:       requests,
+		limits:         limits,
+		clientIPHeader: c.ClientIPHeader,
+		defaultLimit:   c.Default,
+	}
+}
+
+// allow takes a token for the given route and client. Authenticated clients are identified by
+// name, while anonymous clients are identified by IP address and counted as `unauthenticated`. If
+// the store fails, the request is allowed so that the limiter never causes an outage.
+func (l *Limiter) allow(ctx context.Context, route, clientName, clientIP string) (bool, time.Duration) {
+	limit, ok := l.limits[route]
+	if !ok {
+		limit = l.defaultLimit
+	}
+	if limit.Unlimited() {
+		return true, 0
+	}
+	key := route + "|client:" + clientName
+	if clientName == "" {
+		clientName = unauthenticated
+		key = route + "|ip:" + clientIP
+	}
+	allowed, retryAfter, err := l.store.Take(ctx, key, limit)
+	if err != nil {
+		log.Get(ctx).Error("rate limit store failed, allowing request", zap.Error(err))
+		allowed = true
+	}
+	result := "allowed"
+	if !allowed {
+		result = "limited"
+	}
+	l.requests.With(prometheus.Labels{"route": route, "authenticated_client": clientName, "result": result}).Inc()
+	return allowed, retryAfter
+}
+
+// unauthenticated is the client name recorded for anonymous clients
+const unauthenticated = "unauthenticated"
@@ -0,0 +1,90 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore is a Store which always fails
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (bool, time.Duration, error) {
+	return false, 0, fmt.Errorf("connection refused")
+}
+
+func TestConfigEnabled(t *testing.T) {
+	assert.False(t, Config{}.Enabled())
+	assert.False(t, Config{Limits: map[string]Limit{"/v1/spots": {}}}.Enabled())
+	assert.True(t, Config{Limits: map[string]Limit{"/v1/spots": {Rate: 1}}}.Enabled())
+	assert.True(t, Config{Default: Limit{Rate: 1}}.Enabled())
+}
+
+func TestNewLimiter(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	limiter := Config{Registry: registry}.NewLimiter()
+	assert.IsType(t, &MemoryStore{}, limiter.store)
+	// creating a second limiter with the same prometheus registry reuses the counter
+	assert.NotPanics(t, func() { assert.Equal(t, limiter.requests, Config{Registry: registry}.NewLimiter().requests) })
+}
+
+func TestAllow(t *testing.T) {
+	limiter := Config{
+		Registry: prometheus.NewRegistry(),
+		Default:  Limit{Rate: 0.001, Burst: 1},
+		Limits: map[string]Limit{
+			"/v1/spots":  {Rate: 0.001, Burst: 2},
+			"/v1/health": {},
+		},
+	}.NewLimiter()
+	ctx := context.Background()
+	allowed := func(route, client, ip string) bool {
+		ok, _ := limiter.allow(ctx, route, client, ip)
+		return ok
+	}
+
+	// route specific limits take precedence over the default
+	assert.True(t, allowed("/v1/spots", "partner", "10.0.0.1"))
+	assert.True(t, allowed("/v1/spots", "partner", "10.0.0.2"))
+	assert.False(t, allowed("/v1/spots", "partner", "10.0.0.3"))
+	assert.True(t, allowed("/v1/reservations", "partner", "10.0.0.1"))
+	assert.False(t, allowed("/v1/reservations", "partner", "10.0.0.1"))
+
+	// anonymous clients are limited by IP address
+	assert.True(t, allowed("/v1/reservations", "", "10.0.0.1"))
+	assert.False(t, allowed("/v1/reservations", "", "10.0.0.1"))
+	assert.True(t, allowed("/v1/reservations", "", "10.0.0.2"))
+
+	// unlimited routes are not counted
+	for i := 0; i < 5; i++ {
+		assert.True(t, allowed("/v1/health", "partner", "10.0.0.1"))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(limiter.requests.WithLabelValues("/v1/spots", "partner", "allowed")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(limiter.requests.WithLabelValues("/v1/spots", "partner", "limited")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(limiter.requests.WithLabelValues("/v1/reservations", "unauthenticated", "allowed")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(limiter.requests.WithLabelValues("/v1/health", "partner", "allowed")))
+
+	// requests are allowed if the store fails
+	limiter.store = failingStore{}
+	assert.True(t, allowed("/v1/spots", "partner", "10.0.0.1"))
+}
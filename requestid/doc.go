@@ -0,0 +1,6 @@
+// Package requestid generates and propagates request IDs. An ID is read from the X-Request-ID
+// header (or x-request-id gRPC metadata) of an inbound request, or generated when absent, and is
+// placed in the request context, the context logger and the response headers. The provided HTTP
+// RoundTripper and gRPC client interceptors forward the ID on outbound calls so that a single
+// request may be followed across services even when tracing is disabled or sampled out.
+package requestid
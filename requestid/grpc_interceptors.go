@@ -0,0 +1,82 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestid
+
+import (
+	"context"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// fromIncomingContext returns the request ID from the incoming gRPC metadata, generating one if
+// it is absent or invalid
+func fromIncomingContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(metadataKey); len(values) > 0 {
+			return fromCaller(values[0])
+		}
+	}
+	return New()
+}
+
+// UnaryServerInterceptor returns a new unary server interceptor that reads the request ID from
+// the x-request-id metadata, generating one if it is absent or invalid. The ID is placed on the
+// context and context logger and returned to the caller in the response header metadata. Note
+// that this interceptor should appear *before* the logging interceptor to ensure that the
+// request_id is properly logged.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := fromIncomingContext(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(metadataKey, id))
+	return handler(NewContext(ctx, id), req)
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor that reads the request ID
+// from the x-request-id metadata, generating one if it is absent or invalid. The ID is placed on
+// the context and context logger and returned to the caller in the response header metadata.
+// Note that this interceptor should appear *before* the logging interceptor to ensure that the
+// request_id is properly logged.
+func StreamServerInterceptor(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	id := fromIncomingContext(stream.Context())
+	_ = stream.SetHeader(metadata.Pairs(metadataKey, id))
+	wrapped := grpc_middleware.WrapServerStream(stream)
+	wrapped.WrappedContext = NewContext(stream.Context(), id)
+	return handler(srv, wrapped)
+}
+
+// setOutgoingMD forwards the request ID found on the context in the outgoing gRPC metadata
+func setOutgoingMD(ctx context.Context) context.Context {
+	id := FromContext(ctx)
+	if id == "" {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(metadataKey)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, metadataKey, id)
+}
+
+// UnaryClientInterceptor returns a new unary client interceptor that forwards the request ID
+// found on the context in the x-request-id metadata of outbound calls
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(setOutgoingMD(ctx), method, req, reply, cc, opts...)
+}
+
+// StreamClientInterceptor returns a new streaming client interceptor that forwards the request
+// ID found on the context in the x-request-id metadata of outbound calls
+func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(setOutgoingMD(ctx), desc, cc, method, opts...)
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestid
+
+import (
+	"context"
+	"testing"
+
+	grpcmock "github.com/spothero/tools/grpc/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name            string
+		md              metadata.MD
+		expectGenerated bool
+	}{
+		{
+			name:            "a request id is generated when no metadata is present",
+			expectGenerated: true,
+		}, {
+			name: "a valid request id is accepted from the caller",
+			md:   metadata.Pairs(metadataKey, "edge-request-1"),
+		}, {
+			name:            "an invalid request id is replaced",
+			md:              metadata.Pairs(metadataKey, "not a valid id"),
+			expectGenerated: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, test.md)
+			}
+			var ctxID string
+			mockHandler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+				ctxID = FromContext(ctx)
+				return struct{}{}, nil
+			}
+			resp, err := UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, mockHandler)
+			require.NoError(t, err)
+			assert.Equal(t, struct{}{}, resp)
+			assert.True(t, valid(ctxID))
+			if test.expectGenerated {
+				assert.NotEqual(t, test.md.Get(metadataKey), []string{ctxID})
+			} else {
+				assert.Equal(t, test.md.Get(metadataKey), []string{ctxID})
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(metadataKey, "edge-request-1"))
+	mockStream := &grpcmock.ServerStream{}
+	mockStream.On("Context").Return(ctx)
+	mockStream.On("SetHeader", metadata.Pairs(metadataKey, "edge-request-1")).Return(nil)
+	mockHandler := func(_ interface{}, stream grpc.ServerStream) error {
+		assert.Equal(t, "edge-request-1", FromContext(stream.Context()))
+		return nil
+	}
+	assert.NoError(t, StreamServerInterceptor(nil, mockStream, &grpc.StreamServerInfo{}, mockHandler))
+	mockStream.AssertCalled(t, "SetHeader", mock.Anything)
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	tests := []struct {
+		ctx        context.Context
+		name       string
+		expectedMD []string
+	}{
+		{
+			name: "no request id is forwarded when none is on the context",
+			ctx:  context.Background(),
+		}, {
+			name:       "the request id on the context is forwarded",
+			ctx:        NewContext(context.Background(), "abc123"),
+			expectedMD: []string{"abc123"},
+		}, {
+			name: "an existing request id in the outgoing metadata is not overwritten",
+			ctx: metadata.AppendToOutgoingContext(
+				NewContext(context.Background(), "abc123"), metadataKey, "def456",
+			),
+			expectedMD: []string{"def456"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockInvoker := func(ctx context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+				md, _ := metadata.FromOutgoingContext(ctx)
+				assert.Equal(t, test.expectedMD, md.Get(metadataKey))
+				return nil
+			}
+			assert.NoError(t, UnaryClientInterceptor(test.ctx, "method", struct{}{}, struct{}{}, &grpc.ClientConn{}, mockInvoker))
+		})
+	}
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	mockStreamer := func(ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"abc123"}, md.Get(metadataKey))
+		return nil, nil
+	}
+	stream, err := StreamClientInterceptor(
+		NewContext(context.Background(), "abc123"),
+		&grpc.StreamDesc{},
+		&grpc.ClientConn{},
+		"method",
+		mockStreamer,
+	)
+	assert.NoError(t, err)
+	assert.Nil(t, stream)
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestid
+
+import (
+	"net/http"
+)
+
+// HTTPServerMiddleware reads the request ID from the X-Request-ID header of every inbound HTTP
+// request, generating one if it is absent or invalid. The ID is placed on the request context
+// and context logger and echoed in the X-Request-ID response header. Note that this middleware
+// must be attached before log.HTTPServerMiddleware and sentry for the ID to show up in logs and
+// Sentry events.
+func HTTPServerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := fromCaller(r.Header.Get(Header))
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// RoundTripper provides a proxied HTTP RoundTripper which forwards the request ID found on the
+// request context in the X-Request-ID header of outbound requests
+type RoundTripper struct {
+	RoundTripper http.RoundTripper
+}
+
+// RoundTrip completes HTTP roundtrips while forwarding the request ID. A X-Request-ID header
+// already set on the request is left untouched.
+func (rt RoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Ensure the inner RoundTripper was set on the RoundTripper
+	if rt.RoundTripper == nil {
+		panic("no roundtripper provided to request id round tripper")
+	}
+
+	if id := FromContext(r.Context()); id != "" && r.Header.Get(Header) == "" {
+		// RoundTrippers must not modify the provided request
+		r = r.Clone(r.Context())
+		r.Header.Set(Header, id)
+	}
+	return rt.RoundTripper.RoundTrip(r)
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spothero/tools/http/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPServerMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		header          string
+		expectGenerated bool
+	}{
+		{
+			name:            "a request id is generated when none is provided",
+			expectGenerated: true,
+		}, {
+			name:   "a valid request id is accepted from the caller",
+			header: "edge-request-1",
+		}, {
+			name:            "an invalid request id is replaced",
+			header:          "not a valid id",
+			expectGenerated: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ctxID string
+			handler := HTTPServerMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				ctxID = FromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				req.Header.Set(Header, test.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			responseID := rec.Header().Get(Header)
+			assert.Equal(t, ctxID, responseID)
+			if test.expectGenerated {
+				assert.NotEqual(t, test.header, responseID)
+				assert.True(t, valid(responseID))
+			} else {
+				assert.Equal(t, test.header, responseID)
+			}
+		})
+	}
+}
+
+// headerRoundTripper records the request ID header of the last request it received
+type headerRoundTripper struct {
+	http.RoundTripper
+	header string
+}
+
+func (rt *headerRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.header = r.Header.Get(Header)
+	return rt.RoundTripper.RoundTrip(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name           string
+		ctxID          string
+		header         string
+		expectedHeader string
+	}{
+		{
+			name: "no request id is forwarded when none is on the context",
+		}, {
+			name:           "the request id on the context is forwarded",
+			ctxID:          "abc123",
+			expectedHeader: "abc123",
+		}, {
+			name:           "an existing request id header is not overwritten",
+			ctxID:          "abc123",
+			header:         "def456",
+			expectedHeader: "def456",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inner := &headerRoundTripper{
+				RoundTripper: &mock.RoundTripper{ResponseStatusCodes: []int{http.StatusOK}},
+			}
+			rt := RoundTripper{RoundTripper: inner}
+			ctx := context.Background()
+			if test.ctxID != "" {
+				ctx = NewContext(ctx, test.ctxID)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/path", nil).WithContext(ctx)
+			if test.header != "" {
+				req.Header.Set(Header, test.header)
+			}
+			resp, err := rt.RoundTrip(req)
+			require.NoError(t, err)
+			assert.NotNil(t, resp)
+			assert.Equal(t, test.expectedHeader, inner.header)
+			// the original request must not be modified
+			assert.Equal(t, test.header, req.Header.Get(Header))
+		})
+	}
+}
+
+func TestRoundTripNoRoundTripper(t *testing.T) {
+	assert.Panics(t, func() {
+		_, _ = RoundTripper{}.RoundTrip(httptest.NewRequest(http.MethodGet, "/path", nil))
+	})
+}
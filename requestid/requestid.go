@@ -0,0 +1,90 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+)
+
+// Header is the HTTP header used to read and forward request IDs
+const Header = "X-Request-ID"
+
+// metadataKey is the gRPC metadata key used to read and forward request IDs
+const metadataKey = "x-request-id"
+
+// maxLength is the maximum length of a request ID accepted from a caller
+const maxLength = 128
+
+// ctxKey is the type used to store the request ID on the context
+type ctxKey int
+
+// requestIDKey is the context key under which the request ID is stored
+const requestIDKey ctxKey = iota
+
+// NewContext returns a copy of the given context which carries the request ID. The request ID
+// is also added as the `request_id` field on the context logger.
+func NewContext(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey, id)
+	return log.NewContext(ctx, log.Get(ctx).With(zap.String("request_id", id)))
+}
+
+// FromContext returns the request ID carried by the given context, or an empty string if
+// there is none
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// New generates a new random request ID in the form of a version 4 UUID
+func New() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate request id: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// valid determines whether a request ID received from a caller may be used. IDs must be
+// non-empty, no longer than 128 characters and consist only of printable ASCII characters, so
+// that they are safe to place in logs and headers.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// fromCaller returns the request ID provided by the caller if it is valid, or a newly generated
+// request ID otherwise
+func fromCaller(id string) string {
+	if valid(id) {
+		return id
+	}
+	return New()
+}
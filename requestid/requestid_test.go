@@ -0,0 +1,75 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestid
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/spothero/tools/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNewContext(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	ctx := log.NewContext(context.Background(), zap.New(core))
+	assert.Equal(t, "", FromContext(ctx))
+
+	ctx = NewContext(ctx, "abc123")
+	assert.Equal(t, "abc123", FromContext(ctx))
+	log.Get(ctx).Info("test")
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "abc123", logs.All()[0].ContextMap()["request_id"])
+}
+
+func TestNew(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, second := New(), New()
+	assert.Regexp(t, uuid, first)
+	assert.Regexp(t, uuid, second)
+	assert.NotEqual(t, first, second)
+}
+
+func TestFromCaller(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		expectValid bool
+	}{
+		{"empty ids are replaced", "", false},
+		{"printable ids are accepted", "edge-1234/abc", true},
+		{"ids at the maximum length are accepted", strings.Repeat("a", maxLength), true},
+		{"ids over the maximum length are replaced", strings.Repeat("a", maxLength+1), false},
+		{"ids containing spaces are replaced", "abc 123", false},
+		{"ids containing control characters are replaced", "abc\n123", false},
+		{"ids containing non-ascii characters are replaced", "abcé", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := fromCaller(test.id)
+			if test.expectValid {
+				assert.Equal(t, test.id, id)
+			} else {
+				assert.NotEqual(t, test.id, id)
+				assert.True(t, valid(id))
+			}
+		})
+	}
+}
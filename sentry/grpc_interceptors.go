@@ -21,6 +21,7 @@ import (
 
 	"github.com/getsentry/sentry-go"
 	"github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/spothero/tools/requestid"
 	"google.golang.org/grpc"
 )
 
@@ -48,6 +49,9 @@ func configureHub(ctx context.Context, fullMethodName string) context.Context {
 		sc := span.SpanContext()
 		hub.Scope().SetTag("correlation_id", sc.TraceID().String())
 	}
+	if id := requestid.FromContext(ctx); id != "" {
+		hub.Scope().SetTag("request_id", id)
+	}
 	return sentry.SetHubOnContext(ctx, hub)
 }
 
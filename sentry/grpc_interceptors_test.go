@@ -20,6 +20,7 @@ import (
 
 	"github.com/getsentry/sentry-go"
 	grpcmock "github.com/spothero/tools/grpc/mock"
+	"github.com/spothero/tools/requestid"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
 )
@@ -43,6 +44,12 @@ func TestConfigureHub(t *testing.T) {
 	assert.NotEqual(t, clone.Scope(), hub.Scope())
 }
 
+func TestConfigureHubRequestID(t *testing.T) {
+	ctx := configureHub(requestid.NewContext(context.Background(), "abc123"), "/service/method")
+	event := sentry.GetHubFromContext(ctx).Scope().ApplyToEvent(sentry.NewEvent(), nil)
+	assert.Equal(t, "abc123", event.Tags["request_id"])
+}
+
 func TestUnaryServerInterceptor(t *testing.T) {
 	info := &grpc.UnaryServerInfo{}
 	mockHandler := func(_ context.Context, _ interface{}) (interface{}, error) {
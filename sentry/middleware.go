@@ -7,6 +7,7 @@ import (
 	"github.com/getsentry/sentry-go"
 	sentryhttp "github.com/getsentry/sentry-go/http"
 	"github.com/spothero/tools/log"
+	"github.com/spothero/tools/requestid"
 )
 
 // Middleware contains a Sentry handler
@@ -29,7 +30,8 @@ func NewMiddleware() Middleware {
 // from the request context to the logger. That way, if the logger ever writes an error log, instead of just sending
 // the log message and fields provided to the logger to Sentry, Sentry is able to capture the entire request context
 // i.e. the request path, headers present, etc. If this middleware is attached after the tracing middleware,
-// the corresponding Trace ID will be added to the Sentry scope.
+// the corresponding Trace ID will be added to the Sentry scope. Likewise, if this middleware is
+// attached after the requestid middleware, the request ID will be added to the Sentry scope.
 func (m Middleware) HTTP(next http.Handler) http.Handler {
 	return m.sentryHandler.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
 		hub := sentry.GetHubFromContext(r.Context())
@@ -38,6 +40,9 @@ func (m Middleware) HTTP(next http.Handler) http.Handler {
 				sc := span.SpanContext()
 				scope.SetTag("correlation_id", sc.TraceID().String())
 			}
+			if id := requestid.FromContext(r.Context()); id != "" {
+				scope.SetTag("request_id", id)
+			}
 		})
 		ctx := log.NewContext(r.Context(), log.Get(r.Context()).With(Hub(hub)))
 		next.ServeHTTP(w, r.WithContext(ctx))
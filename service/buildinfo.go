@@ -0,0 +1,101 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"runtime"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BuildInfo describes the build and deployment of the running service
+type BuildInfo struct {
+	Name        string `json:"name"`
+	Environment string `json:"environment"`
+	Version     string `json:"version"`
+	GitSHA      string `json:"git_sha"`
+	GoVersion   string `json:"go_version"`
+}
+
+// BuildInfo returns the build information of the service described by the Config
+func (c Config) BuildInfo() BuildInfo {
+	return BuildInfo{
+		Name:        c.Name,
+		Environment: c.Environment,
+		Version:     c.Version,
+		GitSHA:      c.GitSHA,
+		GoVersion:   runtime.Version(),
+	}
+}
+
+// ServeHTTP writes the build information as JSON
+func (bi BuildInfo) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(bi)
+}
+
+// RegisterHandlers registers the /version endpoint with the given router
+func (bi BuildInfo) RegisterHandlers(router *mux.Router) {
+	router.Handle("/version", bi).Methods(http.MethodGet)
+}
+
+// invalidMetricNameCharacters matches characters which may not appear in Prometheus metric names
+var invalidMetricNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// RegisterMetric registers the `<name>_build_info` gauge with the given Prometheus Registry and
+// sets it to 1 for the build. Characters in the service name which are not valid in metric names
+// are replaced with underscores, and names starting with a digit, which metric names may not, are
+// prefixed with an underscore. If no Registry is provided, the global Registry is used. If the
+// gauge has already been registered, the existing gauge is reused.
+func (bi BuildInfo) RegisterMetric(registry prometheus.Registerer) {
+	// If the user has not provided a Prometheus Registry, use the global Registry
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+	buildInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: metricNamePrefix(bi.Name) + "_build_info",
+			Help: "A metric with a constant '1' value labeled by the version, git SHA, Go version and environment of the build",
+		},
+		[]string{"version", "git_sha", "go_version", "environment"},
+	)
+	if err := registry.Register(buildInfo); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		// metric has been registered before so use existing metric
+		buildInfo = are.ExistingCollector.(*prometheus.GaugeVec)
+	}
+	buildInfo.With(prometheus.Labels{
+		"version":     bi.Version,
+		"git_sha":     bi.GitSHA,
+		"go_version":  bi.GoVersion,
+		"environment": bi.Environment,
+	}).Set(1)
+}
+
+// metricNamePrefix returns the service name as a valid prefix for Prometheus metric names
+func metricNamePrefix(name string) string {
+	name = invalidMetricNameCharacters.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInfo(t *testing.T) {
+	c := Config{Name: "parking-api", Environment: "staging", Version: "1.2.3", GitSHA: "abc123"}
+	bi := c.BuildInfo()
+	assert.Equal(t, BuildInfo{
+		Name:        "parking-api",
+		Environment: "staging",
+		Version:     "1.2.3",
+		GitSHA:      "abc123",
+		GoVersion:   runtime.Version(),
+	}, bi)
+
+	router := mux.NewRouter()
+	bi.RegisterHandlers(router)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"name": "parking-api",
+		"environment": "staging",
+		"version": "1.2.3",
+		"git_sha": "abc123",
+		"go_version": "`+runtime.Version()+`"
+	}`, recorder.Body.String())
+}
+
+func TestBuildInfoRegisterMetric(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	bi := BuildInfo{Name: "parking-api", Environment: "staging", Version: "1.2.3", GitSHA: "abc123", GoVersion: "go1.22.4"}
+	bi.RegisterMetric(registry)
+	// registering the metric again reuses the existing gauge
+	require.NotPanics(t, func() { bi.RegisterMetric(registry) })
+	expected := `
+# HELP parking_api_build_info A metric with a constant '1' value labeled by the version, git SHA, Go version and environment of the build
+# TYPE parking_api_build_info gauge
+parking_api_build_info{environment="staging",git_sha="abc123",go_version="go1.22.4",version="1.2.3"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "parking_api_build_info"))
+}
+
+func TestMetricNamePrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"valid names are unchanged", "parking_api", "parking_api"},
+		{"invalid characters are replaced", "parking-api.v2", "parking_api_v2"},
+		{"leading digits are prefixed", "3scale-proxy", "_3scale_proxy"},
+		{"empty names are unchanged", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, metricNamePrefix(test.input))
+		})
+	}
+	// names starting with a digit register without panicking
+	assert.NotPanics(t, func() { BuildInfo{Name: "3scale-proxy"}.RegisterMetric(prometheus.NewRegistry()) })
+}
@@ -16,16 +16,35 @@ package service
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/pflag"
+	"github.com/spothero/tools/health"
+	shHTTP "github.com/spothero/tools/http"
+	"github.com/spothero/tools/loadshed"
+	"github.com/spothero/tools/ratelimit"
+)
+
+const (
+	// defaultHealthCheckFrequency is the HealthCheckFrequency used if none is set
+	defaultHealthCheckFrequency = 10 * time.Second
+	// defaultComponentStopTimeout is the ComponentStopTimeout used if none is set
+	defaultComponentStopTimeout = 30 * time.Second
 )
 
 // Config defines service level configuration for HTTP servers
 type Config struct {
 	Registry prometheus.Registerer // The Prometheus Registry to use. If nil, the global registry is used by default.
+	// Health and readiness checks for the service. If nil, an empty registry is created by ServerCmd.
+	// Checks registered here are served on /health/live and /health/ready and through the gRPC health service.
+	Health *health.Registry
+	// Reloads configuration at runtime on SIGHUP or when the --config file changes. If nil, a Reloader is
+	// created by ServerCmd or WorkerCmd. Application specific settings may be reloaded by registering hooks.
+	Reloader *Reloader
 	// A function to be called before starting the service. The context passed into the ServerCmd function will be
 	// fed all the way through PreStart and into PostShutdown, enabling communication of state through these functions.
 	PreStart      func(ctx context.Context) (context.Context, error)
@@ -35,12 +54,48 @@ type Config struct {
 	Version       string                          // Semantic Version of the application
 	GitSHA        string                          // GitSHA of the application when compiled
 	CancelSignals []os.Signal                     // OS Signals to be used to cancel running servers. Defaults to SIGINT/`os.Interrupt`.
+	// Frequency with which health checks are evaluated in the background to keep the gRPC health service
+	// and health check metrics current. Health checks are always evaluated when the HTTP endpoints are called.
+	// Defaults to 10 seconds, and a negative frequency disables background evaluation.
+	HealthCheckFrequency time.Duration
+	// Background components, such as Kafka consumers or pollers, started before and stopped after the servers.
+	// Components are most easily added with RegisterComponent.
+	Components           []ComponentRegistration
+	ComponentStopTimeout time.Duration // Maximum amount of time to wait for all components to stop. Defaults to 30 seconds.
+	// If true, gRPC requests are served by the HTTP server on its port instead of on a separate gRPC
+	// listener. HTTP/2 requests with a content-type of `application/grpc` are dispatched to the gRPC server.
+	SinglePort bool
+	// Listeners on which the HTTP and gRPC servers accept connections instead of the addresses and ports given by
+	// flags. These are primarily intended for tests which bind ephemeral ports, such as the servicetest package.
+	HTTPListener net.Listener
+	GRPCListener net.Listener
+	// Per-client rate limits applied to HTTP routes and gRPC methods by ServerCmd. The default limit may be set
+	// with flags, while limits for specific routes and methods must be set in code. Disabled unless a limit is set.
+	RateLimit ratelimit.Config
+	// Adaptive concurrency limit applied to HTTP routes and gRPC methods by ServerCmd, which rejects requests with
+	// a 503 or Unavailable status when the server is overloaded. Disabled unless enabled with flags or in code.
+	Concurrency loadshed.Config
+	// Access log emitting one canonical line for every HTTP request handled by ServerCmd. Disabled unless enabled
+	// with flags or in code.
+	AccessLog shHTTP.AccessLogConfig
+	// Circuit breaker configuration of HTTP clients created with NewHTTPClient, which is set with flags and
+	// re-applied on reload. If nil, a configuration with the defaults is created by ServerCmd or WorkerCmd.
+	CircuitBreaker *shHTTP.CircuitBreakerConfig
 }
 
 // RegisterFlags registers Service flags with pflags
 func (c *Config) RegisterFlags(flags *pflag.FlagSet) {
+	if c.HealthCheckFrequency == 0 {
+		c.HealthCheckFrequency = defaultHealthCheckFrequency
+	}
+	if c.ComponentStopTimeout <= 0 {
+		c.ComponentStopTimeout = defaultComponentStopTimeout
+	}
 	flags.StringVarP(&c.Name, "name", "n", c.Name, "Name of the application")
 	flags.StringVarP(&c.Environment, "environment", "e", c.Environment, "Environment where the application is running")
+	flags.DurationVar(&c.HealthCheckFrequency, "health-check-frequency", c.HealthCheckFrequency, "Frequency with which health checks are evaluated in the background. A negative frequency disables background evaluation.")
+	flags.DurationVar(&c.ComponentStopTimeout, "component-stop-timeout", c.ComponentStopTimeout, "Maximum amount of time to wait for background components to stop")
+	flags.BoolVar(&c.SinglePort, "single-port", c.SinglePort, "Serve gRPC requests on the HTTP port instead of a separate gRPC port")
 }
 
 // CheckFlags ensures that the Service Config contains all necessary configuration for use at
@@ -16,6 +16,7 @@ package service
 
 import (
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
@@ -39,6 +40,31 @@ func TestRegisterFlags(t *testing.T) {
 	e, err := flags.GetString("environment")
 	assert.NoError(t, err)
 	assert.Equal(t, c.Environment, e)
+
+	hcf, err := flags.GetDuration("health-check-frequency")
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, hcf)
+
+	cst, err := flags.GetDuration("component-stop-timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cst)
+
+	sp, err := flags.GetBool("single-port")
+	assert.NoError(t, err)
+	assert.False(t, sp)
+}
+
+func TestRegisterFlagsConfigured(t *testing.T) {
+	flags := pflag.NewFlagSet("pflags", pflag.PanicOnError)
+	c := Config{HealthCheckFrequency: time.Minute, ComponentStopTimeout: 5 * time.Second}
+	c.RegisterFlags(flags)
+	assert.NoError(t, flags.Parse(nil))
+	// values set in code are used as the flag defaults
+	assert.Equal(t, time.Minute, c.HealthCheckFrequency)
+	assert.Equal(t, 5*time.Second, c.ComponentStopTimeout)
+
+	assert.NoError(t, flags.Parse([]string{"--health-check-frequency", "30s"}))
+	assert.Equal(t, 30*time.Second, c.HealthCheckFrequency)
 }
 
 func TestCheckFlags(t *testing.T) {
@@ -0,0 +1,41 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net/http"
+
+	shHTTP "github.com/spothero/tools/http"
+)
+
+// NewHTTPClient constructs the default HTTP client of the http package, whose circuit breakers are
+// configured by the CircuitBreaker flags. If the Config has a Reloader, the circuit breaker
+// configuration is re-applied on every reload without interrupting in-flight requests. Providing
+// the base HTTP RoundTripper is optional. If `nil` is received, http.DefaultTransport is used.
+func (c Config) NewHTTPClient(metrics shHTTP.Metrics, roundTripper http.RoundTripper) http.Client {
+	circuitBreaker := c.CircuitBreaker
+	if circuitBreaker == nil {
+		circuitBreaker = &shHTTP.CircuitBreakerConfig{}
+	}
+	client, circuitBreakers := circuitBreaker.NewClient(metrics, roundTripper)
+	if c.Reloader != nil {
+		c.Reloader.Register("http client circuit breakers", func(context.Context) error {
+			circuitBreakers.SetDefaultConfiguration(*circuitBreaker)
+			return nil
+		})
+	}
+	return client
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	shHTTP "github.com/spothero/tools/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	c := Config{
+		Reloader:       NewReloader(prometheus.NewRegistry()),
+		CircuitBreaker: &shHTTP.CircuitBreakerConfig{Timeout: time.Second},
+	}
+	client := c.NewHTTPClient(shHTTP.Metrics{}, nil)
+	assert.NotNil(t, client.Transport)
+	require.Len(t, c.Reloader.hooks, 1)
+	assert.Equal(t, "http client circuit breakers", c.Reloader.hooks[0].name)
+
+	// the circuit breaker configuration changed by a reload is re-applied
+	c.CircuitBreaker.Timeout = 2 * time.Second
+	assert.NoError(t, c.Reloader.Reload(context.Background()))
+
+	// clients may be created without a Reloader or CircuitBreaker configuration
+	assert.NotNil(t, Config{}.NewHTTPClient(shHTTP.Metrics{}, nil).Transport)
+}
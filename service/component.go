@@ -0,0 +1,187 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+)
+
+// Component is a long-running background process, such as a Kafka consumer, poller or worker
+// pool, whose lifecycle is managed alongside the servers.
+//
+// Start must return once the component is running; any long-running work should be performed
+// in goroutines. The context passed to Start remains valid until the component has been stopped.
+// Failures which occur after Start has returned should be reported with ReportFailure using that
+// context. Stop must release all resources held by the component and should honor the deadline
+// of the given context.
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// ComponentRegistration describes a Component managed by the service
+type ComponentRegistration struct {
+	Component Component // The component to start and stop
+	Name      string    // Unique name of the component, used for dependencies and logging
+	DependsOn []string  // Names of the components which must be started before this component
+}
+
+// RegisterComponent registers a Component with the service. Components are started in
+// dependency order before the servers begin accepting traffic and are stopped in reverse
+// order once the servers have shut down.
+func (c *Config) RegisterComponent(name string, component Component, dependsOn ...string) {
+	c.Components = append(c.Components, ComponentRegistration{
+		Name:      name,
+		Component: component,
+		DependsOn: dependsOn,
+	})
+}
+
+type failureReporterKey int
+
+const failureReporterCtxKey failureReporterKey = iota
+
+// ReportFailure notifies the service that the component which was started with the given context
+// has failed. The first reported failure triggers a coordinated shutdown of the servers and all
+// other components, and causes ServerCmd to return an error. Calling ReportFailure with a context
+// not derived from one passed to Component.Start has no effect.
+func ReportFailure(ctx context.Context, err error) {
+	if report, ok := ctx.Value(failureReporterCtxKey).(func(error)); ok {
+		report(err)
+	}
+}
+
+// componentManager starts and stops components in dependency order
+type componentManager struct {
+	failed     chan struct{}
+	err        error
+	components []ComponentRegistration
+	cancels    []context.CancelFunc
+	failOnce   sync.Once
+}
+
+// newComponentManager orders the given components such that every component is preceded
+// by its dependencies. An error is returned if a component name is duplicated, a dependency
+// is not registered, or the dependencies contain a cycle.
+func newComponentManager(registrations []ComponentRegistration) (*componentManager, error) {
+	byName := make(map[string]ComponentRegistration, len(registrations))
+	for _, registration := range registrations {
+		if registration.Component == nil {
+			return nil, fmt.Errorf("no component provided for `%s`", registration.Name)
+		}
+		if _, ok := byName[registration.Name]; ok {
+			return nil, fmt.Errorf("component `%s` registered more than once", registration.Name)
+		}
+		byName[registration.Name] = registration
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(registrations))
+	ordered := make([]ComponentRegistration, 0, len(registrations))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("component dependency cycle detected: %v", append(path, name))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		registration := byName[name]
+		for _, dependency := range registration.DependsOn {
+			if _, ok := byName[dependency]; !ok {
+				return fmt.Errorf("component `%s` depends on unregistered component `%s`", name, dependency)
+			}
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, registration)
+		return nil
+	}
+	// Visit components in registration order so that independent components retain it
+	for _, registration := range registrations {
+		if err := visit(registration.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &componentManager{components: ordered, failed: make(chan struct{})}, nil
+}
+
+// start starts every component in dependency order. If any component fails to start, the
+// components which were already started are stopped and an error is returned.
+func (m *componentManager) start(ctx context.Context) error {
+	for _, registration := range m.components {
+		name := registration.Name
+		componentCtx, cancel := context.WithCancel(
+			context.WithValue(ctx, failureReporterCtxKey, func(err error) { m.fail(name, err) }))
+		log.Get(ctx).Info("starting component", zap.String("component", name))
+		if err := registration.Component.Start(componentCtx); err != nil {
+			cancel()
+			startErr := fmt.Errorf("failed to start component `%s`: %w", name, err)
+			if stopErr := m.stop(ctx); stopErr != nil {
+				return errors.Join(startErr, stopErr)
+			}
+			return startErr
+		}
+		m.cancels = append(m.cancels, cancel)
+	}
+	return nil
+}
+
+// stop stops every started component in the reverse of the order in which they were started.
+// All components are stopped even if some fail to stop, and all errors are returned.
+func (m *componentManager) stop(ctx context.Context) error {
+	var errs []error
+	for i := len(m.cancels) - 1; i >= 0; i-- {
+		name := m.components[i].Name
+		log.Get(ctx).Info("stopping component", zap.String("component", name))
+		if err := m.components[i].Component.Stop(ctx); err != nil {
+			log.Get(ctx).Error("failed to stop component", zap.String("component", name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("failed to stop component `%s`: %w", name, err))
+		}
+		m.cancels[i]()
+	}
+	m.cancels = nil
+	return errors.Join(errs...)
+}
+
+// fail records the first failure reported by any component and signals the failed channel
+func (m *componentManager) fail(name string, err error) {
+	m.failOnce.Do(func() {
+		m.err = fmt.Errorf("component `%s` failed: %w", name, err)
+		close(m.failed)
+	})
+}
+
+// failure returns the first failure reported by a component, if any
+func (m *componentManager) failure() error {
+	select {
+	case <-m.failed:
+		return m.err
+	default:
+		return nil
+	}
+}
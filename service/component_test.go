@@ -0,0 +1,237 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingComponent records the order in which components are started and stopped
+type recordingComponent struct {
+	events   *[]string
+	startErr error
+	stopErr  error
+	ctx      context.Context
+	name     string
+}
+
+func (rc *recordingComponent) Start(ctx context.Context) error {
+	*rc.events = append(*rc.events, "start "+rc.name)
+	rc.ctx = ctx
+	return rc.startErr
+}
+
+func (rc *recordingComponent) Stop(_ context.Context) error {
+	*rc.events = append(*rc.events, "stop "+rc.name)
+	return rc.stopErr
+}
+
+func TestRegisterComponent(t *testing.T) {
+	c := Config{}
+	component := &recordingComponent{}
+	c.RegisterComponent("consumer", component, "db")
+	assert.Equal(t, []ComponentRegistration{
+		{Name: "consumer", Component: component, DependsOn: []string{"db"}},
+	}, c.Components)
+}
+
+func TestNewComponentManager(t *testing.T) {
+	component := &recordingComponent{}
+	tests := []struct {
+		name          string
+		registrations []ComponentRegistration
+		expectedOrder []string
+		expectErr     bool
+	}{
+		{
+			name:          "no components are valid",
+			registrations: []ComponentRegistration{},
+			expectedOrder: []string{},
+		}, {
+			name: "dependencies are ordered before dependents",
+			registrations: []ComponentRegistration{
+				{Name: "consumer", Component: component, DependsOn: []string{"db", "cache"}},
+				{Name: "poller", Component: component},
+				{Name: "cache", Component: component, DependsOn: []string{"db"}},
+				{Name: "db", Component: component},
+			},
+			expectedOrder: []string{"db", "cache", "consumer", "poller"},
+		}, {
+			name: "duplicate names result in an error",
+			registrations: []ComponentRegistration{
+				{Name: "db", Component: component},
+				{Name: "db", Component: component},
+			},
+			expectErr: true,
+		}, {
+			name: "a missing component results in an error",
+			registrations: []ComponentRegistration{
+				{Name: "db"},
+			},
+			expectErr: true,
+		}, {
+			name: "unregistered dependencies result in an error",
+			registrations: []ComponentRegistration{
+				{Name: "consumer", Component: component, DependsOn: []string{"db"}},
+			},
+			expectErr: true,
+		}, {
+			name: "dependency cycles result in an error",
+			registrations: []ComponentRegistration{
+				{Name: "a", Component: component, DependsOn: []string{"b"}},
+				{Name: "b", Component: component, DependsOn: []string{"c"}},
+				{Name: "c", Component: component, DependsOn: []string{"a"}},
+			},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := newComponentManager(test.registrations)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			order := make([]string, 0, len(m.components))
+			for _, registration := range m.components {
+				order = append(order, registration.Name)
+			}
+			assert.Equal(t, test.expectedOrder, order)
+		})
+	}
+}
+
+func TestComponentManagerStartStop(t *testing.T) {
+	tests := []struct {
+		startErrs      map[string]error
+		stopErrs       map[string]error
+		name           string
+		expectedEvents []string
+		expectStartErr bool
+		expectStopErr  bool
+	}{
+		{
+			name: "components start in order and stop in reverse order",
+			expectedEvents: []string{
+				"start db", "start cache", "start consumer",
+				"stop consumer", "stop cache", "stop db",
+			},
+		}, {
+			name:      "a start failure stops previously started components",
+			startErrs: map[string]error{"cache": fmt.Errorf("cache unavailable")},
+			expectedEvents: []string{
+				"start db", "start cache", "stop db",
+			},
+			expectStartErr: true,
+		}, {
+			name:     "a stop failure still stops all other components",
+			stopErrs: map[string]error{"cache": fmt.Errorf("failed to flush")},
+			expectedEvents: []string{
+				"start db", "start cache", "start consumer",
+				"stop consumer", "stop cache", "stop db",
+			},
+			expectStopErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := make([]string, 0)
+			c := Config{}
+			for _, name := range []string{"db", "cache", "consumer"} {
+				c.RegisterComponent(name, &recordingComponent{
+					name:     name,
+					events:   &events,
+					startErr: test.startErrs[name],
+					stopErr:  test.stopErrs[name],
+				})
+			}
+			m, err := newComponentManager(c.Components)
+			require.NoError(t, err)
+			err = m.start(context.Background())
+			if test.expectStartErr {
+				assert.Error(t, err)
+				assert.Equal(t, test.expectedEvents, events)
+				return
+			}
+			require.NoError(t, err)
+			err = m.stop(context.Background())
+			if test.expectStopErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedEvents, events)
+		})
+	}
+}
+
+func TestReportFailure(t *testing.T) {
+	events := make([]string, 0)
+	db := &recordingComponent{name: "db", events: &events}
+	consumer := &recordingComponent{name: "consumer", events: &events}
+	m, err := newComponentManager([]ComponentRegistration{
+		{Name: "db", Component: db},
+		{Name: "consumer", Component: consumer},
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.start(context.Background()))
+	assert.NoError(t, m.failure())
+
+	// contexts not passed to a component are ignored
+	ReportFailure(context.Background(), fmt.Errorf("ignored"))
+	assert.NoError(t, m.failure())
+
+	ReportFailure(consumer.ctx, fmt.Errorf("lost partition"))
+	ReportFailure(db.ctx, fmt.Errorf("connection lost"))
+	<-m.failed
+	assert.EqualError(t, m.failure(), "component `consumer` failed: lost partition")
+
+	// component contexts are cancelled once the component is stopped
+	assert.NoError(t, consumer.ctx.Err())
+	require.NoError(t, m.stop(context.Background()))
+	assert.Error(t, consumer.ctx.Err())
+	assert.Error(t, db.ctx.Err())
+}
+
+// deadlineComponent records the error of the context it is stopped with
+type deadlineComponent struct {
+	stopCtxErr error
+}
+
+func (dc *deadlineComponent) Start(context.Context) error {
+	return nil
+}
+
+func (dc *deadlineComponent) Stop(ctx context.Context) error {
+	dc.stopCtxErr = ctx.Err()
+	return nil
+}
+
+func TestRunComponentStopTimeout(t *testing.T) {
+	component := &deadlineComponent{}
+	c := Config{}
+	c.RegisterComponent("consumer", component)
+	m, err := newComponentManager(c.Components)
+	require.NoError(t, err)
+	// components are given the default time to stop if no timeout is set
+	require.NoError(t, c.run(context.Background(), m, func(context.Context) error { return nil }))
+	assert.NoError(t, component.stopCtxErr)
+}
@@ -29,8 +29,8 @@ type handler struct {
 }
 
 // RegisterHandlers is a callback used to register HTTP endpoints to the default server
-// NOTE: The HTTP server automatically registers /health, /debug, and /metrics -- Have
-// a look in your browser!
+// NOTE: The HTTP server automatically registers /health, /health/live, /health/ready, /debug,
+// and /metrics -- Have a look in your browser!
 func (h handler) RegisterHandlers(router *mux.Router) {
 	router.HandleFunc("/", h.helloWorld)
 }
@@ -0,0 +1,146 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spothero/tools/log"
+	"github.com/spothero/tools/utils"
+	"go.uber.org/zap"
+)
+
+// reloadHook is a named function which re-applies configuration at runtime
+type reloadHook struct {
+	reload func(ctx context.Context) error
+	name   string
+}
+
+// Reloader re-applies configuration at runtime without restarting the service. Commands created
+// by this package reload when a SIGHUP is received or when the file given by --config changes.
+// On reload, the configuration file is re-read and the log level, CORS and JOSE settings are
+// re-applied before any hooks registered with Register are called. All methods on Reloader are
+// safe for concurrent use.
+type Reloader struct {
+	reloads  *prometheus.CounterVec
+	mutex    *sync.Mutex
+	builtins []reloadHook
+	hooks    []reloadHook
+}
+
+// NewReloader creates and returns a Reloader with no hooks. The user may optionally specify an
+// existing Prometheus Registry. If no Registry is provided, the global Prometheus Registry is used.
+// If the reload counter has already been registered, the existing counter is reused.
+func NewReloader(registry prometheus.Registerer) *Reloader {
+	// If the user has not provided a Prometheus Registry, use the global Registry
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+	reloads := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_reloads_total",
+			Help: "Total number of attempts to reload configuration at runtime, by result",
+		},
+		[]string{"result"},
+	)
+	if err := registry.Register(reloads); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		// metric has been registered before so use existing metric
+		reloads = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+	return &Reloader{reloads: reloads, mutex: &sync.Mutex{}}
+}
+
+// Register adds a named hook which is called on every reload, after the configuration file and
+// built-in settings have been re-applied. Hooks are called in the order in which they were
+// registered. This is the place to re-apply application specific settings, such as per-host HTTP
+// client circuit breaker configuration via CircuitBreakerRoundTripper.SetHostConfiguration. The
+// circuit breaker flags are re-applied to clients created with Config.NewHTTPClient by hooks
+// which it registers.
+func (r *Reloader) Register(name string, reload func(ctx context.Context) error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.hooks = append(r.hooks, reloadHook{name: name, reload: reload})
+}
+
+// registerBuiltin adds a named hook which is called before any hooks added with Register
+func (r *Reloader) registerBuiltin(name string, reload func(ctx context.Context) error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.builtins = append(r.builtins, reloadHook{name: name, reload: reload})
+}
+
+// Reload calls every hook in order. If a hook fails, the remaining hooks are skipped and the
+// error is returned. The outcome is logged and counted in the `config_reloads_total` metric.
+func (r *Reloader) Reload(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	start := time.Now()
+	for _, hook := range append(append([]reloadHook{}, r.builtins...), r.hooks...) {
+		if err := hook.reload(ctx); err != nil {
+			err = fmt.Errorf("failed to reload %s: %w", hook.name, err)
+			log.Get(ctx).Error("configuration reload failed", zap.Error(err))
+			r.reloads.With(prometheus.Labels{"result": "failure"}).Inc()
+			return err
+		}
+	}
+	log.Get(ctx).Info("configuration reloaded", zap.Duration("duration", time.Since(start)))
+	r.reloads.With(prometheus.Labels{"result": "success"}).Inc()
+	return nil
+}
+
+// Watch creates a goroutine which calls Reload whenever one of the given signals is received or,
+// if path is not empty, whenever the file at path changes. The directory containing the file is
+// watched so that files which are replaced rather than modified, such as Kubernetes ConfigMap
+// volumes, are detected. Calling the cancel function associated with the provided context stops
+// watching. An error is returned if the file cannot be watched.
+func (r *Reloader) Watch(ctx context.Context, path string, signals ...os.Signal) error {
+	if path != "" {
+		err := utils.WatchFiles(ctx, []string{path}, func(name string) {
+			log.Get(ctx).Info("configuration file changed, reloading configuration", zap.String("file", name))
+			_ = r.Reload(ctx)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to watch configuration file %s: %w", path, err)
+		}
+	}
+	if len(signals) == 0 {
+		return nil
+	}
+	signalled := make(chan os.Signal, 1)
+	signal.Notify(signalled, signals...)
+	go func() {
+		defer signal.Stop(signalled)
+		for {
+			select {
+			case sig := <-signalled:
+				log.Get(ctx).Info("received signal, reloading configuration", zap.Stringer("signal", sig))
+				_ = r.Reload(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
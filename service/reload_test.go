@@ -0,0 +1,121 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReloader(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	r := NewReloader(registry)
+	assert.NotNil(t, r.reloads)
+	// creating a second reloader with the same prometheus registry reuses the counter
+	assert.NotPanics(t, func() { assert.Equal(t, r.reloads, NewReloader(registry).reloads) })
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		failing         string
+		name            string
+		expectedCalls   []string
+		expectedSuccess float64
+		expectedFailure float64
+	}{
+		{
+			name:            "built-in hooks are called before registered hooks",
+			expectedCalls:   []string{"configuration file", "log level", "circuit breakers", "cache"},
+			expectedSuccess: 1,
+		}, {
+			name:            "a failing hook skips the remaining hooks",
+			failing:         "log level",
+			expectedCalls:   []string{"configuration file", "log level"},
+			expectedFailure: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := make([]string, 0)
+			hook := func(name string) func(context.Context) error {
+				return func(context.Context) error {
+					calls = append(calls, name)
+					if name == test.failing {
+						return fmt.Errorf("invalid value")
+					}
+					return nil
+				}
+			}
+			r := NewReloader(prometheus.NewRegistry())
+			r.Register("circuit breakers", hook("circuit breakers"))
+			r.registerBuiltin("configuration file", hook("configuration file"))
+			r.registerBuiltin("log level", hook("log level"))
+			r.Register("cache", hook("cache"))
+
+			err := r.Reload(context.Background())
+			if test.failing != "" {
+				assert.EqualError(t, err, fmt.Sprintf("failed to reload %s: invalid value", test.failing))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedCalls, calls)
+			assert.Equal(t, test.expectedSuccess, testutil.ToFloat64(r.reloads.WithLabelValues("success")))
+			assert.Equal(t, test.expectedFailure, testutil.ToFloat64(r.reloads.WithLabelValues("failure")))
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("log-level: info\n"), 0600))
+	r := NewReloader(prometheus.NewRegistry())
+	var reloads atomic.Int32
+	r.Register("counter", func(context.Context) error {
+		reloads.Add(1)
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, r.Watch(ctx, path, syscall.SIGUSR2))
+
+	// changes to the configuration file trigger a reload
+	require.NoError(t, os.WriteFile(path, []byte("log-level: debug\n"), 0600))
+	assert.Eventually(t, func() bool { return reloads.Load() >= 1 }, time.Second, 5*time.Millisecond)
+
+	// signals trigger a reload
+	before := reloads.Load()
+	assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR2))
+	assert.Eventually(t, func() bool { return reloads.Load() > before }, time.Second, 5*time.Millisecond)
+
+	// changes to other files in the same directory are ignored
+	time.Sleep(20 * time.Millisecond)
+	before = reloads.Load()
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(path), "other.yaml"), []byte{}, 0600))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, before, reloads.Load())
+
+	assert.Error(t, r.Watch(ctx, filepath.Join(t.TempDir(), "missing", "config.yaml")))
+}
@@ -16,21 +16,27 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"syscall"
 
 	"github.com/gorilla/mux"
 	grpcauth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
 	grpcrecovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpcprom "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spothero/tools/cli"
 	"github.com/spothero/tools/cors"
+	shErrors "github.com/spothero/tools/errors"
 	shGRPC "github.com/spothero/tools/grpc"
+	"github.com/spothero/tools/health"
 	shHTTP "github.com/spothero/tools/http"
 	"github.com/spothero/tools/jose"
 	"github.com/spothero/tools/log"
+	"github.com/spothero/tools/requestid"
 	"github.com/spothero/tools/sentry"
 	"github.com/spothero/tools/tracing"
 	otelgrpc "go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
@@ -59,6 +65,17 @@ type GRPCService interface {
 // own server entrypoints if desired. This function is provided as a convenience
 // function that should satisfy most use cases.
 //
+// Any Components registered on the Config are started in dependency order before the
+// servers and are stopped in reverse order after the servers shut down. If a component
+// fails, the servers and all other components are shut down and the command returns
+// an error.
+//
+// The Name, Environment, Version and GitSHA of the Config are served on /version, exported as the
+// `<name>_build_info` metric, and applied to the tracer resource and Sentry release.
+//
+// If SinglePort is set, gRPC requests are served by the HTTP server on the HTTP port and no
+// separate gRPC listener is opened.
+//
 // Note that Version and GitSHA *must be specified* before calling this function.
 func (c Config) ServerCmd(
 	ctx context.Context,
@@ -68,11 +85,12 @@ func (c Config) ServerCmd(
 ) *cobra.Command {
 	// HTTP Config
 	httpConfig := shHTTP.NewDefaultConfig(c.Name)
+	httpConfig.Registry = c.Registry
+	httpMetrics := shHTTP.NewMetrics(c.Registry, true)
+	httpConfig.Metrics = &httpMetrics
 	httpConfig.Middleware = []mux.MiddlewareFunc{
 		tracing.HTTPServerMiddleware,
-		shHTTP.NewMetrics(c.Registry, true).Middleware,
-		log.HTTPServerMiddleware,
-		sentry.NewMiddleware().HTTP,
+		httpMetrics.Middleware,
 	}
 
 	// GRPC Config
@@ -81,24 +99,35 @@ func (c Config) ServerCmd(
 	// see reference:f9d302c2-df3f-4110-9529-94b0515c4a17 in this file.
 	// Follow-up: https://spothero.atlassian.net/browse/PMP-402
 	grpcConfig := shGRPC.NewDefaultConfig(c.Name, nil)
+	grpcConfig.Registry = c.Registry
 
 	if len(c.CancelSignals) > 0 {
 		grpcConfig.CancelSignals = c.CancelSignals
 		httpConfig.CancelSignals = c.CancelSignals
 	}
-	// Logging Config
-	lc := &log.Config{
-		UseDevelopmentLogger: true,
-		Fields: map[string]interface{}{
-			"version": c.Version,
-			"git_sha": c.GitSHA[:6], // Log only the first 6 digits of the Git SHA
-		},
-		Cores: []zapcore.Core{&sentry.Core{LevelEnabler: zap.InfoLevel}},
+
+	httpConfig.Listener = c.HTTPListener
+	grpcConfig.Listener = c.GRPCListener
+
+	// Health Config
+	if c.Health == nil {
+		c.Health = health.NewRegistry(c.Registry)
+	}
+	httpConfig.Health = c.Health
+	grpcConfig.Health = c.Health
+
+	// Reload Config
+	if c.Reloader == nil {
+		c.Reloader = NewReloader(c.Registry)
 	}
-	// Sentry Config
-	sc := sentry.Config{AppVersion: c.Version}
-	// Tracing Config
-	tc := tracing.Config{ServiceName: c.Name}
+
+	// HTTP Client Circuit Breaker Config
+	if c.CircuitBreaker == nil {
+		c.CircuitBreaker = &shHTTP.CircuitBreakerConfig{}
+	}
+
+	// Logging, Sentry and Tracing Config
+	ic := c.newInstrumentationConfig()
 	// CORS Config
 	cc := cors.Config{}
 	// Jose Config
@@ -107,98 +136,138 @@ func (c Config) ServerCmd(
 			jose.Auth0Generator{},
 		},
 	}
-	cmd := &cobra.Command{
-		Use:              c.Name,
-		Short:            shortDescription,
-		Long:             longDescription,
-		Version:          fmt.Sprintf("%s (%s)", c.Version, c.GitSHA),
-		PersistentPreRun: cli.CobraBindEnvironmentVariables(strings.Replace(c.Name, "-", "_", -1)),
-		RunE: func(_ *cobra.Command, _ []string) error {
-			sc.Environment = c.Environment
-
-			if err := c.CheckFlags(); err != nil {
-				return err
-			}
-			if err := lc.InitializeLogger(); err != nil {
-				return err
-			}
-			if err := sc.InitializeSentry(); err != nil {
-				return err
-			}
+	cmd := c.newCommand(shortDescription, longDescription)
+	cmd.RunE = func(cmd *cobra.Command, _ []string) error {
+		components, err := newComponentManager(c.Components)
+		if err != nil {
+			return err
+		}
+		shutdown, err := ic.initialize(c)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = shutdown(ctx)
+		}()
+		buildInfo := c.BuildInfo()
+		buildInfo.RegisterMetric(c.Registry)
+		httpConfig.RegisterAdmin = buildInfo.RegisterHandlers
 
-			shutdown, err := tc.TracerProvider()
-			if err != nil {
-				return err
-			}
-			defer func() {
-				err = shutdown(ctx)
-				if err != nil {
-					return
-				}
-			}()
+		// Ensure that gRPC Interceptors capture histograms
+		grpcprom.EnableHandlingTimeHistogram()
+		grpcConfig.UnaryInterceptors = []grpc.UnaryServerInterceptor{
+			otelgrpc.UnaryServerInterceptor(), //nolint:staticcheck
+			tracing.UnaryServerInterceptor,
+			requestid.UnaryServerInterceptor,
+			log.UnaryServerInterceptor,
+			grpcprom.UnaryServerInterceptor,
+			shErrors.UnaryServerInterceptor,
+		}
+		grpcConfig.StreamInterceptors = []grpc.StreamServerInterceptor{
+			otelgrpc.StreamServerInterceptor(), //nolint:staticcheck
+			tracing.StreamServerInterceptor,
+			requestid.StreamServerInterceptor,
+			log.StreamServerInterceptor,
+			grpcprom.StreamServerInterceptor,
+			shErrors.StreamServerInterceptor,
+		}
 
-			// Ensure that gRPC Interceptors capture histograms
-			grpcprom.EnableHandlingTimeHistogram()
-			grpcConfig.UnaryInterceptors = []grpc.UnaryServerInterceptor{
-				otelgrpc.UnaryServerInterceptor(), //nolint:staticcheck
-				tracing.UnaryServerInterceptor,
-				log.UnaryServerInterceptor,
-				grpcprom.UnaryServerInterceptor,
-			}
-			grpcConfig.StreamInterceptors = []grpc.StreamServerInterceptor{
-				otelgrpc.StreamServerInterceptor(), //nolint:staticcheck
-				tracing.StreamServerInterceptor,
-				log.StreamServerInterceptor,
-				grpcprom.StreamServerInterceptor,
-			}
+		// Add the access log ahead of the logging middleware so that its lines are not decorated with
+		// the fields of the debug request log
+		if c.AccessLog.Enabled {
+			httpConfig.Middleware = append(httpConfig.Middleware, c.AccessLog.NewMiddleware())
+		}
+		httpConfig.Middleware = append(httpConfig.Middleware, log.HTTPServerMiddleware, sentry.NewMiddleware().HTTP)
+
+		// Add CORS Middleware. The middleware is always installed so that it may be enabled on reload.
+		corsConfig := cors.NewReloadable(cc)
+		httpConfig.Middleware = append(
+			httpConfig.Middleware,
+			corsConfig.GetHTTPServerMiddleware(),
+		)
 
-			// Add CORS Middleware
-			if cc.EnableMiddleware {
-				httpConfig.Middleware = append(
-					httpConfig.Middleware,
-					cc.GetHTTPServerMiddleware(),
-				)
+		// Add JOSE Auth interceptors
+		jh := jose.NewReloadableHandler(jc.NewJOSE())
+		joseInterceptorFunc := jose.GetContextAuth(jh)
+		grpcConfig.UnaryInterceptors = append(
+			grpcConfig.UnaryInterceptors,
+			grpcauth.UnaryServerInterceptor(joseInterceptorFunc),
+		)
+		grpcConfig.StreamInterceptors = append(
+			grpcConfig.StreamInterceptors,
+			grpcauth.StreamServerInterceptor(joseInterceptorFunc),
+		)
+		httpConfig.Middleware = append(
+			[]mux.MiddlewareFunc{jose.GetHTTPServerMiddleware(jh)},
+			httpConfig.Middleware...,
+		)
+
+		// Request IDs are assigned first so that every response, including rejected requests, carries one
+		httpConfig.Middleware = append(
+			[]mux.MiddlewareFunc{requestid.HTTPServerMiddleware},
+			httpConfig.Middleware...,
+		)
+
+		// Add rate limiting after authentication so that authenticated clients can be identified
+		if c.RateLimit.Enabled() {
+			if c.RateLimit.Registry == nil {
+				c.RateLimit.Registry = c.Registry
 			}
+			limiter := c.RateLimit.NewLimiter()
+			httpConfig.Middleware = append(httpConfig.Middleware, limiter.HTTPServerMiddleware)
+			grpcConfig.UnaryInterceptors = append(grpcConfig.UnaryInterceptors, limiter.UnaryServerInterceptor)
+			grpcConfig.StreamInterceptors = append(grpcConfig.StreamInterceptors, limiter.StreamServerInterceptor)
+		}
 
-			// Add JOSE Auth interceptors
-			jh := jc.NewJOSE()
-			joseInterceptorFunc := jose.GetContextAuth(jh)
-			grpcConfig.UnaryInterceptors = append(
-				grpcConfig.UnaryInterceptors,
-				grpcauth.UnaryServerInterceptor(joseInterceptorFunc),
-			)
-			grpcConfig.StreamInterceptors = append(
-				grpcConfig.StreamInterceptors,
-				grpcauth.StreamServerInterceptor(joseInterceptorFunc),
-			)
-			httpConfig.Middleware = append(
-				[]mux.MiddlewareFunc{jose.GetHTTPServerMiddleware(jh)},
-				httpConfig.Middleware...,
-			)
-
-			// Add panic handlers to the middleware. Panic handlers should always come last,
-			// because they can help recover error state such that it is correctly handled by
-			// upstream interceptors.
-			grpcConfig.UnaryInterceptors = append(
-				grpcConfig.UnaryInterceptors,
-				grpcrecovery.UnaryServerInterceptor(),
-				sentry.UnaryServerInterceptor,
-			)
-			grpcConfig.StreamInterceptors = append(
-				grpcConfig.StreamInterceptors,
-				grpcrecovery.StreamServerInterceptor(),
-				sentry.StreamServerInterceptor,
-			)
-
-			if c.PreStart != nil {
-				var preStartErr error
-				ctx, preStartErr = c.PreStart(ctx)
-				if preStartErr != nil {
-					return preStartErr
-				}
+		// Add adaptive concurrency limiting after rate limiting so that requests rejected for exceeding a
+		// client's rate do not occupy the capacity of the server
+		if c.Concurrency.Enabled {
+			if c.Concurrency.Registry == nil {
+				c.Concurrency.Registry = c.Registry
 			}
+			limiter := c.Concurrency.NewLimiter()
+			httpConfig.Middleware = append(httpConfig.Middleware, limiter.HTTPServerMiddleware)
+			grpcConfig.UnaryInterceptors = append(grpcConfig.UnaryInterceptors, limiter.UnaryServerInterceptor)
+			grpcConfig.StreamInterceptors = append(grpcConfig.StreamInterceptors, limiter.StreamServerInterceptor)
+		}
+
+		// Add panic handlers to the middleware. Panic handlers should always come last,
+		// because they can help recover error state such that it is correctly handled by
+		// upstream interceptors.
+		grpcConfig.UnaryInterceptors = append(
+			grpcConfig.UnaryInterceptors,
+			grpcrecovery.UnaryServerInterceptor(),
+			sentry.UnaryServerInterceptor,
+		)
+		grpcConfig.StreamInterceptors = append(
+			grpcConfig.StreamInterceptors,
+			grpcrecovery.StreamServerInterceptor(),
+			sentry.StreamServerInterceptor,
+		)
 
+		// Re-apply CORS and JOSE settings on reload without interrupting in-flight requests
+		reloadCtx, cancelReload := context.WithCancel(ctx)
+		defer cancelReload()
+		err = c.watchReloads(reloadCtx, cmd.Flags(), ic,
+			reloadHook{name: "cors", reload: func(context.Context) error {
+				corsConfig.Reload(cc)
+				return nil
+			}},
+			reloadHook{name: "jose", reload: func(context.Context) error {
+				jh.Reload(jc.NewJOSE())
+				return nil
+			}},
+		)
+		if err != nil {
+			return err
+		}
+
+		return c.run(ctx, components, func(runCtx context.Context) error {
+			// The gRPC server is stopped if the HTTP server cannot be started
+			runCtx, cancelServe := context.WithCancel(runCtx)
+			defer cancelServe()
 			var wg sync.WaitGroup
+			var grpcServer shGRPC.Server
 			if newGRPCService != nil {
 				// XXX: here we mutate grpc.Config, which is hitherto nil; this
 				// is done in order to defer calling newGRPCService until
@@ -207,7 +276,18 @@ func (c Config) ServerCmd(
 				// reference:f9d302c2-df3f-4110-9529-94b0515c4a17
 				// Follow-up: https://spothero.atlassian.net/browse/PMP-402
 				grpcConfig.ServerRegistration = newGRPCService(c).RegisterAPIs
-				grpcDone, grpcErr := grpcConfig.NewServer().Run()
+				grpcServer = grpcConfig.NewServer()
+				// The registered gRPC services are listed in the route inventory of the HTTP server
+				httpConfig.GRPCServer = grpcServer
+				if c.SinglePort {
+					// gRPC requests are dispatched by the HTTP server, which
+					// shuts down the gRPC server alongside itself so that
+					// in-flight RPCs are drained
+					httpConfig.GRPCHandler = grpcServer
+				}
+			}
+			if newGRPCService != nil && !c.SinglePort {
+				grpcDone, grpcErr := grpcServer.RunContext(runCtx)
 				if grpcErr != nil {
 					return grpcErr
 				}
@@ -217,6 +297,7 @@ func (c Config) ServerCmd(
 					wg.Done()
 				}()
 			}
+			var httpErr error
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -224,27 +305,165 @@ func (c Config) ServerCmd(
 					httpService := newHTTPService(c)
 					httpConfig.RegisterHandlers = httpService.RegisterHandlers
 				}
-				httpConfig.NewServer().Run()
+				if httpErr = httpConfig.NewServer().RunContext(runCtx); httpErr != nil {
+					cancelServe()
+				}
 			}()
-
 			wg.Wait()
-			if c.PostShutdown != nil {
-				if err = c.PostShutdown(ctx); err != nil {
-					return err
-				}
-			}
-			return nil
-		},
+			return httpErr
+		})
 	}
 	// Register Cobra/Viper CLI Flags
 	flags := cmd.Flags()
 	c.RegisterFlags(flags)
+	c.RateLimit.RegisterFlags(flags)
+	c.Concurrency.RegisterFlags(flags)
+	c.AccessLog.RegisterFlags(flags)
+	c.CircuitBreaker.RegisterFlags(flags)
 	httpConfig.RegisterFlags(flags)
 	grpcConfig.RegisterFlags(flags)
-	lc.RegisterFlags(flags)
-	sc.RegisterFlags(flags)
-	tc.RegisterFlags(flags)
+	ic.registerFlags(flags)
 	cc.RegisterFlags(flags)
 	jc.RegisterFlags(flags)
 	return cmd
 }
+
+// instrumentationConfig contains the logging, Sentry and tracing configuration shared by all
+// commands created by this package
+type instrumentationConfig struct {
+	lc *log.Config
+	sc sentry.Config
+	tc tracing.Config
+}
+
+// newInstrumentationConfig returns the default logging, Sentry and tracing configuration for
+// the service
+func (c Config) newInstrumentationConfig() *instrumentationConfig {
+	return &instrumentationConfig{
+		lc: &log.Config{
+			UseDevelopmentLogger: true,
+			Fields: map[string]interface{}{
+				"version": c.Version,
+				"git_sha": c.GitSHA[:6], // Log only the first 6 digits of the Git SHA
+			},
+			Cores: []zapcore.Core{&sentry.Core{LevelEnabler: zap.InfoLevel}},
+		},
+		sc: sentry.Config{AppVersion: c.Version},
+		tc: tracing.Config{ServiceName: c.Name, ServiceVersion: c.Version, GitSHA: c.GitSHA},
+	}
+}
+
+// registerFlags registers logging, Sentry and tracing flags with pflags
+func (ic *instrumentationConfig) registerFlags(flags *pflag.FlagSet) {
+	ic.lc.RegisterFlags(flags)
+	ic.sc.RegisterFlags(flags)
+	ic.tc.RegisterFlags(flags)
+}
+
+// initialize validates the service Config and initializes the logger, Sentry and the tracer.
+// The returned function must be called to flush and shut down the tracer.
+func (ic *instrumentationConfig) initialize(c Config) (func(context.Context) error, error) {
+	// The environment may only be known once flags have been parsed
+	ic.sc.Environment = c.Environment
+	ic.tc.Environment = c.Environment
+	if err := c.CheckFlags(); err != nil {
+		return nil, err
+	}
+	if err := ic.lc.InitializeLogger(); err != nil {
+		return nil, err
+	}
+	if err := ic.sc.InitializeSentry(); err != nil {
+		return nil, err
+	}
+	return ic.tc.TracerProvider()
+}
+
+// newCommand returns a cobra command for the service. Flags may be set from the command line,
+// environment variables or the file given by --config, in that order of precedence.
+func (c Config) newCommand(shortDescription, longDescription string) *cobra.Command {
+	bindEnvironmentVariables := cli.CobraBindEnvironmentVariables(strings.Replace(c.Name, "-", "_", -1))
+	bindConfigFile := cli.CobraBindConfigFile()
+	cmd := &cobra.Command{
+		Use:     c.Name,
+		Short:   shortDescription,
+		Long:    longDescription,
+		Version: fmt.Sprintf("%s (%s)", c.Version, c.GitSHA),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			bindEnvironmentVariables(cmd, args)
+			return bindConfigFile(cmd, args)
+		},
+	}
+	cli.RegisterConfigFileFlag(cmd.Flags())
+	return cmd
+}
+
+// watchReloads registers the built-in reload hooks, which re-apply the configuration file and
+// the log level followed by the given hooks, and starts reloading whenever a SIGHUP is received
+// or the configuration file changes. Reloading stops when the given context is cancelled.
+func (c Config) watchReloads(ctx context.Context, flags *pflag.FlagSet, ic *instrumentationConfig, hooks ...reloadHook) error {
+	c.Reloader.registerBuiltin("configuration file", func(context.Context) error {
+		return cli.ApplyConfigFile(flags)
+	})
+	c.Reloader.registerBuiltin("log level", func(context.Context) error {
+		return ic.lc.Reload()
+	})
+	for _, hook := range hooks {
+		c.Reloader.registerBuiltin(hook.name, hook.reload)
+	}
+	path, _ := flags.GetString(cli.ConfigFileFlag)
+	return c.Reloader.Watch(ctx, path, syscall.SIGHUP)
+}
+
+// run manages the lifecycle shared by all commands. PreStart is called, background health checks
+// and all components are started, and then serve is called with a context which is cancelled if
+// any component fails. Once serve returns, the components are stopped in reverse order and
+// PostShutdown is called. All errors encountered along the way are returned.
+func (c Config) run(ctx context.Context, components *componentManager, serve func(ctx context.Context) error) error {
+	if c.PreStart != nil {
+		var preStartErr error
+		ctx, preStartErr = c.PreStart(ctx)
+		if preStartErr != nil {
+			return preStartErr
+		}
+	}
+
+	// Keep the gRPC health service and health metrics current between probes
+	healthCtx, cancelHealth := context.WithCancel(ctx)
+	defer cancelHealth()
+	if c.HealthCheckFrequency > 0 {
+		c.Health.Watch(healthCtx, c.HealthCheckFrequency)
+	}
+
+	// Start all components before the servers begin accepting traffic
+	if err := components.start(ctx); err != nil {
+		return err
+	}
+
+	// Shut down the servers if any component fails
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	go func() {
+		select {
+		case <-components.failed:
+			log.Get(ctx).Error("component failed, shutting down", zap.Error(components.failure()))
+			cancelRun()
+		case <-runCtx.Done():
+		}
+	}()
+	serveErr := serve(runCtx)
+	cancelRun()
+
+	// Components are stopped in reverse order only once the servers have stopped serving traffic
+	stopTimeout := c.ComponentStopTimeout
+	if stopTimeout <= 0 {
+		stopTimeout = defaultComponentStopTimeout
+	}
+	stopCtx, cancelStop := context.WithTimeout(ctx, stopTimeout)
+	defer cancelStop()
+	stopErr := components.stop(stopCtx)
+	var postShutdownErr error
+	if c.PostShutdown != nil {
+		postShutdownErr = c.PostShutdown(ctx)
+	}
+	return errors.Join(serveErr, components.failure(), stopErr, postShutdownErr)
+}
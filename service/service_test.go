@@ -16,6 +16,7 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"strings"
 	"syscall"
@@ -76,7 +77,8 @@ func TestDefaultServer(t *testing.T) {
 	assert.NotZero(t, cmd.Long)
 	assert.True(t, strings.Contains(cmd.Version, c.Version))
 	assert.True(t, strings.Contains(cmd.Version, c.GitSHA))
-	assert.NotNil(t, cmd.PersistentPreRun)
+	assert.NotNil(t, cmd.PersistentPreRunE)
+	assert.NotNil(t, cmd.Flags().Lookup("config"))
 	assert.NotNil(t, cmd.RunE)
 	assert.True(t, cmd.Flags().HasFlags())
 	mockPrePost.On("preStart", ctx).Return(ctx, nil)
@@ -94,3 +96,81 @@ func TestDefaultServer(t *testing.T) {
 	assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
 	<-done
 }
+
+// failingComponent reports a failure shortly after it is started
+type failingComponent struct {
+	stopped bool
+}
+
+func (fc *failingComponent) Start(ctx context.Context) error {
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ReportFailure(ctx, fmt.Errorf("consumer disconnected"))
+	}()
+	return nil
+}
+
+func (fc *failingComponent) Stop(_ context.Context) error {
+	fc.stopped = true
+	return nil
+}
+
+func TestServerCmdComponentFailure(t *testing.T) {
+	c := Config{
+		Name:          "test",
+		Environment:   "test",
+		Registry:      prometheus.NewRegistry(),
+		Version:       "0.1.0",
+		GitSHA:        "abc123",
+		CancelSignals: []os.Signal{syscall.SIGUSR2},
+	}
+	component := &failingComponent{}
+	c.RegisterComponent("consumer", component)
+	cmd := c.ServerCmd(
+		context.Background(),
+		"short",
+		"long",
+		func(Config) HTTPService { return mockHTTPService{} },
+		func(Config) GRPCService { return mockGRPCService{} },
+	)
+	cmd.SetArgs([]string{"--port", "60990", "--grpc-port", "60991"})
+	err := cmd.Execute()
+	assert.EqualError(t, err, "component `consumer` failed: consumer disconnected")
+	assert.True(t, component.stopped)
+}
+
+func TestServerCmdInvalidTLS(t *testing.T) {
+	c := Config{
+		Name:          "test",
+		Environment:   "test",
+		Registry:      prometheus.NewRegistry(),
+		Version:       "0.1.0",
+		GitSHA:        "abc123",
+		CancelSignals: []os.Signal{syscall.SIGUSR2},
+	}
+	cmd := c.ServerCmd(
+		context.Background(),
+		"short",
+		"long",
+		func(Config) HTTPService { return mockHTTPService{} },
+		func(Config) GRPCService { return mockGRPCService{} },
+	)
+	cmd.SetArgs([]string{
+		"--port", "60993",
+		"--grpc-port", "60994",
+		"--tls-enabled",
+		"--tls-crt-path", "../testdata/does-not-exist-crt.pem",
+		"--tls-key-path", "../testdata/fake-key.pem",
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Execute()
+	}()
+	// the command fails at startup rather than waiting for a cancellation signal
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "failed to configure https server tls")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command did not exit")
+	}
+}
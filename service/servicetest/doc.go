@@ -0,0 +1,9 @@
+// Package servicetest starts services built with service.ServerCmd in-process for end-to-end tests.
+// Servers listen on ephemeral ports, register their metrics with a separate Prometheus registry,
+// and are shut down by cancelling a context rather than by sending signals to the test process.
+//
+// Services are not fully isolated from one another. The logger, environment variable bindings and
+// gRPC server metrics of go-grpc-prometheus are global to the process, so services started
+// concurrently in the same test binary share them. The /metrics endpoint serves the metrics of the
+// global registry alongside those of the service's registry.
+package servicetest
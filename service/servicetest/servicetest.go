@@ -0,0 +1,225 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servicetest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+	"github.com/spothero/tools/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ReadyTimeout is the maximum amount of time Start waits for the service to become ready
+var ReadyTimeout = 10 * time.Second
+
+// ReadyPath is the path Start polls until it responds with 200 OK. It is requested from the admin
+// server if the service is started with --admin-port, and from the public HTTP server otherwise.
+// If empty, /health/ready is polled when the health handler is enabled. When it is disabled with
+// --health-handler=false, the service is ready as soon as its HTTP server responds to a request.
+var ReadyPath = ""
+
+// Server is a service started in-process by Start
+type Server struct {
+	GRPCConn    *grpc.ClientConn     // A connection to the gRPC server. Nil if the service has no gRPC server.
+	Registry    *prometheus.Registry // The Prometheus registry with which the service registers its metrics
+	cancel      context.CancelFunc   // Cancels the context passed to the service, shutting it down
+	done        chan struct{}        // Closed once the service command has returned
+	err         error                // The error returned by the service command
+	stopOnce    *sync.Once           // Ensures the service is only stopped once
+	listeners   []net.Listener       // Listeners bound on behalf of the service
+	URL         string               // The base URL of the HTTP server, e.g. http://127.0.0.1:51234
+	AdminURL    string               // The base URL of the admin server. Empty if the service has no admin server.
+	GRPCAddress string               // The address of the gRPC server. Empty if the service has no gRPC server.
+}
+
+// Start runs the service described by the given Config and service constructors, as
+// service.ServerCmd would, and blocks until the service reports that it is ready on
+// /health/ready, or ReadyPath if set. Any args are passed to the command as command line arguments.
+//
+// The HTTP and gRPC servers listen on ephemeral ports on the loopback interface. If no Registry
+// is set on the Config, a new Prometheus registry is used so that the metrics registered by the
+// service do not conflict with those of other tests, although some metrics remain global as
+// described in the package documentation. Missing Name, Environment, Version and GitSHA values are
+// filled with placeholders.
+//
+// The service is stopped automatically when the test completes, or earlier by calling Stop. The
+// test fails immediately if the service cannot be started.
+func Start(
+	t testing.TB,
+	c service.Config,
+	newHTTPService func(service.Config) service.HTTPService,
+	newGRPCService func(service.Config) service.GRPCService,
+	args ...string,
+) *Server {
+	t.Helper()
+	s := &Server{done: make(chan struct{}), stopOnce: &sync.Once{}}
+	if c.Registry == nil {
+		s.Registry = prometheus.NewRegistry()
+		c.Registry = s.Registry
+	} else if registry, ok := c.Registry.(*prometheus.Registry); ok {
+		s.Registry = registry
+	}
+	setDefault(&c.Name, "servicetest")
+	setDefault(&c.Environment, "test")
+	setDefault(&c.Version, "0.0.0")
+	setDefault(&c.GitSHA, "servicetest")
+
+	httpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen for http: %v", err)
+	}
+	c.HTTPListener = httpListener
+	s.listeners = append(s.listeners, httpListener)
+	s.URL = fmt.Sprintf("http://%s", httpListener.Addr())
+	if newGRPCService != nil {
+		// The gRPC listener is left unused if the service is configured to serve on a single port
+		grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			_ = httpListener.Close()
+			t.Fatalf("failed to listen for grpc: %v", err)
+		}
+		c.GRPCListener = grpcListener
+		s.listeners = append(s.listeners, grpcListener)
+		s.GRPCAddress = grpcListener.Addr().String()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	cmd := c.ServerCmd(ctx, "servicetest", "servicetest", newHTTPService, newGRPCService)
+	// Flags may enable single port mode from the arguments, environment or configuration file, so
+	// the final value is captured once they have been bound
+	var singlePort, healthHandler bool
+	var adminAddress string
+	var adminPort uint16
+	flagsBound := make(chan struct{})
+	bindFlags := cmd.PersistentPreRunE
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		defer close(flagsBound)
+		err := bindFlags(cmd, args)
+		singlePort, _ = cmd.Flags().GetBool("single-port")
+		healthHandler, _ = cmd.Flags().GetBool("health-handler")
+		adminAddress, _ = cmd.Flags().GetString("admin-address")
+		adminPort, _ = cmd.Flags().GetUint16("admin-port")
+		return err
+	}
+	// A non-nil argument list prevents cobra from parsing the arguments of the test binary
+	cmd.SetArgs(append([]string{}, args...))
+	cmd.SilenceUsage = true
+	go func() {
+		defer close(s.done)
+		s.err = cmd.Execute()
+	}()
+	t.Cleanup(func() {
+		if err := s.Stop(); err != nil {
+			t.Errorf("service returned an error: %v", err)
+		}
+	})
+
+	select {
+	case <-flagsBound:
+	case <-s.done:
+		t.Fatalf("service exited before binding its flags: %v", s.err)
+	}
+	readyURL := s.URL
+	if adminPort != 0 {
+		if adminAddress == "" || net.ParseIP(adminAddress).IsUnspecified() {
+			adminAddress = "127.0.0.1"
+		}
+		s.AdminURL = fmt.Sprintf("http://%s", net.JoinHostPort(adminAddress, strconv.Itoa(int(adminPort))))
+		readyURL = s.AdminURL
+	}
+	readyPath, anyResponse := ReadyPath, false
+	if readyPath == "" {
+		readyPath, anyResponse = "/health/ready", !healthHandler
+	}
+	if err := s.waitReady(readyURL+readyPath, anyResponse); err != nil {
+		t.Fatalf("service did not become ready: %v", err)
+	}
+	if s.GRPCAddress != "" && singlePort {
+		s.GRPCAddress = httpListener.Addr().String()
+	}
+	if s.GRPCAddress != "" {
+		conn, err := grpc.DialContext(ctx, s.GRPCAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("failed to connect to grpc server: %v", err)
+		}
+		s.GRPCConn = conn
+	}
+	return s
+}
+
+// Stop shuts the service down and waits for it to exit, returning any error returned by the
+// service command. Stop may be called more than once.
+func (s *Server) Stop() error {
+	s.stopOnce.Do(func() {
+		if s.GRPCConn != nil {
+			_ = s.GRPCConn.Close()
+		}
+		s.cancel()
+		<-s.done
+		// Listeners are closed by the servers, unless the service exited before serving
+		for _, listener := range s.listeners {
+			_ = listener.Close()
+		}
+	})
+	return s.err
+}
+
+// waitReady polls the readiness URL until it responds with 200 OK, or with any status if
+// anyResponse is set, the service exits or ReadyTimeout elapses
+func (s *Server) waitReady(url string, anyResponse bool) error {
+	timeout := time.NewTimer(ReadyTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	// Connections are not kept alive, so that none are left idle when the servers shut down
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK || anyResponse {
+				return nil
+			}
+		}
+		select {
+		case <-s.done:
+			if s.err != nil {
+				return fmt.Errorf("service exited: %w", s.err)
+			}
+			return fmt.Errorf("service exited before becoming ready")
+		case <-timeout.C:
+			return fmt.Errorf("timed out after %s", ReadyTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// setDefault sets value to defaultValue if value is empty
+func setDefault(value *string, defaultValue string) {
+	if *value == "" {
+		*value = defaultValue
+	}
+}
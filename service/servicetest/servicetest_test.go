@@ -0,0 +1,156 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servicetest
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/spothero/tools/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type httpService struct{}
+
+func (httpService) RegisterHandlers(router *mux.Router) {
+	router.HandleFunc("/hello", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+}
+
+type grpcService struct{}
+
+func (grpcService) RegisterAPIs(*grpc.Server) {}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "http and grpc are served on separate ports"},
+		{name: "http and grpc are served on a single port", args: []string{"--single-port"}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			s := Start(
+				t,
+				service.Config{},
+				func(service.Config) service.HTTPService { return httpService{} },
+				func(service.Config) service.GRPCService { return grpcService{} },
+				test.args...,
+			)
+
+			resp, err := http.Get(s.URL + "/hello")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", string(body))
+			assert.NotEmpty(t, resp.Header.Get("X-Request-ID"))
+
+			version, err := http.Get(s.URL + "/version")
+			require.NoError(t, err)
+			defer version.Body.Close()
+			assert.Equal(t, http.StatusOK, version.StatusCode)
+
+			require.NotNil(t, s.GRPCConn)
+			check, err := healthpb.NewHealthClient(s.GRPCConn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check.Status)
+
+			// metrics are recorded in the service's registry
+			families, err := s.Registry.Gather()
+			require.NoError(t, err)
+			names := make([]string, 0, len(families))
+			for _, family := range families {
+				names = append(names, family.GetName())
+			}
+			assert.Contains(t, names, "servicetest_build_info")
+			metrics, err := http.Get(s.URL + "/metrics")
+			require.NoError(t, err)
+			defer metrics.Body.Close()
+			metricsBody, err := io.ReadAll(metrics.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(metricsBody), "servicetest_build_info")
+
+			assert.NoError(t, s.Stop())
+			_, err = http.Get(s.URL + "/hello")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStartHTTPOnly(t *testing.T) {
+	s := Start(t, service.Config{}, func(service.Config) service.HTTPService { return httpService{} }, nil)
+	assert.Nil(t, s.GRPCConn)
+	assert.Empty(t, s.GRPCAddress)
+}
+
+func TestStartReadiness(t *testing.T) {
+	// An ephemeral port is reserved for the admin server, which cannot be given a listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	adminPort := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, listener.Close())
+
+	tests := []struct {
+		name          string
+		args          []string
+		expectedAdmin bool
+	}{
+		{name: "readiness is polled on the public server"},
+		{name: "readiness is polled on the admin server", args: []string{"--admin-port", adminPort}, expectedAdmin: true},
+		{name: "any response is accepted without the health handler", args: []string{"--health-handler=false"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := Start(t, service.Config{}, func(service.Config) service.HTTPService { return httpService{} }, nil, test.args...)
+			if !test.expectedAdmin {
+				assert.Empty(t, s.AdminURL)
+				return
+			}
+			assert.Equal(t, "http://127.0.0.1:"+adminPort, s.AdminURL)
+			resp, err := http.Get(s.AdminURL + "/health/ready")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			// health endpoints are no longer served on the public port
+			public, err := http.Get(s.URL + "/health/ready")
+			require.NoError(t, err)
+			defer public.Body.Close()
+			assert.Equal(t, http.StatusNotFound, public.StatusCode)
+		})
+	}
+}
+
+func TestStartReadyPath(t *testing.T) {
+	ReadyPath = "/hello"
+	defer func() { ReadyPath = "" }()
+	s := Start(t, service.Config{}, func(service.Config) service.HTTPService { return httpService{} }, nil, "--health-handler=false")
+	resp, err := http.Get(s.URL + "/hello")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
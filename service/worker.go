@@ -0,0 +1,123 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+	"github.com/spothero/tools/health"
+	shHTTP "github.com/spothero/tools/http"
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+)
+
+// WorkerCmd creates a command for services which do not expose public HTTP or gRPC APIs, such as
+// Kafka consumers. The run function is called once all flags and environment variables have been
+// parsed and the logger, Sentry and tracer have been initialized. The context passed to run is
+// cancelled when a cancellation signal is received or a registered Component fails; run should
+// return promptly once this happens. The command exits with the error returned by run.
+//
+// Rather than a public HTTP server, the worker runs an internal admin HTTP server which only
+// exposes health checks, metrics, pprof, log level and /version endpoints on the admin address and
+// port, which default to 127.0.0.1:8080. Components registered on the Config are started before
+// run is called and stopped after it returns.
+//
+// Note that Version and GitSHA *must be specified* before calling this function.
+func (c Config) WorkerCmd(
+	ctx context.Context,
+	shortDescription, longDescription string,
+	run func(ctx context.Context, c Config) error,
+) *cobra.Command {
+	// Admin HTTP Config
+	adminConfig := shHTTP.NewDefaultConfig(c.Name)
+	adminConfig.AdminPort = 8080
+	adminConfig.Registry = c.Registry
+	if len(c.CancelSignals) > 0 {
+		adminConfig.CancelSignals = c.CancelSignals
+	}
+
+	// Health Config
+	if c.Health == nil {
+		c.Health = health.NewRegistry(c.Registry)
+	}
+	adminConfig.Health = c.Health
+
+	// Reload Config
+	if c.Reloader == nil {
+		c.Reloader = NewReloader(c.Registry)
+	}
+
+	// HTTP Client Circuit Breaker Config
+	if c.CircuitBreaker == nil {
+		c.CircuitBreaker = &shHTTP.CircuitBreakerConfig{}
+	}
+
+	// Logging, Sentry and Tracing Config
+	ic := c.newInstrumentationConfig()
+	cmd := c.newCommand(shortDescription, longDescription)
+	cmd.RunE = func(cmd *cobra.Command, _ []string) error {
+		components, err := newComponentManager(c.Components)
+		if err != nil {
+			return err
+		}
+		shutdown, err := ic.initialize(c)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = shutdown(ctx)
+		}()
+		buildInfo := c.BuildInfo()
+		buildInfo.RegisterMetric(c.Registry)
+		adminConfig.RegisterAdmin = buildInfo.RegisterHandlers
+
+		reloadCtx, cancelReload := context.WithCancel(ctx)
+		defer cancelReload()
+		if err = c.watchReloads(reloadCtx, cmd.Flags(), ic); err != nil {
+			return err
+		}
+
+		return c.run(ctx, components, func(runCtx context.Context) error {
+			// Stop the worker when a cancellation signal is received
+			workerCtx, cancelWorker := signal.NotifyContext(runCtx, adminConfig.CancelSignals...)
+			defer cancelWorker()
+
+			adminDone := make(chan struct{})
+			var adminErr error
+			go func() {
+				defer close(adminDone)
+				adminErr = adminConfig.NewAdminServer().RunContext(workerCtx)
+			}()
+
+			runErr := run(workerCtx, c)
+			if runErr != nil {
+				log.Get(ctx).Error("worker exited with an error", zap.Error(runErr))
+			}
+			cancelWorker()
+			<-adminDone
+			return errors.Join(runErr, adminErr)
+		})
+	}
+	// Register Cobra/Viper CLI Flags
+	flags := cmd.Flags()
+	c.RegisterFlags(flags)
+	adminConfig.RegisterAdminFlags(flags)
+	c.CircuitBreaker.RegisterFlags(flags)
+	ic.registerFlags(flags)
+	return cmd
+}
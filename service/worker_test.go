@@ -0,0 +1,92 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerCmd(t *testing.T) {
+	tests := []struct {
+		run         func(t *testing.T) func(ctx context.Context, c Config) error
+		name        string
+		expectedErr string
+	}{
+		{
+			name: "the worker exposes the admin server and stops on a cancellation signal",
+			run: func(t *testing.T) func(ctx context.Context, c Config) error {
+				return func(ctx context.Context, c Config) error {
+					assert.Equal(t, "test", c.Name)
+					for _, path := range []string{"/metrics", "/health/ready", "/loglevel"} {
+						assert.Eventually(t, func() bool {
+							resp, err := http.Get("http://127.0.0.1:60992" + path)
+							if err != nil {
+								return false
+							}
+							defer resp.Body.Close()
+							return resp.StatusCode == http.StatusOK
+						}, time.Second, 5*time.Millisecond, path)
+					}
+					assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+					<-ctx.Done()
+					return nil
+				}
+			},
+		}, {
+			name: "the worker exits with the error returned by the run function",
+			run: func(_ *testing.T) func(ctx context.Context, c Config) error {
+				return func(_ context.Context, _ Config) error {
+					return fmt.Errorf("consumer group rebalance failed")
+				}
+			},
+			expectedErr: "consumer group rebalance failed",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := Config{
+				Name:          "test",
+				Environment:   "test",
+				Registry:      prometheus.NewRegistry(),
+				Version:       "0.1.0",
+				GitSHA:        "abc123",
+				CancelSignals: []os.Signal{syscall.SIGUSR1},
+			}
+			cmd := c.WorkerCmd(context.Background(), "short", "long", test.run(t))
+			assert.True(t, strings.Contains(cmd.Version, c.Version))
+			assert.NotNil(t, cmd.PersistentPreRunE)
+			for _, name := range []string{"grpc-port", "port", "tls-enabled", "compression-enabled", "routes-handler"} {
+				assert.Nil(t, cmd.Flags().Lookup(name), name)
+			}
+			cmd.SetArgs([]string{"--admin-port", "60992"})
+			err := cmd.Execute()
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
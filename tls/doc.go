@@ -0,0 +1,3 @@
+// Package tls builds server TLS configurations whose certificates are reloaded from disk whenever
+// they are rotated, with optional client certificate verification for mutual TLS.
+package tls
@@ -0,0 +1,91 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/spothero/tools/log"
+	"github.com/spothero/tools/utils"
+	"go.uber.org/zap"
+)
+
+// CertificateReloader serves a TLS certificate and key pair loaded from disk, replacing it
+// whenever Reload is called or, once Watch is called, whenever either file changes.
+type CertificateReloader struct {
+	certificate atomic.Pointer[tls.Certificate]
+	certPath    string
+	keyPath     string
+}
+
+// NewCertificateReloader creates a CertificateReloader for the given certificate and key files.
+// An error is returned if the key pair cannot be loaded.
+func NewCertificateReloader(certPath, keyPath string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certPath: certPath, keyPath: keyPath}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the key pair from disk. If the key pair cannot be loaded, an error is returned and
+// the previously loaded certificate continues to be served.
+func (r *CertificateReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load tls x509 key pair: %w", err)
+	}
+	r.certificate.Store(&cert)
+	return nil
+}
+
+// GetCertificate returns the most recently loaded certificate. It is suitable for use as the
+// GetCertificate callback of a tls.Config.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.certificate.Load(), nil
+}
+
+// Watch creates a goroutine which calls Reload whenever the certificate or key file changes. The
+// directories containing the files are watched so that files which are replaced rather than
+// modified, such as Kubernetes Secret volumes, are detected. Calling the cancel function
+// associated with the provided context stops watching. An error is returned if the files cannot
+// be watched.
+func (r *CertificateReloader) Watch(ctx context.Context) error {
+	err := utils.WatchFiles(ctx, []string{r.certPath, r.keyPath}, func(string) {
+		if err := r.Reload(); err != nil {
+			log.Get(ctx).Error("tls certificate reload failed", zap.Error(err))
+			return
+		}
+		log.Get(ctx).Info("tls certificate reloaded", r.expiryField())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch tls certificate: %w", err)
+	}
+	return nil
+}
+
+// expiryField returns a log field containing the expiry of the current certificate
+func (r *CertificateReloader) expiryField() zap.Field {
+	cert := r.certificate.Load()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return zap.Skip()
+	}
+	return zap.Time("not_after", leaf.NotAfter)
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := newCertificate(t, 1, nil, nil)
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeKeyPair(t, cert, key, certPath, keyPath)
+
+	reloader, err := NewCertificateReloader(certPath, keyPath)
+	require.NoError(t, err)
+	loaded, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Raw, loaded.Certificate[0])
+
+	_, err = NewCertificateReloader(certPath, filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := newCertificate(t, 1, nil, nil)
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeKeyPair(t, cert, key, certPath, keyPath)
+	reloader, err := NewCertificateReloader(certPath, keyPath)
+	require.NoError(t, err)
+
+	// invalid key pairs leave the previous certificate in place
+	require.NoError(t, os.WriteFile(keyPath, []byte("invalid"), 0o600))
+	assert.Error(t, reloader.Reload())
+	loaded, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Raw, loaded.Certificate[0])
+
+	rotated, rotatedKey := newCertificate(t, 2, nil, nil)
+	writeKeyPair(t, rotated, rotatedKey, certPath, keyPath)
+	assert.NoError(t, reloader.Reload())
+	loaded, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, rotated.Raw, loaded.Certificate[0])
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := newCertificate(t, 1, nil, nil)
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeKeyPair(t, cert, key, certPath, keyPath)
+	reloader, err := NewCertificateReloader(certPath, keyPath)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, reloader.Watch(ctx))
+
+	rotated, rotatedKey := newCertificate(t, 2, nil, nil)
+	writeKeyPair(t, rotated, rotatedKey, certPath, keyPath)
+	assert.Eventually(t, func() bool {
+		loaded, err := reloader.GetCertificate(nil)
+		return err == nil && string(loaded.Certificate[0]) == string(rotated.Raw)
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Error(t, (&CertificateReloader{certPath: filepath.Join(dir, "missing", "tls.crt")}).Watch(ctx))
+}
@@ -0,0 +1,142 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Client certificate verification modes
+const (
+	ClientAuthNone     = "none"     // Client certificates are not requested
+	ClientAuthOptional = "optional" // Client certificates are verified if presented
+	ClientAuthRequire  = "require"  // Client certificates are required and verified
+)
+
+// Config contains the configuration necessary for serving TLS
+type Config struct {
+	CertPath     string   // Location of the TLS Certificate
+	KeyPath      string   // Location of the TLS Key
+	ClientCAPath string   // Location of the CA bundle used to verify client certificates. It is not reloaded.
+	ClientAuth   string   // One of none, optional or require. Defaults to none.
+	MinVersion   string   // Minimum TLS version, one of 1.0, 1.1, 1.2 or 1.3. Defaults to 1.2.
+	CipherSuites []string // Cipher suites enabled for TLS 1.2 and below. Defaults to the Go defaults.
+}
+
+// versions maps the accepted minimum TLS version names to their values
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig returns a server tls.Config for the Config. The certificate and key are loaded
+// immediately, returning an error if they are invalid, and are reloaded through GetCertificate
+// whenever either file changes until the given context is cancelled. If client certificate
+// verification is enabled, client certificates are verified against the CA bundle at
+// ClientCAPath, which must be provided. Unlike the certificate and key, the CA bundle is only
+// loaded once, so the server must be restarted for a rotated CA to take effect.
+func (c Config) NewTLSConfig(ctx context.Context) (*tls.Config, error) {
+	clientAuth, err := parseClientAuth(c.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	minVersion := uint16(tls.VersionTLS12)
+	if c.MinVersion != "" {
+		var ok bool
+		if minVersion, ok = versions[c.MinVersion]; !ok {
+			return nil, fmt.Errorf("unknown minimum tls version %s", c.MinVersion)
+		}
+	}
+	cipherSuites, err := parseCipherSuites(c.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ClientAuth:   clientAuth,
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+	}
+	switch {
+	case c.ClientCAPath != "":
+		if tlsConfig.ClientCAs, err = loadCertPool(c.ClientCAPath); err != nil {
+			return nil, err
+		}
+	case clientAuth != tls.NoClientCert:
+		return nil, fmt.Errorf("a client ca bundle is required to verify client certificates")
+	}
+	reloader, err := NewCertificateReloader(c.CertPath, c.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := reloader.Watch(ctx); err != nil {
+		return nil, err
+	}
+	tlsConfig.GetCertificate = reloader.GetCertificate
+	return tlsConfig, nil
+}
+
+// parseClientAuth returns the tls.ClientAuthType for the given client authentication mode
+func parseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown tls client auth mode %s", mode)
+	}
+}
+
+// parseCipherSuites returns the IDs of the named cipher suites. Only cipher suites without known
+// security issues are accepted.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ids := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+	cipherSuites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := ids[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure tls cipher suite %s", name)
+		}
+		cipherSuites = append(cipherSuites, id)
+	}
+	return cipherSuites, nil
+}
+
+// loadCertPool reads the PEM encoded certificates at path into a new x509.CertPool
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client ca bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if ok := pool.AppendCertsFromPEM(pem); !ok {
+		return nil, fmt.Errorf("failed to parse client ca bundle %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCertificate creates a certificate with the given serial number, signed by parent and
+// parentKey, or self-signed if parent is nil
+func newCertificate(t *testing.T, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+// writeKeyPair writes the PEM encoded certificate and key to the given paths
+func writeKeyPair(t *testing.T, cert *x509.Certificate, key *ecdsa.PrivateKey, certPath, keyPath string) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+// tlsCertificate converts the certificate and key to a tls.Certificate
+func tlsCertificate(cert *x509.Certificate, key *ecdsa.PrivateKey) tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newCertificate(t, 1, nil, nil)
+	serverCert, serverKey := newCertificate(t, 2, ca, caKey)
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	caPath := filepath.Join(dir, "ca.crt")
+	writeKeyPair(t, serverCert, serverKey, certPath, keyPath)
+	require.NoError(t, os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0o600))
+
+	tests := []struct {
+		name               string
+		config             Config
+		expectedCiphers    []uint16
+		expectedClientAuth tls.ClientAuthType
+		expectedMinVersion uint16
+		expectErr          bool
+		expectClientCAs    bool
+	}{
+		{
+			name:               "defaults serve the certificate without client verification",
+			config:             Config{CertPath: certPath, KeyPath: keyPath},
+			expectedClientAuth: tls.NoClientCert,
+			expectedMinVersion: tls.VersionTLS12,
+		},
+		{
+			name: "client certificates are verified against the client ca bundle",
+			config: Config{
+				CertPath:     certPath,
+				KeyPath:      keyPath,
+				ClientCAPath: caPath,
+				ClientAuth:   ClientAuthRequire,
+				MinVersion:   "1.3",
+				CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+			},
+			expectedClientAuth: tls.RequireAndVerifyClientCert,
+			expectedMinVersion: tls.VersionTLS13,
+			expectedCiphers:    []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			expectClientCAs:    true,
+		},
+		{
+			name:               "optional client certificates are verified if given",
+			config:             Config{CertPath: certPath, KeyPath: keyPath, ClientCAPath: caPath, ClientAuth: ClientAuthOptional},
+			expectedClientAuth: tls.VerifyClientCertIfGiven,
+			expectedMinVersion: tls.VersionTLS12,
+			expectClientCAs:    true,
+		},
+		{
+			name:      "unknown client auth modes result in an error",
+			config:    Config{CertPath: certPath, KeyPath: keyPath, ClientAuth: "sometimes"},
+			expectErr: true,
+		},
+		{
+			name:      "client verification without a client ca bundle results in an error",
+			config:    Config{CertPath: certPath, KeyPath: keyPath, ClientAuth: ClientAuthRequire},
+			expectErr: true,
+		},
+		{
+			name:      "invalid client ca bundles result in an error",
+			config:    Config{CertPath: certPath, KeyPath: keyPath, ClientCAPath: keyPath, ClientAuth: ClientAuthRequire},
+			expectErr: true,
+		},
+		{
+			name:      "missing client ca bundles result in an error",
+			config:    Config{CertPath: certPath, KeyPath: keyPath, ClientCAPath: filepath.Join(dir, "missing.crt")},
+			expectErr: true,
+		},
+		{
+			name:      "unknown tls versions result in an error",
+			config:    Config{CertPath: certPath, KeyPath: keyPath, MinVersion: "2.0"},
+			expectErr: true,
+		},
+		{
+			name:      "insecure cipher suites result in an error",
+			config:    Config{CertPath: certPath, KeyPath: keyPath, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			expectErr: true,
+		},
+		{
+			name:      "missing certificates result in an error",
+			config:    Config{CertPath: filepath.Join(dir, "missing.crt"), KeyPath: keyPath},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tlsConfig, err := test.config.NewTLSConfig(ctx)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedClientAuth, tlsConfig.ClientAuth)
+			assert.Equal(t, test.expectedMinVersion, tlsConfig.MinVersion)
+			assert.Equal(t, test.expectedCiphers, tlsConfig.CipherSuites)
+			assert.Equal(t, test.expectClientCAs, tlsConfig.ClientCAs != nil)
+			cert, err := tlsConfig.GetCertificate(nil)
+			require.NoError(t, err)
+			assert.Equal(t, serverCert.Raw, cert.Certificate[0])
+		})
+	}
+}
+
+func TestNewTLSConfigMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newCertificate(t, 1, nil, nil)
+	serverCert, serverKey := newCertificate(t, 2, ca, caKey)
+	clientCert, clientKey := newCertificate(t, 3, ca, caKey)
+	untrustedCA, untrustedCAKey := newCertificate(t, 4, nil, nil)
+	untrustedCert, untrustedKey := newCertificate(t, 5, untrustedCA, untrustedCAKey)
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	caPath := filepath.Join(dir, "ca.crt")
+	writeKeyPair(t, serverCert, serverKey, certPath, keyPath)
+	require.NoError(t, os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serverConfig, err := Config{
+		CertPath:     certPath,
+		KeyPath:      keyPath,
+		ClientCAPath: caPath,
+		ClientAuth:   ClientAuthRequire,
+	}.NewTLSConfig(ctx)
+	require.NoError(t, err)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_, _ = conn.Write([]byte("ok"))
+			_ = conn.Close()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	tests := []struct {
+		name         string
+		certificates []tls.Certificate
+		expectErr    bool
+	}{
+		{
+			name:         "trusted client certificates are accepted",
+			certificates: []tls.Certificate{tlsCertificate(clientCert, clientKey)},
+		},
+		{
+			name:         "untrusted client certificates are rejected",
+			certificates: []tls.Certificate{tlsCertificate(untrustedCert, untrustedKey)},
+			expectErr:    true,
+		},
+		{
+			name:      "missing client certificates are rejected",
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+				RootCAs:      roots,
+				Certificates: test.certificates,
+				MinVersion:   tls.VersionTLS12,
+			})
+			if err == nil {
+				defer conn.Close()
+				// With TLS 1.3 the server verifies the client certificate after the client
+				// completes the handshake, so rejections are observed on the first read
+				_, err = conn.Read(make([]byte, 2))
+			}
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -54,6 +54,7 @@ func setSpanTags(r *http.Request, span trace.Span) trace.Span {
 //
 // Outbound responses will be tagged with the following tags, if applicable:
 // * http.status_code
+// * http.response_content_length
 // * error (if the status code is >= 500)
 //
 // The returned HTTP Request includes the wrapped OpenTelemetry Span Context.
@@ -66,8 +67,9 @@ func HTTPServerMiddleware(next http.Handler) http.Handler {
 		span, spanCtx := StartSpanFromContext(r.Context(), writer.FetchRoutePathTemplate(r), trace.WithLinks(links...))
 		span = setSpanTags(r, span)
 		defer func() {
-			if statusRecorder, ok := w.(*writer.StatusRecorder); ok {
+			if statusRecorder, ok := writer.Recorder(w); ok {
 				span.SetAttributes(attribute.String("http.status_code", strconv.Itoa(statusRecorder.StatusCode)))
+				span.SetAttributes(attribute.Int64("http.response_content_length", statusRecorder.BytesWritten))
 				// 5XX Errors are our fault -- note that this span belongs to an errored request
 				if statusRecorder.StatusCode >= http.StatusInternalServerError {
 					span.SetAttributes(attribute.Bool("error", true))
@@ -49,6 +49,9 @@ type Config struct {
 	AgentHost             string
 	ServiceName           string
 	ServiceNamespace      string
+	ServiceVersion        string
+	Environment           string
+	GitSHA                string
 	SamplerParam          float64
 	ReporterMaxQueueSize  int
 	ReporterFlushInterval time.Duration
@@ -60,7 +63,8 @@ type Config struct {
 // TracerProvider returns an OpenTelemetry TracerProvider configured to use
 // the Jaeger exporter that will send spans to the provided url. The returned
 // TracerProvider will also use a Resource configured with all the information
-// about the application.
+// about the application. If no ServiceVersion is provided, the version is read from the
+// VERSION environment variable.
 func (c Config) TracerProvider() (func(context.Context) error, error) {
 	ctx := context.Background()
 	logger := log.Get(ctx).Named("otel-tracer-provider")
@@ -92,11 +96,17 @@ func (c Config) TracerProvider() (func(context.Context) error, error) {
 		sampler = tracesdk.NeverSample()
 	}
 
+	serviceVersion := c.ServiceVersion
+	if serviceVersion == "" {
+		serviceVersion = os.Getenv("VERSION")
+	}
 	tpResource := tracesdk.WithResource(resource.NewWithAttributes(
 		semconv.SchemaURL,
 		semconv.ServiceNameKey.String(c.ServiceName),
 		semconv.ServiceNamespaceKey.String(c.ServiceNamespace),
-		semconv.ServiceVersionKey.String(os.Getenv("VERSION")),
+		semconv.ServiceVersionKey.String(serviceVersion),
+		semconv.DeploymentEnvironmentKey.String(c.Environment),
+		attribute.String("git_sha", c.GitSHA),
 		semconv.TelemetrySDKLanguageGo,
 		semconv.TelemetrySDKNameKey.String("opentelemetry"),
 		semconv.TelemetrySDKVersionKey.String("1.23.1"),
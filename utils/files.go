@@ -0,0 +1,85 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spothero/tools/log"
+	"go.uber.org/zap"
+)
+
+// WatchFiles creates a goroutine which calls onChange with the name of the changed file whenever
+// one of the files at the given paths is written, created or renamed. The directories containing
+// the files are watched so that files which are replaced rather than modified, such as Kubernetes
+// ConfigMap and Secret volumes, are detected. Errors reported by the watcher, such as an overflow
+// of the event queue, are logged and watching continues. Calling the cancel function associated
+// with the provided context stops watching. An error is returned if the files cannot be watched.
+func WatchFiles(ctx context.Context, paths []string, onChange func(name string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	for _, path := range paths {
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			_ = watcher.Close()
+			return fmt.Errorf("failed to watch directory of %s: %w", path, err)
+		}
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if isFileEvent(event, paths) {
+					onChange(event.Name)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Get(ctx).Error("file watcher error", zap.Error(err), zap.Strings("paths", paths))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// isFileEvent returns true if the given event modifies one of the files at paths. Kubernetes
+// ConfigMap and Secret volumes replace files by swapping the `..data` symlink in the same
+// directory.
+func isFileEvent(event fsnotify.Event, paths []string) bool {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	if filepath.Base(name) == "..data" {
+		return true
+	}
+	for _, path := range paths {
+		if name == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
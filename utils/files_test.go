@@ -0,0 +1,68 @@
+// Copyright 2023 SpotHero
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("a: 1"), 0o600))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan string, 10)
+	require.NoError(t, WatchFiles(ctx, []string{path}, func(name string) { changed <- name }))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("b: 1"), 0o600))
+	require.NoError(t, os.WriteFile(path, []byte("a: 2"), 0o600))
+	select {
+	case name := <-changed:
+		assert.Equal(t, path, name)
+	case <-time.After(time.Second):
+		t.Fatal("the change was not detected")
+	}
+
+	assert.Error(t, WatchFiles(ctx, []string{filepath.Join(dir, "missing", "config.yaml")}, func(string) {}))
+}
+
+func TestIsFileEvent(t *testing.T) {
+	paths := []string{"/etc/tls/tls.crt", "/etc/tls/tls.key"}
+	tests := []struct {
+		name     string
+		event    fsnotify.Event
+		expected bool
+	}{
+		{"writes are detected", fsnotify.Event{Name: "/etc/tls/tls.crt", Op: fsnotify.Write}, true},
+		{"writes to any of the files are detected", fsnotify.Event{Name: "/etc/tls/tls.key", Op: fsnotify.Write}, true},
+		{"volume symlink swaps are detected", fsnotify.Event{Name: "/etc/tls/..data", Op: fsnotify.Create}, true},
+		{"other files are ignored", fsnotify.Event{Name: "/etc/tls/ca.crt", Op: fsnotify.Write}, false},
+		{"permission changes are ignored", fsnotify.Event{Name: "/etc/tls/tls.crt", Op: fsnotify.Chmod}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isFileEvent(test.event, paths))
+		})
+	}
+}